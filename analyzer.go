@@ -0,0 +1,256 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// analyzer reports go:generate directives running go-rpcgen whose stubs are
+// missing or out of date, suggesting to regenerate them, and with -suggest
+// interfaces stubs could be generated for, suggesting a directive. The
+// go-rpcgen binary runs it when invoked by "go vet -vettool".
+var analyzer = &analysis.Analyzer{
+	Name: "rpcgen",
+	Doc: `check that RPC stubs generated by go-rpcgen are up to date
+
+For every //go:generate directive running go-rpcgen, the stubs are rendered
+and compared with the files on disk, as "go-rpcgen check" would. Stale stubs
+in the package come with a suggested fix regenerating them.
+
+With -suggest, interfaces that stubs can be generated for but that no
+directive generates stubs for are reported too, with a suggested fix adding
+a directive.`,
+	Run: runAnalyzer,
+}
+
+// suggest is the -suggest flag of the analyzer.
+var suggest bool
+
+func init() {
+	analyzer.Flags.BoolVar(&suggest, "suggest", false, "report interfaces without go-rpcgen stubs that stubs can be generated for")
+}
+
+func runAnalyzer(pass *analysis.Pass) (interface{}, error) {
+	var generated []*Options
+	for _, f := range pass.Files {
+		dir := filepath.Dir(pass.Fset.File(f.Pos()).Name())
+		for _, group := range f.Comments {
+			for _, c := range group.List {
+				args, ok := generateDirective(c)
+				if !ok {
+					continue
+				}
+				generated = append(generated, checkDirective(pass, c, dir, args)...)
+			}
+		}
+	}
+	if suggest {
+		for _, f := range pass.Files {
+			suggestDirectives(pass, f, generated)
+		}
+	}
+	return nil, nil
+}
+
+// generateDirective returns the arguments of c if it is a go:generate
+// directive running go-rpcgen, directly or with "go run".
+func generateDirective(c *ast.Comment) ([]string, bool) {
+	if !strings.HasPrefix(c.Text, "//go:generate ") {
+		return nil, false
+	}
+	words := strings.Fields(strings.TrimPrefix(c.Text, "//go:generate "))
+	for i, word := range words {
+		if strings.HasSuffix(word, "go-rpcgen") || strings.Contains(word, "go-rpcgen@") {
+			return words[i+1:], true
+		}
+	}
+	return nil, false
+}
+
+// directiveTargets returns the options of the interfaces a go:generate
+// directive running go-rpcgen with arguments args in dir generates stubs
+// for. Directives running other commands than generate have none.
+func directiveTargets(dir string, args []string) ([]*Options, error) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if args[0] != "generate" {
+			return nil, nil
+		}
+		args = args[1:]
+	}
+	// The flags of the directive select the targets, but must not change how
+	// the current run reports.
+	defer func(format string, level int) {
+		diagnosticsFormat, verbosity = format, level
+	}(diagnosticsFormat, verbosity)
+	cmd := generateCommand()
+	cmd.flags.Init(cmd.name, flag.ContinueOnError)
+	cmd.flags.SetOutput(ioutil.Discard)
+	cmd.flags.Usage = func() {}
+	if err := cmd.flags.Parse(args); err != nil {
+		return nil, fmt.Errorf("invalid go-rpcgen arguments: %s", err)
+	}
+	return cmd.targets.targets(dir)
+}
+
+// checkDirective reports the problems with the stubs generated by the
+// go-rpcgen directive c with arguments args, run in dir, and returns the
+// options of the interfaces it generates stubs for.
+func checkDirective(pass *analysis.Pass, c *ast.Comment, dir string, args []string) []*Options {
+	targets, err := directiveTargets(dir, args)
+	if err != nil {
+		pass.Reportf(c.Pos(), "%s", err)
+		return nil
+	}
+	for _, opts := range targets {
+		_, files, err := render(opts)
+		if err != nil {
+			pass.Reportf(c.Pos(), "%s", err)
+			continue
+		}
+		for _, file := range files {
+			existing, err := ioutil.ReadFile(file.Path)
+			rel, _ := filepath.Rel(dir, file.Path)
+			switch {
+			case os.IsNotExist(err):
+				pass.Reportf(c.Pos(), "RPC stubs for %s are missing from %s; run go generate", opts.Type, rel)
+			case err != nil:
+				pass.Reportf(c.Pos(), "%s", err)
+			case !bytes.Equal(existing, file.Content):
+				diagnostic := analysis.Diagnostic{
+					Pos:     c.Pos(),
+					Message: rel + " is out of date with " + opts.Type + "; run go generate",
+				}
+				if edit, ok := replaceFile(pass, file); ok {
+					diagnostic.SuggestedFixes = []analysis.SuggestedFix{{
+						Message:   "Regenerate stale RPC stubs for " + opts.Type,
+						TextEdits: []analysis.TextEdit{edit},
+					}}
+				}
+				pass.Report(diagnostic)
+			}
+		}
+	}
+	return targets
+}
+
+// replaceFile returns an edit replacing the contents of the package file at
+// file.Path, if it is part of the package analyzed.
+func replaceFile(pass *analysis.Pass, file *File) (analysis.TextEdit, bool) {
+	for _, f := range pass.Files {
+		tf := pass.Fset.File(f.Pos())
+		if filepath.Clean(tf.Name()) == filepath.Clean(file.Path) {
+			return analysis.TextEdit{
+				Pos:     tf.Pos(0),
+				End:     tf.Pos(tf.Size()),
+				NewText: file.Content,
+			}, true
+		}
+	}
+	return analysis.TextEdit{}, false
+}
+
+// suggestDirectives reports the interfaces declared in f that stubs can be
+// generated for, but that aren't among generated, suggesting a go:generate
+// directive generating stubs for them.
+func suggestDirectives(pass *analysis.Pass, f *ast.File, generated []*Options) {
+	path := pass.Fset.File(f.Pos()).Name()
+	source := filepath.Base(path)
+	// The default target is named after the source file, so only one of its
+	// interfaces can use it.
+	defaultTaken := false
+	for _, opts := range generated {
+		if filepath.Clean(opts.Source) == filepath.Clean(path) {
+			defaultTaken = true
+		}
+	}
+	isGenerated := func(name string) bool {
+		for _, opts := range generated {
+			if opts.Type == name {
+				return true
+			}
+		}
+		return false
+	}
+	for _, decl := range f.Decls {
+		decl, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range decl.Specs {
+			spec, ok := spec.(*ast.TypeSpec)
+			if !ok || isGenerated(spec.Name.Name) || !spec.Name.IsExported() {
+				continue
+			}
+			if _, ok := spec.Type.(*ast.InterfaceType); !ok {
+				continue
+			}
+			gen := &RPCGen{Type: spec.Name.Name, fileset: pass.Fset}
+			ast.Walk(gen, f)
+			if len(gen.errs) > 0 || len(gen.Methods) == 0 {
+				continue
+			}
+			pos := decl.Pos()
+			if decl.Doc != nil {
+				pos = decl.Doc.Pos()
+			}
+			directive := "//go:generate go-rpcgen --source=" + source + " --type=" + spec.Name.Name
+			if defaultTaken {
+				directive += " --target=" + snake(spec.Name.Name) + defaultSuffix
+			}
+			defaultTaken = true
+			directive += "\n\n"
+			pass.Report(analysis.Diagnostic{
+				Pos:     spec.Name.Pos(),
+				Message: "RPC stubs can be generated for " + spec.Name.Name,
+				SuggestedFixes: []analysis.SuggestedFix{{
+					Message:   "Generate RPC stubs for " + spec.Name.Name,
+					TextEdits: []analysis.TextEdit{{Pos: pos, End: pos, NewText: []byte(directive)}},
+				}},
+			})
+		}
+	}
+}
+
+// isVetInvocation reports whether args are those "go vet -vettool" runs a
+// tool with: -V=full or -flags to describe it, then the analysis flags and
+// the path of a vet.cfg file describing a package.
+func isVetInvocation(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	if args[0] == "-V=full" || args[0] == "-flags" {
+		return true
+	}
+	last := args[len(args)-1]
+	if !strings.HasSuffix(last, ".cfg") || strings.HasPrefix(last, "-") {
+		return false
+	}
+	for _, arg := range args[:len(args)-1] {
+		if !strings.HasPrefix(arg, "-") {
+			return false
+		}
+	}
+	return true
+}
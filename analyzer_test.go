@@ -0,0 +1,176 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// analyze runs the analyzer on the Go files of dir, with -suggest set to
+// withSuggest, and returns its diagnostics.
+func analyze(t *testing.T, dir string, withSuggest bool) []analysis.Diagnostic {
+	t.Helper()
+	defer func(previous bool) { suggest = previous }(suggest)
+	suggest = withSuggest
+	fset := token.NewFileSet()
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	var files []*ast.File
+	for _, path := range paths {
+		f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	var diagnostics []analysis.Diagnostic
+	pass := &analysis.Pass{
+		Analyzer: analyzer,
+		Fset:     fset,
+		Files:    files,
+		Report:   func(d analysis.Diagnostic) { diagnostics = append(diagnostics, d) },
+	}
+	if _, err := analyzer.Run(pass); err != nil {
+		t.Fatal(err)
+	}
+	return diagnostics
+}
+
+func TestAnalyzer(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"arith.go": "package arith\n\n//go:generate go-rpcgen --source=arith.go --type=Arith\n\n// Arith does arithmetic.\ntype Arith interface {\n\tAdd(a, b int) (sum int, err error)\n}\n\n// Store stores values.\ntype Store interface {\n\tGet(key string) (value string, err error)\n}\n",
+	})
+	target := filepath.Join(dir, "arithrpc.gen.go")
+
+	diagnostics := analyze(t, dir, false)
+	if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "missing from arithrpc.gen.go") {
+		t.Fatalf("got diagnostics %+v for missing stubs, want one about arithrpc.gen.go", diagnostics)
+	}
+
+	opts := &Options{Source: filepath.Join(dir, "arith.go"), Type: "Arith"}
+	opts.setDefaults()
+	_, rendered, err := render(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(target, rendered[0].Content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if diagnostics := analyze(t, dir, false); len(diagnostics) != 0 {
+		t.Errorf("got diagnostics %+v for up-to-date stubs, want none", diagnostics)
+	}
+
+	// Stale stubs come with a fix replacing them with fresh ones.
+	stale := strings.Replace(string(rendered[0].Content), "Add", "Sum", 1)
+	if err := ioutil.WriteFile(target, []byte(stale), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	diagnostics = analyze(t, dir, false)
+	if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "out of date with Arith") {
+		t.Fatalf("got diagnostics %+v for stale stubs, want one saying they are out of date", diagnostics)
+	}
+	if fixes := diagnostics[0].SuggestedFixes; len(fixes) != 1 || len(fixes[0].TextEdits) != 1 || string(fixes[0].TextEdits[0].NewText) != string(rendered[0].Content) {
+		t.Errorf("got fixes %+v for stale stubs, want one regenerating them", fixes)
+	}
+
+	// With -suggest, Store gets a directive with its own target, as Arith
+	// takes the default one.
+	if err := ioutil.WriteFile(target, rendered[0].Content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	diagnostics = analyze(t, dir, true)
+	if len(diagnostics) != 1 || diagnostics[0].Message != "RPC stubs can be generated for Store" {
+		t.Fatalf("got diagnostics %+v with -suggest, want one for Store", diagnostics)
+	}
+	want := "//go:generate go-rpcgen --source=arith.go --type=Store --target=store" + defaultSuffix + "\n\n"
+	if fixes := diagnostics[0].SuggestedFixes; len(fixes) != 1 || len(fixes[0].TextEdits) != 1 || string(fixes[0].TextEdits[0].NewText) != want {
+		t.Errorf("got fixes %+v with -suggest, want one adding %q", fixes, want)
+	}
+}
+
+func TestSuggestedFixes(t *testing.T) {
+	dir := t.TempDir()
+	source := "package store\n\n// Store stores values.\ntype Store interface {\n\tGet(key string) (value string, err error)\n}\n\n// Cache caches values.\ntype Cache interface {\n\tGet(key string) (value string, err error)\n}\n\ntype unexported interface {\n\tGet(key string) (value string, err error)\n}\n\n// Invalid can't have stubs.\ntype Invalid interface {\n\tGet(key string) string\n}\n"
+	writeTree(t, dir, map[string]string{"store.go": source})
+
+	// Applying the fixes adds a directive above the doc comment of each
+	// interface stubs can be generated for, the second one with a target of
+	// its own.
+	diagnostics := analyze(t, dir, true)
+	fixed := []byte(source)
+	for i := len(diagnostics) - 1; i >= 0; i-- {
+		for _, fix := range diagnostics[i].SuggestedFixes {
+			for _, edit := range fix.TextEdits {
+				offset := int(edit.Pos) - 1 // the only file of the file set starts at 1
+				fixed = append(fixed[:offset:offset], append(edit.NewText, fixed[offset:]...)...)
+			}
+		}
+	}
+	want := strings.NewReplacer(
+		"// Store stores", "//go:generate go-rpcgen --source=store.go --type=Store\n\n// Store stores",
+		"// Cache caches", "//go:generate go-rpcgen --source=store.go --type=Cache --target=cache"+defaultSuffix+"\n\n// Cache caches",
+	).Replace(source)
+	if string(fixed) != want {
+		t.Errorf("applying the fixes gives\n%s\nwant\n%s", fixed, want)
+	}
+	writeTree(t, dir, map[string]string{"store.go": string(fixed)})
+	if diagnostics := analyze(t, dir, true); len(diagnostics) != 2 || !strings.Contains(diagnostics[0].Message, "missing") || !strings.Contains(diagnostics[1].Message, "missing") {
+		t.Errorf("got diagnostics %+v once fixed, want the stubs of both interfaces missing", diagnostics)
+	}
+}
+
+func TestStaleStubsOutsidePackage(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"arith.go":           "package arith\n\n//go:generate go-rpcgen --source=arith.go --type=Arith --target=stubs/arith.gen.go\n\ntype Arith interface {\n\tAdd(a, b int) (sum int, err error)\n}\n",
+		"stubs/arith.gen.go": "package arith\n",
+		"go.mod":             "module example.com/arith\n",
+	})
+	// The stubs are out of date, but not part of the package analyzed, so
+	// there is no edit to suggest.
+	diagnostics := analyze(t, dir, false)
+	if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "out of date") || len(diagnostics[0].SuggestedFixes) != 0 {
+		t.Errorf("got diagnostics %+v, want one without fixes about stale stubs", diagnostics)
+	}
+}
+
+func TestIsVetInvocation(t *testing.T) {
+	tests := []struct {
+		args string
+		want bool
+	}{
+		{"-V=full", true},
+		{"-flags", true},
+		{"-rpcgen.suggest /tmp/vet.cfg", true},
+		{"/tmp/vet.cfg", true},
+		{"", false},
+		{"generate --source=arith.go", false},
+		{"check ./vet.cfg", false},
+		{"-suggest", false},
+	}
+	for _, test := range tests {
+		if got := isVetInvocation(strings.Fields(test.args)); got != test.want {
+			t.Errorf("isVetInvocation(%q) = %v, want %v", test.args, got, test.want)
+		}
+	}
+}
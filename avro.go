@@ -0,0 +1,334 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"regexp"
+)
+
+// avroTypes are the Avro types of the predeclared Go types that have one.
+// Unsigned integers that don't fit in a long have none.
+var avroTypes = map[string]string{
+	"bool":    "boolean",
+	"string":  "string",
+	"int8":    "int",
+	"int16":   "int",
+	"int32":   "int",
+	"rune":    "int",
+	"uint8":   "int",
+	"byte":    "int",
+	"uint16":  "int",
+	"int":     "long",
+	"int64":   "long",
+	"uint32":  "long",
+	"float32": "float",
+	"float64": "double",
+}
+
+// Avro schemas other than primitive type names and unions, whose fields are
+// declared in the order schemas are usually written in.
+type (
+	avroRecord struct {
+		Type      string       `json:"type"`
+		Name      string       `json:"name"`
+		Namespace string       `json:"namespace,omitempty"`
+		Fields    []*avroField `json:"fields"`
+	}
+	avroField struct {
+		Name    string          `json:"name"`
+		Type    interface{}     `json:"type"`
+		Default json.RawMessage `json:"default,omitempty"`
+	}
+	avroArray struct {
+		Type  string      `json:"type"`
+		Items interface{} `json:"items"`
+	}
+	avroMap struct {
+		Type   string      `json:"type"`
+		Values interface{} `json:"values"`
+	}
+	avroLogical struct {
+		Type        string `json:"type"`
+		LogicalType string `json:"logicalType"`
+	}
+	avroEnum struct {
+		Type    string   `json:"type"`
+		Name    string   `json:"name"`
+		Symbols []string `json:"symbols"`
+	}
+)
+
+// avroName matches the names Avro allows, such as enum symbols.
+var avroName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// avroSchemas builds the Avro schemas of the request and response structures
+// of an interface declared in f.
+type avroSchemas struct {
+	fileset *token.FileSet
+	f       *ast.File
+	// decls are the types declared in f, by name.
+	decls map[string]*ast.TypeSpec
+	// defined are the names of the records already defined, which later
+	// uses refer to by name.
+	defined map[string]bool
+	// resolving are the names of the other declared types being resolved,
+	// to detect recursive ones.
+	resolving map[string]bool
+	// enums are the enum types declared in f, by name.
+	enums map[string]*Enum
+	// mappings are the types sent as others, by package path and name.
+	mappings map[string]*TypeMapping
+}
+
+// avro returns the Avro schemas of the request and response structures, as a
+// JSON array of records named like them in the namespace of the package of
+// f. Time values are timestamps in microseconds, or Unix times in the unit
+// the method sends them in. Struct types declared in the source file become
+// nested records, and other types declared there are replaced with their
+// underlying type, except for string enums marked nonzero, which become
+// enums of their values. Request fields with defaults default to null, and fields left out
+// of JSON when empty to their empty value.
+func (r *RPCGen) avro(f *ast.File) ([]byte, error) {
+	a := &avroSchemas{fileset: r.fileset, f: f, decls: typeDecls(f), defined: map[string]bool{}, resolving: map[string]bool{}, enums: r.enums, mappings: r.mappings}
+	schemas := []*avroRecord{}
+	for _, m := range r.Methods {
+		for _, s := range []struct {
+			name     string
+			fields   []*Type
+			defaults []*Default
+		}{{r.Type + m.Name + "Request", m.Parameters, m.Defaults}, {r.Type + m.Name + "Response", m.Results, nil}} {
+			var fields []*avroField
+			for _, t := range s.fields {
+				typ, err := a.schema(t.expr)
+				if err != nil {
+					return nil, err
+				}
+				switch t.Unix {
+				case UnixSeconds:
+					typ = "long"
+				case UnixMilliseconds:
+					typ = &avroLogical{"long", "timestamp-millis"}
+				}
+				for _, name := range t.Names {
+					field := &avroField{Name: name, Type: typ}
+					switch {
+					case defaultOf(s.defaults, name) != nil:
+						// The default is set by the service, so the
+						// field is optional on the wire.
+						field.Default = json.RawMessage("null")
+					case m.OmitsEmpty(name):
+						field.Default = avroZero(typ)
+					}
+					fields = append(fields, field)
+				}
+			}
+			schemas = append(schemas, a.record(s.name, f.Name.Name, fields))
+		}
+	}
+	data, err := json.MarshalIndent(schemas, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// avroZero returns the JSON of the empty value of the Avro type typ, the
+// default of fields that may be missing, or nil for records, which have none.
+func avroZero(typ interface{}) json.RawMessage {
+	switch t := typ.(type) {
+	case string:
+		switch t {
+		case "boolean":
+			return json.RawMessage("false")
+		case "int", "long", "float", "double":
+			return json.RawMessage("0")
+		case "string", "bytes":
+			return json.RawMessage(`""`)
+		}
+	case []interface{}:
+		return json.RawMessage("null")
+	case *avroArray:
+		return json.RawMessage("[]")
+	case *avroMap:
+		return json.RawMessage("{}")
+	case *avroLogical:
+		return json.RawMessage("0")
+	}
+	return nil
+}
+
+// record returns the schema of a record. Records nested in the request and
+// response structures omit the namespace, inheriting it.
+func (a *avroSchemas) record(name, namespace string, fields []*avroField) *avroRecord {
+	a.defined[name] = true
+	if fields == nil {
+		fields = []*avroField{}
+	}
+	return &avroRecord{"record", name, namespace, fields}
+}
+
+// schema returns the Avro schema of the Go type expr.
+func (a *avroSchemas) schema(expr ast.Expr) (interface{}, error) {
+	switch t := expr.(type) {
+	case *ast.ParenExpr:
+		return a.schema(t.X)
+	case *ast.Ident:
+		if spec := a.decls[t.Name]; spec != nil && spec.TypeParams == nil {
+			return a.named(spec)
+		}
+		if typ, ok := avroTypes[t.Name]; ok {
+			return typ, nil
+		}
+	case *ast.StarExpr:
+		elem, err := a.schema(t.X)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{"null", elem}, nil
+	case *ast.ArrayType:
+		if elem, ok := t.Elt.(*ast.Ident); ok && (elem.Name == "byte" || elem.Name == "uint8") {
+			return "bytes", nil
+		}
+		items, err := a.schema(t.Elt)
+		if err != nil {
+			return nil, err
+		}
+		return &avroArray{"array", items}, nil
+	case *ast.MapType:
+		if key, ok := t.Key.(*ast.Ident); !ok || key.Name != "string" {
+			break
+		}
+		values, err := a.schema(t.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &avroMap{"map", values}, nil
+	case *ast.SelectorExpr:
+		if m := typeMapping(a.mappings, a.f.Imports, t); m != nil {
+			return a.mapped(expr, m)
+		}
+		if x, ok := t.X.(*ast.Ident); ok && isTimePackage(a.f.Imports, x.Name) {
+			switch t.Sel.Name {
+			case "Time":
+				return &avroLogical{"long", "timestamp-micros"}, nil
+			case "Duration":
+				return "long", nil
+			}
+		}
+	}
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, a.fileset, expr)
+	return nil, nodeError(a.fileset, expr, CodeAvro, "type %s has no Avro equivalent", buf.String())
+}
+
+// mapped returns the schema of the type expr mapped to another by m: the
+// schema m sets, or else that of the type it is sent as.
+func (a *avroSchemas) mapped(expr ast.Expr, m *TypeMapping) (interface{}, error) {
+	if m.Avro != "" {
+		return json.RawMessage(m.Avro), nil
+	}
+	wire, err := parser.ParseExpr(m.Type)
+	if err == nil {
+		var schema interface{}
+		if schema, err = a.schema(wire); err == nil {
+			return schema, nil
+		}
+	}
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, a.fileset, expr)
+	return nil, nodeError(a.fileset, expr, CodeAvro, "type %s, sent as %s, has no Avro equivalent", buf.String(), m.Type)
+}
+
+// named returns the schema of a type declared in the source file: a record
+// for a struct type and an enum for a string enum whose values are Avro
+// names, defined on first use, and otherwise the schema of the underlying
+// type.
+func (a *avroSchemas) named(spec *ast.TypeSpec) (interface{}, error) {
+	name := spec.Name.Name
+	if symbols := a.symbols(name); symbols != nil {
+		if a.defined[name] {
+			return name, nil
+		}
+		a.defined[name] = true
+		return &avroEnum{"enum", name, symbols}, nil
+	}
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		if a.resolving[name] {
+			return nil, nodeError(a.fileset, spec, CodeAvro, "recursive type %s has no Avro equivalent", name)
+		}
+		a.resolving[name] = true
+		defer delete(a.resolving, name)
+		return a.schema(spec.Type)
+	}
+	if a.defined[name] {
+		return name, nil
+	}
+	a.defined[name] = true
+	var fields []*avroField
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			return nil, nodeError(a.fileset, field, CodeAvro, "embedded field of %s has no Avro equivalent", name)
+		}
+		// Like gob, only exported fields are encoded.
+		var names []string
+		for _, n := range field.Names {
+			if n.IsExported() {
+				names = append(names, n.Name)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		typ, err := a.schema(field.Type)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			fields = append(fields, &avroField{Name: name, Type: typ})
+		}
+	}
+	return a.record(name, "", fields), nil
+}
+
+// symbols returns the symbols of the Avro enum of the type name, the values
+// of its constants, or nil if it isn't a string enum, has values that aren't
+// Avro names, or accepts the empty string, which isn't one.
+func (a *avroSchemas) symbols(name string) []string {
+	enum := a.enums[name]
+	if enum == nil || !enum.String || !enum.NonZero {
+		return nil
+	}
+	var symbols []string
+	seen := map[string]bool{}
+	for _, c := range enum.Constants {
+		symbol := constant.StringVal(c.value)
+		if !avroName.MatchString(symbol) {
+			return nil
+		}
+		if !seen[symbol] {
+			seen[symbol] = true
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
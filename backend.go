@@ -0,0 +1,140 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/template"
+)
+
+// pluginPrefix is prepended to the name of a plugin to form the name of the
+// executable implementing it.
+const pluginPrefix = "go-rpcgen-"
+
+// Backend turns the resolved model of a generated file into source files.
+// The model passed to Render is ready for output: its methods are qualified
+// and its imports resolved for the package of path.
+type Backend interface {
+	Render(gen *RPCGen, path string) ([]*File, error)
+}
+
+// newBackend returns the backend selected by the options: a plugin if one is
+// named, or the template otherwise.
+func newBackend(opts *Options) (Backend, error) {
+	if opts.Plugin != "" {
+		return newPluginBackend(opts.Plugin)
+	}
+	t, err := loadTemplate(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &templateBackend{t: t, opts: opts}, nil
+}
+
+// templateBackend renders a Go file with a template.
+type templateBackend struct {
+	t    *template.Template
+	opts *Options
+}
+
+func (b *templateBackend) Render(gen *RPCGen, path string) ([]*File, error) {
+	start := time.Now()
+	src, err := execute(b.t, gen)
+	if err != nil {
+		return nil, templateError(b.opts, err)
+	}
+	timed("executing the template for "+path, start)
+	start = time.Now()
+	if src, err = formatSource(path, src, b.opts.Format); err != nil {
+		return nil, err
+	}
+	timed("formatting "+path, start)
+	return []*File{{Path: path, Content: src}}, nil
+}
+
+// pluginRequest is written as JSON to the standard input of a plugin.
+type pluginRequest struct {
+	// Path is the file the built-in backend would write.
+	Path  string  `json:"path"`
+	Model *RPCGen `json:"model"`
+}
+
+// pluginResponse is read as JSON from the standard output of a plugin.
+type pluginResponse struct {
+	Files []struct {
+		// Path is relative to the directory of the request path, unless
+		// absolute.
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	} `json:"files"`
+	Error string `json:"error"`
+}
+
+// pluginBackend delegates rendering to an external executable, in the manner
+// of protoc plugins.
+type pluginBackend struct {
+	name string
+	path string
+}
+
+func newPluginBackend(name string) (*pluginBackend, error) {
+	path := name
+	if !strings.ContainsRune(name, filepath.Separator) {
+		var err error
+		if path, err = exec.LookPath(pluginPrefix + name); err != nil {
+			return nil, fmt.Errorf("plugin %s not found: %s", name, err)
+		}
+	}
+	return &pluginBackend{name: name, path: path}, nil
+}
+
+func (b *pluginBackend) Render(gen *RPCGen, path string) ([]*File, error) {
+	defer timed("running plugin "+b.name+" for "+path, time.Now())
+	request, err := json.Marshal(&pluginRequest{Path: path, Model: gen})
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(b.path)
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s failed: %s: %s", b.name, err, stderr.String())
+	}
+	var response pluginResponse
+	if err := json.Unmarshal(out, &response); err != nil {
+		return nil, fmt.Errorf("plugin %s returned an invalid response: %s", b.name, err)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("plugin %s: %s", b.name, response.Error)
+	}
+	var files []*File
+	for _, f := range response.Files {
+		p := f.Path
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(filepath.Dir(path), p)
+		}
+		files = append(files, &File{Path: p, Content: []byte(f.Content)})
+	}
+	return files, nil
+}
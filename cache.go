@@ -0,0 +1,141 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Sources and package lookups are cached for the lifetime of the process,
+// so that generating stubs for several interfaces declared in the same
+// package parses each file and runs go list once. The cache is safe for
+// concurrent use by the workers rendering interfaces.
+var cache = struct {
+	sync.Mutex
+	files       map[string]*parsedFile
+	importPaths map[string]*importPathEntry
+	packages    map[string]*packageEntry
+}{
+	files:       map[string]*parsedFile{},
+	importPaths: map[string]*importPathEntry{},
+	packages:    map[string]*packageEntry{},
+}
+
+// parsedFile is a source file parsed once and shared by the interfaces
+// declared in it. Its syntax tree must not be modified.
+type parsedFile struct {
+	once    sync.Once
+	src     []byte
+	fileset *token.FileSet
+	f       *ast.File
+	err     error
+}
+
+// parseSource parses the source file named filename with contents src, or
+// returns the result of a previous call with the same contents. Changed
+// contents, as in watch mode, are parsed again.
+func parseSource(filename string, src []byte) (*token.FileSet, *ast.File, error) {
+	cache.Lock()
+	p := cache.files[filename]
+	if p == nil || !bytes.Equal(p.src, src) {
+		p = &parsedFile{src: src}
+		cache.files[filename] = p
+	} else {
+		debugf("reusing parsed %s", filename)
+	}
+	cache.Unlock()
+	p.once.Do(func() {
+		p.fileset = token.NewFileSet()
+		p.f, p.err = parser.ParseFile(p.fileset, filename, src, parser.ParseComments)
+	})
+	return p.fileset, p.f, p.err
+}
+
+type importPathEntry struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+// importPath returns the import path of the package in dir, running go list
+// once per directory.
+func importPath(dir string) (string, error) {
+	key := dir
+	if abs, err := filepath.Abs(dir); err == nil {
+		key = abs
+	}
+	cache.Lock()
+	e := cache.importPaths[key]
+	if e == nil {
+		e = &importPathEntry{}
+		cache.importPaths[key] = e
+	}
+	cache.Unlock()
+	e.once.Do(func() {
+		e.path, e.err = listImportPath(dir)
+	})
+	return e.path, e.err
+}
+
+type packageEntry struct {
+	once sync.Once
+	pkgs []*packages.Package
+	err  error
+}
+
+// loadPackage returns the type-checked package containing the file at the
+// absolute path, loading each directory once, with its tests if path is a
+// test file.
+func loadPackage(path string) (*packages.Package, error) {
+	tests := strings.HasSuffix(path, "_test.go")
+	key := filepath.Dir(path)
+	if tests {
+		key += " [tests]"
+	}
+	cache.Lock()
+	e := cache.packages[key]
+	if e == nil {
+		e = &packageEntry{}
+		cache.packages[key] = e
+	}
+	cache.Unlock()
+	e.once.Do(func() {
+		e.pkgs, e.err = packages.Load(&packages.Config{
+			Mode:  packages.NeedName | packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes,
+			Dir:   filepath.Dir(path),
+			Tests: tests,
+		}, ".")
+	})
+	if e.err != nil {
+		return nil, e.err
+	}
+	for _, pkg := range e.pkgs {
+		for _, file := range pkg.GoFiles {
+			if file == path && pkg.Types != nil && len(pkg.Errors) == 0 {
+				return pkg, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s is not part of a package that type-checks", path)
+}
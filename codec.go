@@ -0,0 +1,124 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kinds of encodings of the binary codec.
+const (
+	binarySigned   = "signed"
+	binaryUnsigned = "unsigned"
+	binaryBool     = "bool"
+	binaryFloat32  = "float32"
+	binaryFloat64  = "float64"
+	binaryString   = "string"
+	binaryBytes    = "bytes"
+	binaryTime     = "time"
+)
+
+// binaryKinds maps the types the binary codec encodes to their encoding.
+// Integers and durations are varints, floats their IEEE 754 bits in little
+// endian, and strings, byte slices and times, encoded by their MarshalBinary
+// method like gob does, are prefixed with their length.
+var binaryKinds = map[string]string{
+	"int": binarySigned, "int8": binarySigned, "int16": binarySigned,
+	"int32": binarySigned, "int64": binarySigned, "rune": binarySigned,
+	"uint": binaryUnsigned, "uint8": binaryUnsigned, "uint16": binaryUnsigned,
+	"uint32": binaryUnsigned, "uint64": binaryUnsigned, "uintptr": binaryUnsigned,
+	"byte":    binaryUnsigned,
+	"bool":    binaryBool,
+	"float32": binaryFloat32,
+	"float64": binaryFloat64,
+	"string":  binaryString,
+	"[]byte":  binaryBytes,
+
+	"time.Duration": binarySigned,
+	"time.Time":     binaryTime,
+}
+
+// binaryCodec reports whether the binary codec can encode every field of a
+// request or response structure.
+func binaryCodec(fields []*Type) bool {
+	for _, t := range fields {
+		if binaryKinds[t.WireType()] == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// marshalBinary returns the statements appending the fields, prefixed with
+// prefix, to the byte slice b.
+func marshalBinary(prefix string, fields []*Type) string {
+	var out []string
+	for _, t := range fields {
+		for _, name := range t.Names {
+			v := prefix + name
+			switch binaryKinds[t.WireType()] {
+			case binarySigned:
+				out = append(out, fmt.Sprintf("b = binary.AppendVarint(b, int64(%s))", v))
+			case binaryUnsigned:
+				out = append(out, fmt.Sprintf("b = binary.AppendUvarint(b, uint64(%s))", v))
+			case binaryBool:
+				out = append(out, fmt.Sprintf("if %s {\nb = append(b, 1)\n} else {\nb = append(b, 0)\n}", v))
+			case binaryFloat32:
+				out = append(out, fmt.Sprintf("b = binary.LittleEndian.AppendUint32(b, math.Float32bits(%s))", v))
+			case binaryFloat64:
+				out = append(out, fmt.Sprintf("b = binary.LittleEndian.AppendUint64(b, math.Float64bits(%s))", v))
+			case binaryString, binaryBytes:
+				out = append(out, fmt.Sprintf("b = binary.AppendUvarint(b, uint64(len(%s)))\nb = append(b, %s...)", v, v))
+			case binaryTime:
+				out = append(out, fmt.Sprintf("if t, err := %s.MarshalBinary(); err != nil {\nreturn nil, err\n} else {\nb = binary.AppendUvarint(b, uint64(len(t)))\nb = append(b, t...)\n}", v))
+			}
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// unmarshalBinary returns the statements decoding the fields, prefixed with
+// prefix, from the byte slice data as encoded by marshalBinary, returning
+// io.ErrUnexpectedEOF if it is too short.
+func unmarshalBinary(prefix string, fields []*Type) string {
+	var out []string
+	for _, t := range fields {
+		for _, name := range t.Names {
+			v := prefix + name
+			var decode string
+			switch binaryKinds[t.WireType()] {
+			case binarySigned:
+				decode = fmt.Sprintf("if x, n := binary.Varint(data); n > 0 {\n%s, data = %s(x), data[n:]\n}", v, t.WireType())
+			case binaryUnsigned:
+				decode = fmt.Sprintf("if x, n := binary.Uvarint(data); n > 0 {\n%s, data = %s(x), data[n:]\n}", v, t.WireType())
+			case binaryBool:
+				decode = fmt.Sprintf("if len(data) > 0 {\n%s, data = data[0] == 1, data[1:]\n}", v)
+			case binaryFloat32:
+				decode = fmt.Sprintf("if len(data) >= 4 {\n%s, data = math.Float32frombits(binary.LittleEndian.Uint32(data)), data[4:]\n}", v)
+			case binaryFloat64:
+				decode = fmt.Sprintf("if len(data) >= 8 {\n%s, data = math.Float64frombits(binary.LittleEndian.Uint64(data)), data[8:]\n}", v)
+			case binaryString:
+				decode = fmt.Sprintf("if l, n := binary.Uvarint(data); n > 0 && uint64(len(data)-n) >= l {\n%s, data = string(data[n:n+int(l)]), data[n+int(l):]\n}", v)
+			case binaryBytes:
+				decode = fmt.Sprintf("if l, n := binary.Uvarint(data); n > 0 && uint64(len(data)-n) >= l {\n%s, data = append([]byte(nil), data[n:n+int(l)]...), data[n+int(l):]\n}", v)
+			case binaryTime:
+				decode = fmt.Sprintf("if l, n := binary.Uvarint(data); n > 0 && uint64(len(data)-n) >= l {\nif err := %s.UnmarshalBinary(data[n : n+int(l)]); err != nil {\nreturn err\n}\ndata = data[n+int(l):]\n}", v)
+			}
+			out = append(out, decode+" else {\nreturn io.ErrUnexpectedEOF\n}")
+		}
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// checkCollisions returns an error if a generated Go file declares a name
+// that another file of its package already declares, which would keep the
+// package from compiling. The files being generated replace those at their
+// paths, so their previous contents aren't taken into account.
+func checkCollisions(files []*File) error {
+	generated := map[string]bool{}
+	for _, file := range files {
+		generated[filepath.Clean(file.Path)] = true
+	}
+	for _, file := range files {
+		if file.Path == stdio || !strings.HasSuffix(file.Path, ".go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), file.Path, file.Content, 0)
+		if err != nil {
+			// Invalid output is reported when formatting it.
+			continue
+		}
+		names := topLevelNames(f)
+		if len(names) == 0 {
+			continue
+		}
+		test := strings.HasSuffix(file.Path, "_test.go")
+		matches, _ := filepath.Glob(filepath.Join(filepath.Dir(file.Path), "*.go"))
+		for _, m := range matches {
+			if generated[filepath.Clean(m)] || (!test && strings.HasSuffix(m, "_test.go")) {
+				continue
+			}
+			fileset := token.NewFileSet()
+			other, err := parser.ParseFile(fileset, m, nil, 0)
+			if err != nil || other.Name.Name != f.Name.Name {
+				continue
+			}
+			for name, ident := range topLevelNames(other) {
+				if names[name] != nil {
+					return nodeError(fileset, ident, CodeCollision, "%s, generated into %s, is already declared", name, filepath.Base(file.Path))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// topLevelNames returns the identifiers of the package-level declarations of
+// f, other than methods and blank identifiers.
+func topLevelNames(f *ast.File) map[string]*ast.Ident {
+	names := map[string]*ast.Ident{}
+	add := func(ident *ast.Ident) {
+		if ident.Name != "_" && ident.Name != "init" {
+			names[ident.Name] = ident
+		}
+	}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil {
+				add(decl.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					add(spec.Name)
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						add(name)
+					}
+				}
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/template"
+)
+
+// combinedTemplate renders a combined client, creating the clients of
+// several services on one connection.
+var combinedTemplate = template.Must(template.New("combined").Parse(`{{if .Header}}{{.Header}}
+
+{{end}}// Code generated by go-rpcgen. DO NOT EDIT.
+// Version: {{.Version}}
+// Source hash: {{.SourceHash}}
+
+package {{.Package}}
+
+// {{.Name}}Client holds the clients of services sharing a connection:
+// {{.Services}}.
+type {{.Name}}Client struct {
+{{range .Clients}}	{{.Type}} *{{.Type}}Client
+{{end}}
+	client *rpc.Client
+}
+
+// Dial{{.Name}}Client connects to addr and creates a new {{.Name}}Client
+// instance.
+func Dial{{.Name}}Client(addr string) (*{{.Name}}Client, error) {
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return _new{{.Name}}Client(client), nil
+}
+
+// New{{.Name}}Client creates a new {{.Name}}Client instance making the calls
+// of all its clients on conn.
+func New{{.Name}}Client(conn io.ReadWriteCloser) *{{.Name}}Client {
+	return _new{{.Name}}Client(rpc.NewClient(conn))
+}
+
+func _new{{.Name}}Client(client *rpc.Client) *{{.Name}}Client {
+	return &{{.Name}}Client{
+{{range .Clients}}		{{.Type}}: New{{.Type}}Client(client),
+{{end}}		client: client,
+	}
+}
+
+// Close terminates the connection shared by the clients.
+func (c *{{.Name}}Client) Close() error {
+	return c.client.Close()
+}
+`))
+
+// combined is the model of a combined client.
+type combined struct {
+	// Name is the name the generated identifiers are derived from, such as
+	// New<Name>Client.
+	Name       string
+	Package    string
+	Clients    []*RPCGen
+	Header     string
+	Version    string
+	SourceHash string
+
+	// suffix and format are those of the first client.
+	suffix, format string
+	// sources are the source files of the clients.
+	sources []string
+	// file is the rendered file.
+	file *File
+}
+
+// Services returns the names of the services of the clients, as a list.
+func (c *combined) Services() string {
+	var names []string
+	for _, client := range c.Clients {
+		names = append(names, client.Service)
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// combinedClients renders the combined clients the targets join through
+// their Combined option, one per name and client package. Targets that failed
+// to render, whose outcome is at the same index in results, are left out.
+func combinedClients(targets []*Options, results []rendered) ([]*combined, error) {
+	type key struct{ name, dir string }
+	groups := map[key]*combined{}
+	var order []key
+	for i, opts := range targets {
+		if opts.Combined == "" || results[i].err != nil {
+			continue
+		}
+		var dir string
+		for _, p := range opts.stubParts() {
+			if p.client {
+				dir = p.dir
+			}
+		}
+		if dir == "" {
+			return nil, fmt.Errorf("%s: %s has no client to join the %s combined client with", opts.Source, opts.Type, opts.Combined)
+		}
+		if opts.RPCClientType != defaultRPCClientType {
+			return nil, fmt.Errorf("%s: the clients joining the %s combined client need RPC client type %s", opts.Source, opts.Combined, defaultRPCClientType)
+		}
+		gen, _, err := parse(opts)
+		if err != nil {
+			return nil, err
+		}
+		if !sameDir(dir, filepath.Dir(opts.Source)) && opts.Package == "" {
+			if gen.Package, err = packageName(dir); err != nil {
+				return nil, err
+			}
+		}
+		k := key{opts.Combined, filepath.Clean(dir)}
+		c := groups[k]
+		if c == nil {
+			c = &combined{Name: opts.Combined, Package: gen.Package, Header: gen.Header, Version: gen.Version, suffix: opts.Suffix, format: opts.Format}
+			groups[k] = c
+			order = append(order, k)
+		}
+		c.Clients = append(c.Clients, gen)
+		c.sources = append(c.sources, opts.Source)
+	}
+	var clients []*combined
+	for _, k := range order {
+		c := groups[k]
+		sort.Slice(c.Clients, func(i, j int) bool { return c.Clients[i].Type < c.Clients[j].Type })
+		hash := sha256.New()
+		for _, client := range c.Clients {
+			fmt.Fprintln(hash, client.Type, client.SourceHash)
+		}
+		c.SourceHash = fmt.Sprintf("sha256:%x", hash.Sum(nil))
+		path := filepath.Join(k.dir, strings.ToLower(c.Name)+c.suffix)
+		var out strings.Builder
+		if err := combinedTemplate.Execute(&out, c); err != nil {
+			return nil, err
+		}
+		src, err := formatSource(path, []byte(out.String()), c.format)
+		if err != nil {
+			return nil, err
+		}
+		c.file = &File{Path: path, Content: src}
+		clients = append(clients, c)
+	}
+	return clients, nil
+}
@@ -0,0 +1,785 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+var usage = `usage: %[1]s <command> [flags]
+
+This utility generates server and client RPC stubs from a Go interface.
+
+If you had a file "arith.go" containing this interface:
+
+  package arith
+
+  type Arith interface {
+  	Add(a, b int) (result int, err error)
+  }
+
+The following command will generate stubs for the interface:
+
+  %[1]s generate --source=arith.go --type=Arith
+
+That will generate a file containing two types, ArithService and ArithClient,
+that can be used with the Go RPC system, and as a client for the system,
+respectively. The command name may be omitted, in which case generate is
+assumed.
+
+Commands:
+`
+
+// version is the go-rpcgen release. It is normally set at build time with
+// -ldflags "-X main.version=<version>".
+var version = ""
+
+// errFailed is returned by commands that have already reported their errors.
+var errFailed = errors.New("failed")
+
+// command is a go-rpcgen subcommand with its own set of flags.
+type command struct {
+	name    string
+	args    string
+	summary string
+	flags   *flag.FlagSet
+	run     func(args []string) error
+	// targets are the target flags of commands that have them.
+	targets *targetFlags
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		generateCommand(),
+		checkCommand(),
+		listCommand(),
+		cleanCommand(),
+		compatCommand(),
+		versionCommand(),
+		doctorCommand(),
+		completionCommand(),
+		helpCommand(),
+	}
+}
+
+func newCommand(name, args, summary string) *command {
+	cmd := &command{
+		name:    name,
+		args:    args,
+		summary: summary,
+		flags:   flag.NewFlagSet(name, flag.ExitOnError),
+	}
+	cmd.flags.Usage = func() {
+		synopsis := strings.TrimSpace("[flags] " + args)
+		fmt.Fprintf(os.Stderr, "usage: %s %s %s\n\n%s.\n", os.Args[0], name, synopsis, summary)
+		if hasFlags(cmd.flags) {
+			fmt.Fprintf(os.Stderr, "\nFlags:\n")
+			cmd.flags.PrintDefaults()
+		}
+	}
+	return cmd
+}
+
+// parseArgs parses the flags of fs wherever they appear in args, before or
+// after the positional arguments, which it returns in order, so that
+// compat old.go new.go --type=Arith works like compat --type=Arith old.go
+// new.go. The arguments after -- are all positional.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if parsed := len(args) - len(rest); parsed > 0 && args[parsed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, usage, os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun \"%s help <command>\" for the flags of a command.\n", os.Args[0])
+}
+
+func isHelpFlag(arg string) bool {
+	switch arg {
+	case "-h", "-help", "--help":
+		return true
+	}
+	return false
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	found := false
+	fs.VisitAll(func(*flag.Flag) { found = true })
+	return found
+}
+
+// targetFlags are the flags selecting and configuring the interfaces a
+// command operates on.
+type targetFlags struct {
+	source         *string
+	rpcType        *string
+	target         *string
+	imports        *string
+	pkg            *string
+	service        *string
+	serviceVersion *string
+	name           *string
+	clientClose    *string
+	pool           *bool
+	binaryCodec    *bool
+	msgp           *bool
+	easyjson       *bool
+	bench          *bool
+	dispatch       *bool
+	jobTTL         *time.Duration
+	maxJobs        *int
+	expvar         *bool
+	pprofLabels    *bool
+	wireDump       *bool
+	health         *bool
+	runner         *bool
+	handshake      *bool
+	logDeprecated  *bool
+	manifest       *bool
+	avro           *bool
+	thrift         *bool
+	ssh            *bool
+	serverOptions  *bool
+	clientOptions  *bool
+	stringer       *bool
+	jsonNaming     *string
+	hmac           *bool
+	nacl           *bool
+	transport      *bool
+	faults         *bool
+	combined       *string
+	sortMethods    *bool
+	rpcClientType  *string
+	mode           *string
+	split          *bool
+	clientPackage  *string
+	serverPackage  *string
+	outputDir      *string
+	suffix         *string
+	template       *string
+	templateDir    *string
+	buildTags      *string
+	headerFile     *string
+	format         *string
+	plugin         *string
+	config         *string
+	jobs           *int
+}
+
+func addTargetFlags(fs *flag.FlagSet) *targetFlags {
+	f := &targetFlags{
+		source:         fs.String("source", "", "source file to parse RPC interface from, or - for stdin (requires --package)"),
+		rpcType:        fs.String("type", "", "type to generate RPC interface from"),
+		target:         fs.String("target", "", "target file to write stubs to, or - for stdout"),
+		imports:        fs.String("imports", strings.Join(defaultImports, ","), "list of imports to add"),
+		pkg:            fs.String("package", "", "package to export under"),
+		service:        fs.String("service", "", "service name to use (defaults to type name)"),
+		serviceVersion: fs.String("service-version", "", "version to register the service under, as in Arith.v2, to serve two versions of it on the same server"),
+		name:           fs.String("name", "", "name to derive the generated identifiers from, such as <name>Service (defaults to type name)"),
+		rpcClientType:  fs.String("rpc_client_type", defaultRPCClientType, "type to use for RPC client interfaces"),
+		pool:           fs.Bool("pool", false, "reuse the request and response structures of the client through a sync.Pool per method"),
+		binaryCodec:    fs.Bool("binary-codec", false, "add MarshalBinary and UnmarshalBinary methods, which gob uses instead of reflection, to request and response types whose fields all have predeclared types"),
+		msgp:           fs.Bool("msgp", false, "add a go:generate directive running msgp on the request and response types, for msgpack encoding"),
+		easyjson:       fs.Bool("easyjson", false, "mark the request and response types for easyjson and add a go:generate directive running it, for JSON codecs"),
+		bench:          fs.Bool("bench", false, "generate a test file benchmarking the codecs on the request and response types"),
+		dispatch:       fs.Bool("dispatch", false, "add methods to the service calling the others by name without reflection, for custom transports"),
+		jobTTL:         fs.Duration("job-ttl", defaultJobTTL, "how long the service keeps the results of finished //rpcgen:job jobs that were not collected"),
+		maxJobs:        fs.Int("max-jobs", defaultMaxJobs, "how many //rpcgen:job jobs, running or not yet collected, the service keeps at once; starting more fails"),
+		expvar:         fs.Bool("expvar", false, "publish the call count, error count and latency of each service method with expvar, under the service name"),
+		pprofLabels:    fs.Bool("pprof-labels", false, "run service methods with rpc.service and rpc.method pprof labels, so that profiles attribute time to them"),
+		wireDump:       fs.Bool("wire-dump", false, "give the client a SetWireDump method dumping its calls and the bytes on its connection at run time"),
+		health:         fs.Bool("health", false, "give the service a HealthMux method serving /healthz and /readyz over HTTP"),
+		runner:         fs.Bool("runner", false, "add a Run<name>Server function serving the service until its context is done or the process receives SIGINT or SIGTERM"),
+		handshake:      fs.Bool("handshake", false, "add Handshake methods checking that client and service were generated from the same interface, called by Dial<name>Client"),
+		logDeprecated:  fs.Bool("log-deprecated", false, "make the service log the first call of each //rpcgen:deprecated method"),
+		manifest:       fs.Bool("manifest", false, "write a JSON manifest of the service, its methods and their request and response fields next to the request and response types"),
+		avro:           fs.Bool("avro", false, "write the Avro schemas of the request and response types next to them, for archiving calls"),
+		thrift:         fs.Bool("thrift", false, "write a Thrift definition of the interface next to the request and response types"),
+		ssh:            fs.Bool("ssh", false, "add a Dial<name>ClientSSH constructor reaching the service through an SSH connection, with golang.org/x/crypto/ssh"),
+		serverOptions:  fs.Bool("server-options", false, "make the service constructors take options adding interceptors, a logger, a concurrency limit, a timeout and request validation"),
+		clientOptions:  fs.Bool("client-options", false, "make the client constructors take options adding interceptors, a timeout and a retry policy"),
+		stringer:       fs.Bool("stringer", false, "add String methods printing the fields of the request and response types, hiding those listed by //rpcgen:redact"),
+		jsonNaming:     fs.String("json-naming", JSONNamingAsIs, "naming of the json tags of the request and response fields: snake, camel or asis (no tags)"),
+		hmac:           fs.Bool("hmac", false, "add Dial<name>ClientHMAC and Serve<name>ConnHMAC, signing and verifying requests with a shared key"),
+		nacl:           fs.Bool("nacl", false, "add Dial<name>ClientNaCl and Serve<name>ConnNaCl, encrypting connections with a pre-shared key through golang.org/x/crypto/nacl"),
+		transport:      fs.Bool("transport", false, "add a <name>Transport interface of connections exchanging frames, with Dial<name>ClientTransport and Serve<name>Transport, for links other than TCP"),
+		faults:         fs.Bool("faults", false, "add a <name>WithFaults decorator of implementations injecting latency, errors and dropped responses into their calls, for testing resilience"),
+		sortMethods:    fs.Bool("sort-methods", false, "generate the methods in the order of their names rather than that of the interface, so that reordering them changes nothing"),
+		combined:       fs.String("combined", "", "name of a combined client creating the clients of all services joining it from the same package on one connection, as New<combined>Client"),
+		clientClose:    fs.String("client-close", defaultClientClose, "name of the client method closing the connection; an interface method of that name closes it after the call"),
+		mode:           fs.String("mode", ModeBoth, "which stubs to generate: client, server or both"),
+		split:          fs.Bool("split", false, "write the client, server and request/response types to separate <source>_{client,server,types}.gen.go files"),
+		clientPackage:  fs.String("client-package", "", "directory of the package to write the client to, if not the source package"),
+		serverPackage:  fs.String("server-package", "", "directory of the package to write the service to, if not the source package"),
+		outputDir:      fs.String("output-dir", "", "directory to write generated files to, created if needed (defaults to the source directory)"),
+		suffix:         fs.String("suffix", defaultSuffix, "suffix replacing the source file extension to form the default target name"),
+		template:       fs.String("template", "", "template file to use instead of the built-in template"),
+		templateDir:    fs.String("template-dir", "", "directory of <section>.tmpl files overriding sections of the template"),
+		buildTags:      fs.String("build-tags", "", "build constraint expression to add as a //go:build line to generated files (defaults to the constraints of the source file)"),
+		headerFile:     fs.String("header-file", "", "file with a banner, such as a license, to put at the top of generated files"),
+		format:         fs.String("format", FormatGofmt, "formatting of generated files: gofmt or gofumpt"),
+		plugin:         fs.String("plugin", "", "render stubs with the go-rpcgen-<plugin> executable, or the plugin at the given path, instead of the template"),
+		config:         fs.String("config", defaultConfigFile, "config file describing the interfaces to generate, used when --source and --type are omitted"),
+		jobs:           fs.Int("jobs", runtime.GOMAXPROCS(0), "number of interfaces to parse and render in parallel"),
+	}
+	addDiagnosticsFlag(fs)
+	addVerbosityFlags(fs)
+	return f
+}
+
+// targets returns the options for the interface named by --source and
+// --type, or for every service in the config file if both are omitted.
+// Relative paths are relative to dir, or to the working directory if dir is
+// empty.
+func (f *targetFlags) targets(dir string) ([]*Options, error) {
+	path := func(p string) string {
+		if dir == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+	var targets []*Options
+	switch {
+	case *f.source == "" && *f.rpcType == "":
+		config, err := loadConfig(path(*f.config))
+		if os.IsNotExist(err) && *f.config == defaultConfigFile {
+			return nil, fmt.Errorf("expected --source and --type, or a config file (%s)", defaultConfigFile)
+		} else if err != nil {
+			return nil, err
+		}
+		targets = config.Targets()
+	case *f.source == "" || *f.rpcType == "":
+		return nil, errors.New("expected --source and --type")
+	default:
+		opts := &Options{
+			Source:         *f.source,
+			Type:           *f.rpcType,
+			Target:         *f.target,
+			Imports:        []string{},
+			Package:        *f.pkg,
+			Service:        *f.service,
+			ServiceVersion: *f.serviceVersion,
+			Name:           *f.name,
+			ClientClose:    *f.clientClose,
+			Pool:           *f.pool,
+			BinaryCodec:    *f.binaryCodec,
+			Msgp:           *f.msgp,
+			Easyjson:       *f.easyjson,
+			Bench:          *f.bench,
+			Dispatch:       *f.dispatch,
+			JobTTL:         *f.jobTTL,
+			MaxJobs:        *f.maxJobs,
+			Expvar:         *f.expvar,
+			PprofLabels:    *f.pprofLabels,
+			WireDump:       *f.wireDump,
+			Health:         *f.health,
+			Runner:         *f.runner,
+			Handshake:      *f.handshake,
+			LogDeprecated:  *f.logDeprecated,
+			Manifest:       *f.manifest,
+			Avro:           *f.avro,
+			Thrift:         *f.thrift,
+			SSH:            *f.ssh,
+			ServerOptions:  *f.serverOptions,
+			ClientOptions:  *f.clientOptions,
+			Stringer:       *f.stringer,
+			JSONNaming:     *f.jsonNaming,
+			HMAC:           *f.hmac,
+			NaCl:           *f.nacl,
+			Transport:      *f.transport,
+			Faults:         *f.faults,
+			Combined:       *f.combined,
+			SortMethods:    *f.sortMethods,
+			RPCClientType:  *f.rpcClientType,
+			Mode:           *f.mode,
+			Split:          *f.split,
+			ClientPackage:  *f.clientPackage,
+			ServerPackage:  *f.serverPackage,
+			OutputDir:      *f.outputDir,
+			Suffix:         *f.suffix,
+			Template:       *f.template,
+			TemplateDir:    *f.templateDir,
+			BuildTags:      *f.buildTags,
+			HeaderFile:     *f.headerFile,
+			Format:         *f.format,
+			Plugin:         *f.plugin,
+		}
+		if *f.imports != "" {
+			opts.Imports = strings.Split(*f.imports, ",")
+		}
+		opts.resolvePaths(path)
+		targets = []*Options{opts}
+	}
+	for _, opts := range targets {
+		opts.setDefaults()
+		if err := opts.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s", opts.Source, err)
+		}
+	}
+	return targets, nil
+}
+
+func generateCommand() *command {
+	cmd := newCommand("generate", "", "Generate RPC stubs for an interface, or for every service in the config file")
+	targetFlags := addTargetFlags(cmd.flags)
+	cmd.targets = targetFlags
+	watchFlag := cmd.flags.Bool("watch", false, "watch the source package and regenerate stubs on change")
+	watchDebounce := cmd.flags.Duration("watch-debounce", 300*time.Millisecond, "quiet period to wait for after a change before regenerating")
+	dumpModel := cmd.flags.Bool("dump-model", false, "print the model of each interface as JSON instead of generating stubs")
+	force := cmd.flags.Bool("force", false, "overwrite target files that were not generated by go-rpcgen")
+	summaryFlag := cmd.flags.Bool("summary", false, "print a summary of the interfaces, methods and files generated, and of the failures, to stdout")
+	jsonFlag := cmd.flags.Bool("json", false, "print the summary as JSON")
+	all := cmd.flags.Bool("all", false, "generate the stubs of every go:generate directive running go-rpcgen in the packages given as arguments, such as ./...")
+	cmd.run = func(args []string) error {
+		var targets []*Options
+		var err error
+		failed := false
+		switch {
+		case *all && (*targetFlags.source != "" || *targetFlags.rpcType != ""):
+			return errors.New("--all can't be combined with --source and --type")
+		case *all:
+			targets, failed, err = annotatedTargets(args)
+		case len(args) > 0:
+			return fmt.Errorf("unexpected arguments %s; use --all to generate stubs for packages", strings.Join(args, " "))
+		default:
+			targets, err = targetFlags.targets("")
+		}
+		if err != nil {
+			return err
+		}
+		if *dumpModel {
+			return dumpModels(targets)
+		}
+		if *summaryFlag || *jsonFlag {
+			for _, opts := range targets {
+				if opts.Target == stdio {
+					return errors.New("a summary can't be printed when writing stubs to stdout")
+				}
+			}
+		}
+		if *watchFlag {
+			watch(targets, *watchDebounce, *targetFlags.jobs, *force, nil)
+			return nil
+		}
+		s := generateAll(targets, *targetFlags.jobs, *force)
+		if *summaryFlag || *jsonFlag {
+			if err := s.print(os.Stdout, *jsonFlag); err != nil {
+				return err
+			}
+		}
+		if s.Failed > 0 {
+			failed = true
+		}
+		if failed {
+			return errFailed
+		}
+		return nil
+	}
+	return cmd
+}
+
+// annotatedTargets returns the options of the interfaces that go:generate
+// directives running go-rpcgen in the files matched by patterns generate
+// stubs for, so that a whole module can be regenerated without running go
+// generate. Like go generate, it skips files excluded by build constraints.
+// Problems with single directives are reported, and make failed true.
+func annotatedTargets(patterns []string) (targets []*Options, failed bool, err error) {
+	files, err := expandPatterns(patterns, buildContext(""), true)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, file := range files {
+		fileset := token.NewFileSet()
+		f, err := parser.ParseFile(fileset, file, nil, parser.ParseComments)
+		if err != nil {
+			report(err)
+			failed = true
+			continue
+		}
+		for _, group := range f.Comments {
+			for _, c := range group.List {
+				args, ok := generateDirective(c)
+				if !ok {
+					continue
+				}
+				found, err := directiveTargets(filepath.Dir(file), args)
+				if err != nil {
+					report(fmt.Errorf("%s: %s", fileset.Position(c.Pos()), err))
+					failed = true
+					continue
+				}
+				targets = append(targets, found...)
+			}
+		}
+	}
+	return targets, failed, nil
+}
+
+// dumpModels prints the model of each target as a JSON object on its own
+// line, for consumption by other tools.
+func dumpModels(targets []*Options) error {
+	enc := json.NewEncoder(os.Stdout)
+	failed := false
+	for _, opts := range targets {
+		gen, _, err := parse(opts)
+		if err != nil {
+			report(err)
+			failed = true
+			continue
+		}
+		if err := enc.Encode(gen); err != nil {
+			return err
+		}
+	}
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+func checkCommand() *command {
+	cmd := newCommand("check", "", "Check that generated stubs are up to date, without writing anything")
+	targetFlags := addTargetFlags(cmd.flags)
+	cmd.targets = targetFlags
+	cmd.run = func(args []string) error {
+		targets, err := targetFlags.targets("")
+		if err != nil {
+			return err
+		}
+		failed := false
+		var checked []*Options
+		for _, opts := range targets {
+			if opts.Target == stdio {
+				report(fmt.Errorf("%s: stubs written to stdout can't be checked", opts.Source))
+				failed = true
+				continue
+			}
+			checked = append(checked, opts)
+		}
+		// check reports file if it differs from the file at its path, which
+		// source generates.
+		check := func(file *File, source string) {
+			existing, err := ioutil.ReadFile(file.Path)
+			if err != nil && !os.IsNotExist(err) {
+				report(err)
+				failed = true
+			} else if !bytes.Equal(existing, file.Content) {
+				if hash := sourceHash(existing); hash != "" && hash == sourceHash(file.Content) {
+					report(fileError(file.Path, CodeModified, "differs from what %s generates, but not in its source hash: it was edited by hand, or generated with other options or another go-rpcgen version", source))
+				} else {
+					report(fileError(file.Path, CodeOutOfDate, "out of date with %s", source))
+				}
+				failed = true
+			}
+		}
+		results := renderAll(checked, *targetFlags.jobs)
+		for i, r := range results {
+			for _, warning := range r.warnings {
+				report(warning)
+			}
+			if r.err != nil {
+				report(r.err)
+				failed = true
+				continue
+			}
+			for _, file := range r.files {
+				check(file, checked[i].Source)
+			}
+		}
+		clients, err := combinedClients(checked, results)
+		if err != nil {
+			report(err)
+			failed = true
+		}
+		for _, c := range clients {
+			check(c.file, strings.Join(c.sources, ", "))
+		}
+		if failed {
+			return errFailed
+		}
+		return nil
+	}
+	return cmd
+}
+
+func listCommand() *command {
+	cmd := newCommand("list", "[packages]", "List the interfaces found in packages and whether stubs can be generated for them")
+	addDiagnosticsFlag(cmd.flags)
+	addVerbosityFlags(cmd.flags)
+	tags := cmd.flags.String("tags", "", "comma-separated build tags to consider satisfied, in addition to GOOS, GOARCH and -tags in GOFLAGS")
+	tests := cmd.flags.Bool("test", false, "include interfaces declared in test files")
+	cmd.run = func(args []string) error {
+		files, err := expandPatterns(args, buildContext(*tags), *tests)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			fileset := token.NewFileSet()
+			f, err := parser.ParseFile(fileset, file, nil, 0)
+			if err != nil {
+				report(err)
+				continue
+			}
+			for _, spec := range interfaceSpecs(f) {
+				gen := &RPCGen{Type: spec.Name.Name, fileset: fileset}
+				ast.Walk(gen, f)
+				pos := fileset.Position(spec.Pos())
+				if len(gen.errs) == 0 {
+					fmt.Printf("%s: %s: eligible (%s)\n", pos, spec.Name.Name, plural(len(gen.Methods), "method"))
+					for _, warning := range gobWarnings(file, spec.Name.Name) {
+						fmt.Printf("\twarning: %s\n", warning)
+					}
+					continue
+				}
+				fmt.Printf("%s: %s: not eligible\n", pos, spec.Name.Name)
+				for _, err := range gen.errs {
+					fmt.Printf("\t%s\n", err)
+				}
+			}
+		}
+		return nil
+	}
+	return cmd
+}
+
+// interfaceSpecs returns the interface type declarations in f.
+func interfaceSpecs(f *ast.File) []*ast.TypeSpec {
+	var specs []*ast.TypeSpec
+	for _, decl := range f.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok {
+			for _, spec := range gen.Specs {
+				if spec, ok := spec.(*ast.TypeSpec); ok {
+					if _, ok := spec.Type.(*ast.InterfaceType); ok {
+						specs = append(specs, spec)
+					}
+				}
+			}
+		}
+	}
+	return specs
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func cleanCommand() *command {
+	cmd := newCommand("clean", "[packages]", "Remove files generated by go-rpcgen from packages")
+	dryRun := cmd.flags.Bool("n", false, "only list the generated files, don't remove them")
+	addDiagnosticsFlag(cmd.flags)
+	addVerbosityFlags(cmd.flags)
+	cmd.run = func(args []string) error {
+		// Generated files are removed whatever their build constraints, and
+		// stubs for test interfaces are test files.
+		files, err := expandPatterns(args, nil, true)
+		if err != nil {
+			return err
+		}
+		failed := false
+		remove := func(file string) bool {
+			if !*dryRun {
+				if err := os.Remove(file); err != nil {
+					report(err)
+					failed = true
+					return false
+				}
+			}
+			if *dryRun || verbosity >= verbosityNormal {
+				fmt.Println(file)
+			}
+			return true
+		}
+		for _, file := range files {
+			generated, err := isGenerated(file)
+			if err != nil {
+				report(err)
+				failed = true
+				continue
+			}
+			if !generated {
+				continue
+			}
+			src, err := ioutil.ReadFile(file)
+			if err != nil {
+				report(err)
+				failed = true
+				continue
+			}
+			if !remove(file) {
+				continue
+			}
+			// The schema files written with the stubs are listed in their
+			// header, since JSON files can't be marked as generated.
+			for _, name := range sideFiles(src) {
+				side := filepath.Join(filepath.Dir(file), name)
+				if _, err := os.Stat(side); os.IsNotExist(err) {
+					continue
+				}
+				remove(side)
+			}
+		}
+		if failed {
+			return errFailed
+		}
+		return nil
+	}
+	return cmd
+}
+
+// sourceHashPrefix starts the header comment recording the source hash of a
+// generated file.
+const sourceHashPrefix = "// Source hash: "
+
+// sourceHash returns the source hash recorded in the header of a generated
+// file, or "" if there is none.
+func sourceHash(src []byte) string {
+	for _, line := range strings.Split(string(src), "\n") {
+		if strings.HasPrefix(line, sourceHashPrefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, sourceHashPrefix))
+		}
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+	}
+	return ""
+}
+
+// sideFilesPrefix starts the header comment listing the schema files
+// generated with a file.
+const sideFilesPrefix = "// Side files:"
+
+// sideFiles returns the names of the schema files listed in the header of a
+// generated file. Names that aren't plain file names are left out, so that
+// clean only removes files next to the generated one.
+func sideFiles(src []byte) []string {
+	var names []string
+	for _, line := range strings.Split(string(src), "\n") {
+		if strings.HasPrefix(line, sideFilesPrefix) {
+			for _, name := range strings.Fields(strings.TrimPrefix(line, sideFilesPrefix)) {
+				if name == filepath.Base(name) && name != "." && name != ".." {
+					names = append(names, name)
+				}
+			}
+		}
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+	}
+	return names
+}
+
+// isGenerated reports whether the file at path was generated by go-rpcgen,
+// according to the comments before its package clause.
+func isGenerated(path string) (bool, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		if _, ok := err.(scanner.ErrorList); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, group := range f.Comments {
+		if group.Pos() > f.Package {
+			break
+		}
+		for _, c := range group.List {
+			if strings.HasPrefix(c.Text, "//") && (strings.Contains(c.Text, generatedMarker) || strings.Contains(c.Text, legacyGeneratedMarker)) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func versionCommand() *command {
+	cmd := newCommand("version", "", "Print the go-rpcgen version")
+	cmd.run = func(args []string) error {
+		fmt.Printf("go-rpcgen version %s\n", versionString())
+		return nil
+	}
+	return cmd
+}
+
+func versionString() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "devel"
+}
+
+func helpCommand() *command {
+	cmd := newCommand("help", "[command]", "Show help for go-rpcgen or one of its commands")
+	cmd.run = func(args []string) error {
+		if len(args) == 0 {
+			printUsage()
+			return nil
+		}
+		other := findCommand(args[0])
+		if other == nil {
+			return fmt.Errorf("unknown command %q", args[0])
+		}
+		other.flags.Usage()
+		return nil
+	}
+	return cmd
+}
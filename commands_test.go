@@ -0,0 +1,140 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args       string
+		typ        string
+		force      bool
+		positional []string
+	}{
+		{"", "", false, nil},
+		{"--type=Arith old.go new.go", "Arith", false, []string{"old.go", "new.go"}},
+		{"old.go new.go --type=Arith", "Arith", false, []string{"old.go", "new.go"}},
+		{"old.go --type Arith new.go --force", "Arith", true, []string{"old.go", "new.go"}},
+		{"old.go -- --type=Arith new.go", "", false, []string{"old.go", "--type=Arith", "new.go"}},
+		{"--force -- -old.go", "", true, []string{"-old.go"}},
+	}
+	for _, test := range tests {
+		t.Run(test.args, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(ioutil.Discard)
+			typ := fs.String("type", "", "")
+			force := fs.Bool("force", false, "")
+			positional, err := parseArgs(fs, strings.Fields(test.args))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *typ != test.typ || *force != test.force || !reflect.DeepEqual(positional, test.positional) {
+				t.Errorf("got %q %v %q, want %q %v %q", *typ, *force, positional, test.typ, test.force, test.positional)
+			}
+		})
+	}
+}
+
+func TestParseArgsError(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	if _, err := parseArgs(fs, []string{"old.go", "--unknown"}); err == nil {
+		t.Error("an unknown flag after a positional argument was accepted")
+	}
+}
+
+func TestSideFiles(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"// Code generated by go-rpcgen. DO NOT EDIT.\n\npackage store\n", nil},
+		{"// Source hash: sha256:00\n// Side files: store.rpc.json store.thrift\n\npackage store\n", []string{"store.rpc.json", "store.thrift"}},
+		{"// Side files: ../store.thrift /etc/passwd .. store.avsc\n\npackage store\n", []string{"store.avsc"}},
+		{"package store\n\n// Side files: store.thrift\n", nil},
+	}
+	for _, test := range tests {
+		if got := sideFiles([]byte(test.src)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("sideFiles(%q) = %q, want %q", test.src, got, test.want)
+		}
+	}
+}
+
+func TestCleanSideFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"store.go":          "package store\n",
+		"storerpc.gen.go":   "// Code generated by go-rpcgen. DO NOT EDIT.\n// Side files: store.rpc.json store.thrift store.avsc\n\npackage store\n",
+		"store.rpc.json":    "{}\n",
+		"store.thrift":      "// Code generated by go-rpcgen. DO NOT EDIT.\n",
+		"other.thrift":      "namespace go store\n",
+		"other_handwritten": "",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := verbosity
+	verbosity = verbosityQuiet
+	defer func() { verbosity = saved }()
+	if err := cleanCommand().run([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, info := range infos {
+		left = append(left, info.Name())
+	}
+	want := []string{"other.thrift", "other_handwritten", "store.go"}
+	if !reflect.DeepEqual(left, want) {
+		t.Errorf("clean left %q, want %q", left, want)
+	}
+}
+
+func TestIsGenerated(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"// Code generated by go-rpcgen. DO NOT EDIT.\n\npackage store\n", true},
+		{"// Generated by go-rpcgen\n\npackage store\n", true},
+		{"// Copyright 2018\n\n// Code generated by go-rpcgen. DO NOT EDIT.\n\npackage store\n", true},
+		{"package store\n\n// Code generated by go-rpcgen. DO NOT EDIT.\n", false},
+		{"/* Code generated by go-rpcgen. DO NOT EDIT. */\n\npackage store\n", false},
+		{"// Code generated by stringer. DO NOT EDIT.\n\npackage store\n", false},
+		{"package store\n", false},
+		{"not Go at all", false},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "file.go")
+		if err := ioutil.WriteFile(path, []byte(test.src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := isGenerated(path); err != nil || got != test.want {
+			t.Errorf("isGenerated(%q) = %v, %v, want %v", test.src, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+func compatCommand() *command {
+	cmd := newCommand("compat", "old.go new.go", "Report changes of an interface breaking stubs generated from its old version")
+	rpcType := cmd.flags.String("type", "", "interface to compare")
+	addDiagnosticsFlag(cmd.flags)
+	addVerbosityFlags(cmd.flags)
+	cmd.run = func(args []string) error {
+		if len(args) != 2 || *rpcType == "" {
+			return errors.New("expected --type, and the old and new source files")
+		}
+		var versions [2]*interfaceVersion
+		for i, source := range args {
+			opts := &Options{Source: source, Type: *rpcType}
+			opts.setDefaults()
+			gen, f, err := parse(opts)
+			if err != nil {
+				return err
+			}
+			versions[i] = &interfaceVersion{gen: gen, f: f}
+		}
+		failed := false
+		for _, problem := range compat(versions[0], versions[1]) {
+			report(problem)
+			failed = failed || problem.Severity == SeverityError
+		}
+		if failed {
+			return errFailed
+		}
+		return nil
+	}
+	return cmd
+}
+
+// interfaceVersion is an interface as declared in one version of its source.
+type interfaceVersion struct {
+	gen *RPCGen
+	f   *ast.File
+}
+
+func (v *interfaceVersion) method(name string) *Method {
+	for _, m := range v.gen.Methods {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// position returns the position of the method name, or of the interface if
+// the method is not declared in the file.
+func (v *interfaceVersion) position(name string) token.Position {
+	var pos token.Pos
+	for _, spec := range interfaceSpecs(v.f) {
+		if spec.Name.Name == v.gen.Interface {
+			pos = spec.Pos()
+			if field := findMethod(spec.Type.(*ast.InterfaceType), name); field != nil {
+				pos = field.Pos()
+			}
+		}
+	}
+	return v.gen.fileset.Position(pos)
+}
+
+// findMethod returns the declaration of the method name in t, or in the
+// interfaces it embeds from the same file.
+func findMethod(t *ast.InterfaceType, name string) *ast.Field {
+	for _, m := range t.Methods.List {
+		switch e := m.Type.(type) {
+		case *ast.FuncType:
+			if m.Names[0].Name == name {
+				return m
+			}
+		case *ast.Ident:
+			if e.Obj == nil {
+				continue
+			}
+			if spec, ok := e.Obj.Decl.(*ast.TypeSpec); ok {
+				if embedded, ok := spec.Type.(*ast.InterfaceType); ok {
+					if field := findMethod(embedded, name); field != nil {
+						return field
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// compat compares two versions of an interface as net/rpc and gob see them:
+// methods by name, and parameters and results as the fields of the request
+// and response structures, which gob matches by name. Changes that make
+// stubs generated from the versions fail to work together, or change the
+// signature of client methods, are errors; changes gob silently tolerates
+// are warnings.
+func compat(before, after *interfaceVersion) []*Diagnostic {
+	var problems []*Diagnostic
+	add := func(severity string, pos token.Position, method string, format string, args ...interface{}) {
+		problems = append(problems, &Diagnostic{
+			Pos:      pos,
+			Severity: severity,
+			Code:     CodeIncompatible,
+			Message:  fmt.Sprintf(format, args...),
+			Hint:     fmt.Sprintf("keep %s as it is and add a method with a new name, such as %sV2, until all peers use stubs generated from the new interface", method, method),
+		})
+	}
+	for _, oldMethod := range before.gen.Methods {
+		newMethod := after.method(oldMethod.Name)
+		if newMethod == nil {
+			add(SeverityError, before.position(oldMethod.Name), oldMethod.Name, "method %s was removed", oldMethod.Name)
+			continue
+		}
+		pos := after.position(newMethod.Name)
+		if oldMethod.Job && !newMethod.Job {
+			add(SeverityError, pos, newMethod.Name, "method %s is no longer a job, which removes its job methods", newMethod.Name)
+		}
+		for _, kind := range []struct {
+			name     string
+			old, new []*Type
+			added    string
+			removed  string
+		}{
+			{"parameter", oldMethod.Parameters, newMethod.Parameters, "old clients send its zero value", "the values old clients send are ignored"},
+			{"result", oldMethod.Results, newMethod.Results, "old clients ignore it", "old clients get its zero value"},
+		} {
+			oldFields, newFields := wireFields(kind.old), wireFields(kind.new)
+			var oldOrder, newOrder []string
+			for _, field := range oldFields {
+				newField, ok := findField(newFields, field.name)
+				switch {
+				case !ok:
+					add(SeverityWarning, pos, newMethod.Name, "%s %s of %s was removed; %s", kind.name, field.name, newMethod.Name, kind.removed)
+				case newField.typ != field.typ:
+					add(SeverityError, pos, newMethod.Name, "type of %s %s of %s changed from %s to %s", kind.name, field.name, newMethod.Name, field.typ, newField.typ)
+				default:
+					if newField.unix != field.unix {
+						add(SeverityError, pos, newMethod.Name, "%s %s of %s is now sent as %s rather than %s", kind.name, field.name, newMethod.Name, timeEncoding(newField.unix), timeEncoding(field.unix))
+					} else if newField.wire != field.wire {
+						add(SeverityError, pos, newMethod.Name, "%s %s of %s is now sent as %s rather than %s", kind.name, field.name, newMethod.Name, newField.sentAs(), field.sentAs())
+					}
+					if oldID, newID := thriftID(field.lowerName, oldMethod.FieldIDs), thriftID(newField.lowerName, newMethod.FieldIDs); oldID != newID {
+						add(SeverityError, pos, newMethod.Name, "%s %s of %s is now Thrift field %d rather than %d", kind.name, field.name, newMethod.Name, newID, oldID)
+						problems[len(problems)-1].Hint = fmt.Sprintf("give %s its former ID back with //rpcgen:field %s %d", newField.lowerName, newField.lowerName, oldID)
+					}
+					oldOrder = append(oldOrder, field.name)
+				}
+			}
+			for _, field := range newFields {
+				if _, ok := fieldType(oldFields, field.name); !ok {
+					add(SeverityWarning, pos, newMethod.Name, "%s %s of %s was added; %s", kind.name, field.name, newMethod.Name, kind.added)
+				} else if typ, _ := fieldType(oldFields, field.name); typ == field.typ {
+					newOrder = append(newOrder, field.name)
+				}
+			}
+			for i := range oldOrder {
+				if oldOrder[i] != newOrder[i] {
+					add(SeverityError, pos, newMethod.Name, "%ss of %s were reordered, changing the signature of the client method", kind.name, newMethod.Name)
+					break
+				}
+			}
+		}
+	}
+	problems = append(problems, compatStructs(before, after)...)
+	return problems
+}
+
+// compatStructs reports the fields of the struct types declared in both
+// versions of the source whose Thrift field ID changed, as given by the
+// //rpcgen:field directive.
+func compatStructs(before, after *interfaceVersion) []*Diagnostic {
+	var problems []*Diagnostic
+	oldDecls, newDecls := typeDecls(before.f), typeDecls(after.f)
+	var names []string
+	for name := range newDecls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		newStruct, ok := newDecls[name].Type.(*ast.StructType)
+		if !ok || oldDecls[name] == nil {
+			continue
+		}
+		oldStruct, ok := oldDecls[name].Type.(*ast.StructType)
+		if !ok {
+			continue
+		}
+		oldIDs, err := structFieldIDs(before.gen.fileset, oldStruct)
+		if err != nil {
+			continue
+		}
+		newIDs, err := structFieldIDs(after.gen.fileset, newStruct)
+		if err != nil {
+			continue
+		}
+		for _, field := range newStruct.Fields.List {
+			for _, n := range field.Names {
+				if !n.IsExported() || !hasField(oldStruct, n.Name) {
+					continue
+				}
+				if oldID, newID := thriftID(n.Name, oldIDs), thriftID(n.Name, newIDs); oldID != newID {
+					problems = append(problems, &Diagnostic{
+						Pos:      after.gen.fileset.Position(n.Pos()),
+						Severity: SeverityError,
+						Code:     CodeIncompatible,
+						Message:  fmt.Sprintf("field %s of %s is now Thrift field %d rather than %d", n.Name, name, newID, oldID),
+						Hint:     fmt.Sprintf("give %s its former ID back with //rpcgen:field %d", n.Name, oldID),
+					})
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// hasField reports whether st has a field name.
+func hasField(st *ast.StructType, name string) bool {
+	for _, field := range st.Fields.List {
+		for _, n := range field.Names {
+			if n.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wireField is a field of a request or response structure, with the unit of
+// the Unix time it is sent as, if any, and the type it is sent as if its
+// type is mapped to another.
+type wireField struct {
+	name      string
+	lowerName string
+	typ       string
+	unix      string
+	wire      string
+}
+
+func wireFields(types []*Type) []wireField {
+	var fields []wireField
+	for _, t := range types {
+		wire := ""
+		if t.Mapping != nil {
+			wire = t.Mapping.Type
+		}
+		for i, name := range t.Names {
+			fields = append(fields, wireField{name, t.LowerNames[i], t.Type, t.Unix, wire})
+		}
+	}
+	return fields
+}
+
+func fieldType(fields []wireField, name string) (string, bool) {
+	if field, ok := findField(fields, name); ok {
+		return field.typ, true
+	}
+	return "", false
+}
+
+func findField(fields []wireField, name string) (wireField, bool) {
+	for _, field := range fields {
+		if field.name == name {
+			return field, true
+		}
+	}
+	return wireField{}, false
+}
+
+// sentAs returns the type the field is sent as.
+func (f wireField) sentAs() string {
+	if f.wire == "" {
+		return f.typ
+	}
+	return f.wire
+}
+
+// timeEncoding describes how a time.Time field with the Unix unit unix is
+// sent.
+func timeEncoding(unix string) string {
+	if unix == "" {
+		return "time.Time"
+	}
+	return "Unix time in " + unix
+}
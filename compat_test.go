@@ -0,0 +1,126 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// compatProblems compares the interfaces I of the source files old and new
+// as compat does.
+func compatProblems(t *testing.T, old, new string) []*Diagnostic {
+	t.Helper()
+	dir := t.TempDir()
+	var versions [2]*interfaceVersion
+	for i, src := range []string{old, new} {
+		opts := &Options{Source: filepath.Join(dir, []string{"old.go", "new.go"}[i]), Type: "I"}
+		if err := ioutil.WriteFile(opts.Source, []byte("package p\n\n"+src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		opts.setDefaults()
+		gen, f, err := parse(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions[i] = &interfaceVersion{gen: gen, f: f}
+	}
+	return compat(versions[0], versions[1])
+}
+
+func TestCompat(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		// problems are the severities and messages of the problems.
+		problems []string
+	}{
+		{
+			name: "same",
+			old:  "type I interface{ Add(a, b int) (sum int, err error) }",
+			new:  "type I interface{ Add(a, b int) (sum int, err error) }",
+		},
+		{
+			name:     "removed method",
+			old:      "type I interface {\n\tAdd(a, b int) (sum int, err error)\n\tSub(a, b int) (d int, err error)\n}",
+			new:      "type I interface{ Add(a, b int) (sum int, err error) }",
+			problems: []string{"error: method Sub was removed"},
+		},
+		{
+			name:     "changed type",
+			old:      "type I interface{ Mul(a, b int) (p int, err error) }",
+			new:      "type I interface{ Mul(a, b int64) (p int, err error) }",
+			problems: []string{"error: type of parameter A of Mul changed from int to int64", "error: type of parameter B of Mul changed from int to int64"},
+		},
+		{
+			name:     "added parameter",
+			old:      "type I interface{ Add(a, b int) (sum int, err error) }",
+			new:      "type I interface{ Add(a, b, c int) (sum int, err error) }",
+			problems: []string{"warning: parameter C of Add was added; old clients send its zero value"},
+		},
+		{
+			name:     "reordered",
+			old:      "type I interface{ Div(a, b int) (q int, err error) }",
+			new:      "type I interface{ Div(b, a int) (q int, err error) }",
+			problems: []string{"error: parameters of Div were reordered, changing the signature of the client method"},
+		},
+		{
+			name:     "renumbered",
+			old:      "type I interface {\n\t//rpcgen:field a 3\n\tAdd(a, b int) (sum int, err error)\n}",
+			new:      "type I interface{ Add(a, b int) (sum int, err error) }",
+			problems: []string{"error: parameter A of Add is now Thrift field 29000 rather than 3"},
+		},
+		{
+			name: "numbered as before",
+			old:  "type I interface{ Add(a, b int) (sum int, err error) }",
+			new:  "type I interface {\n\t//rpcgen:field a 29000\n\tAdd(a, b int) (sum int, err error)\n}",
+		},
+		{
+			name:     "struct renumbered",
+			old:      "type S struct {\n\tX int //rpcgen:field 1\n\tY int\n}\ntype I interface{ Put(s S) (err error) }",
+			new:      "type S struct {\n\tX int //rpcgen:field 2\n\tY int\n}\ntype I interface{ Put(s S) (err error) }",
+			problems: []string{"error: field X of S is now Thrift field 2 rather than 1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems := compatProblems(t, test.old, test.new)
+			var got []string
+			for _, p := range problems {
+				got = append(got, p.Severity+": "+p.Message)
+			}
+			if strings.Join(got, "\n") != strings.Join(test.problems, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.problems, "\n"))
+			}
+		})
+	}
+}
+
+// TestCompatHint checks that the hint names the method that changed.
+func TestCompatHint(t *testing.T) {
+	problems := compatProblems(t,
+		"type I interface{ Mul(a, b int) (p int, err error) }",
+		"type I interface{ Mul(a, b int64) (p int, err error) }")
+	if len(problems) == 0 {
+		t.Fatal("no problem reported")
+	}
+	for _, p := range problems {
+		if !strings.Contains(p.Hint, "keep Mul as it is") || !strings.Contains(p.Hint, "MulV2") {
+			t.Errorf("hint %q doesn't name Mul", p.Hint)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Shells the completion command writes scripts for.
+const (
+	ShellBash = "bash"
+	ShellZsh  = "zsh"
+	ShellFish = "fish"
+)
+
+// flagChoices are the values of the flags taking one of a few.
+var flagChoices = map[string][]string{
+	"mode":        {ModeBoth, ModeClient, ModeServer},
+	"format":      {FormatGofmt, FormatGofumpt},
+	"json-naming": {JSONNamingAsIs, JSONNamingSnake, JSONNamingCamel},
+	"diagnostics": {DiagnosticsText, DiagnosticsJSON},
+}
+
+// pathFlags are the flags taking a path, completed with file names, or
+// directory names for those set to true.
+var pathFlags = map[string]bool{
+	"source":         false,
+	"target":         false,
+	"config":         false,
+	"template":       false,
+	"header-file":    false,
+	"plugin":         false,
+	"client-package": true,
+	"server-package": true,
+	"output-dir":     true,
+	"template-dir":   true,
+}
+
+func completionCommand() *command {
+	cmd := newCommand("completion", "bash|zsh|fish", "Print a shell script completing go-rpcgen commands and flags")
+	cmd.run = func(args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("expected a shell: %s, %s or %s", ShellBash, ShellZsh, ShellFish)
+		}
+		switch args[0] {
+		case ShellBash:
+			bashCompletion(os.Stdout)
+		case ShellZsh:
+			// zsh runs the bash completion through its emulation.
+			fmt.Fprintf(os.Stdout, "autoload -U +X compinit && compinit\nautoload -U +X bashcompinit && bashcompinit\n\n")
+			bashCompletion(os.Stdout)
+		case ShellFish:
+			fishCompletion(os.Stdout)
+		default:
+			return fmt.Errorf("unknown shell %q, expected %s, %s or %s", args[0], ShellBash, ShellZsh, ShellFish)
+		}
+		return nil
+	}
+	return cmd
+}
+
+// completedFlag is a flag of a command, as completion scripts describe it.
+type completedFlag struct {
+	name  string
+	usage string
+	// value reports whether the flag takes a value, unlike boolean flags.
+	value bool
+}
+
+// commandFlags returns the flags of cmd in order.
+func commandFlags(cmd *command) []completedFlag {
+	var flags []completedFlag
+	cmd.flags.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completedFlag{f.Name, f.Usage, !ok || !b.IsBoolFlag()})
+	})
+	return flags
+}
+
+// commandArgs returns the words completing the arguments of the command
+// name, or nil if they are file names.
+func commandArgs(name string) []string {
+	switch name {
+	case "help":
+		var names []string
+		for _, cmd := range commands {
+			names = append(names, cmd.name)
+		}
+		return names
+	case "completion":
+		return []string{ShellBash, ShellZsh, ShellFish}
+	case "version":
+		return []string{}
+	}
+	return nil
+}
+
+// bashCompletion writes the bash completion script to w. Words after the
+// command are completed with its flags, the values of the flag before them,
+// or its arguments. Without a command, generate is assumed, as when running
+// go-rpcgen.
+func bashCompletion(w io.Writer) {
+	var names []string
+	valueFlags := map[string]bool{}
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+		for _, f := range commandFlags(cmd) {
+			if f.value {
+				valueFlags[f.name] = true
+			}
+		}
+	}
+	fmt.Fprintf(w, "# bash completion for go-rpcgen, written by go-rpcgen completion bash.\n")
+	fmt.Fprintf(w, "_go_rpcgen() {\n")
+	fmt.Fprintf(w, "\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\" cmd=generate words=\n")
+	fmt.Fprintf(w, "\tcase \"${COMP_WORDS[1]}\" in\n\t%s) cmd=\"${COMP_WORDS[1]}\" ;;\n\tesac\n", strings.Join(names, "|"))
+	fmt.Fprintf(w, "\tif [ \"$COMP_CWORD\" -eq 1 ] && [[ \"$cur\" != -* ]]; then\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n\t\treturn\n\tfi\n", strings.Join(names, " "))
+	fmt.Fprintf(w, "\tcase \"$prev\" in\n")
+	for _, name := range sortedFlagNames(valueFlags) {
+		fmt.Fprintf(w, "\t-%s|--%s)\n", name, name)
+		choices, ok := flagChoices[name]
+		dir, isPath := pathFlags[name]
+		switch {
+		case ok:
+			fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(choices, " "))
+		case isPath && dir:
+			fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -d -- \"$cur\"))\n")
+		case isPath:
+			fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n")
+		default:
+			fmt.Fprintf(w, "\t\tCOMPREPLY=()\n")
+		}
+		fmt.Fprintf(w, "\t\treturn\n\t\t;;\n")
+	}
+	fmt.Fprintf(w, "\tesac\n")
+	fmt.Fprintf(w, "\tcase \"$cmd\" in\n")
+	for _, cmd := range commands {
+		var flags []string
+		for _, f := range commandFlags(cmd) {
+			flags = append(flags, "--"+f.name)
+		}
+		fmt.Fprintf(w, "\t%s)\n\t\tflags=%q\n", cmd.name, strings.Join(flags, " "))
+		if args := commandArgs(cmd.name); args != nil {
+			fmt.Fprintf(w, "\t\twords=%q\n", strings.Join(args, " "))
+		}
+		fmt.Fprintf(w, "\t\t;;\n")
+	}
+	fmt.Fprintf(w, "\tesac\n")
+	fmt.Fprintf(w, "\tif [[ \"$cur\" == -* ]]; then\n\t\tCOMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "\telif [ -n \"$words\" ] || [ \"$cmd\" = version ]; then\n\t\tCOMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "\telse\n\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n\tfi\n}\n")
+	fmt.Fprintf(w, "complete -o filenames -F _go_rpcgen go-rpcgen\n")
+}
+
+// fishCompletion writes the fish completion script to w, describing each
+// command and flag with its summary or usage.
+func fishCompletion(w io.Writer) {
+	fmt.Fprintf(w, "# fish completion for go-rpcgen, written by go-rpcgen completion fish.\n")
+	fmt.Fprintf(w, "complete -c go-rpcgen -f\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "complete -c go-rpcgen -n __fish_use_subcommand -a %s -d %s\n", cmd.name, fishQuote(cmd.summary))
+	}
+	for _, cmd := range commands {
+		condition := "__fish_seen_subcommand_from " + cmd.name
+		if cmd.name == "generate" {
+			condition += "; or __fish_use_subcommand"
+		}
+		for _, f := range commandFlags(cmd) {
+			line := fmt.Sprintf("complete -c go-rpcgen -n %s -l %s", fishQuote(condition), f.name)
+			if f.value {
+				choices, ok := flagChoices[f.name]
+				dir, isPath := pathFlags[f.name]
+				switch {
+				case ok:
+					line += " -x -a " + fishQuote(strings.Join(choices, " "))
+				case isPath && dir:
+					line += " -x -a '(__fish_complete_directories)'"
+				case isPath:
+					line += " -r -F"
+				default:
+					line += " -x"
+				}
+			}
+			fmt.Fprintf(w, "%s -d %s\n", line, fishQuote(f.usage))
+		}
+		switch args := commandArgs(cmd.name); {
+		case args == nil:
+			fmt.Fprintf(w, "complete -c go-rpcgen -n %s -F\n", fishQuote(condition))
+		case len(args) > 0:
+			fmt.Fprintf(w, "complete -c go-rpcgen -n %s -a %s\n", fishQuote(condition), fishQuote(strings.Join(args, " ")))
+		}
+	}
+}
+
+// fishQuote quotes s as a single-quoted fish string.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func sortedFlagNames(flags map[string]bool) []string {
+	var names []string
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,292 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const defaultConfigFile = "rpcgen.yaml"
+
+// Config is the contents of an rpcgen.yaml file. It lists every interface to
+// generate stubs for, so that a single invocation keeps all of them current:
+//
+//	defaults:
+//	  imports: [net/rpc]
+//	services:
+//	  - source: arith/arith.go
+//	    type: Arith
+//	  - source: store/store.go
+//	    type: Store
+//	    service: KV
+//	    target: store/kvrpc.go
+//
+// Relative paths are resolved against the directory containing the file.
+type Config struct {
+	// Defaults apply to every service that doesn't set the option itself.
+	Defaults Options   `yaml:"defaults"`
+	Services []Options `yaml:"services"`
+
+	dir string
+}
+
+// loadConfig reads and validates the config file at path.
+func loadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{dir: filepath.Dir(path)}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, yamlError(path, err)
+	}
+	if len(config.Services) == 0 {
+		return nil, fileError(path, CodeConfig, "no services listed")
+	}
+	for i, service := range config.Services {
+		if service.Source == "" || service.Type == "" {
+			return nil, fileError(path, CodeConfig, "service %d: expected source and type", i+1)
+		}
+	}
+	return config, nil
+}
+
+// yamlLinePattern matches the line number yaml errors are located with.
+var yamlLinePattern = regexp.MustCompile(`line (\d+): (.*)`)
+
+// yamlError returns an error parsing the config file at path as a
+// diagnostic located at the first line the error mentions.
+func yamlError(path string, err error) error {
+	m := yamlLinePattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return fileError(path, CodeConfig, "%s", err)
+	}
+	line, _ := strconv.Atoi(m[1])
+	return posError(token.Position{Filename: path, Line: line}, CodeConfig, "%s", m[2])
+}
+
+// Targets returns the options for each service with defaults applied and
+// paths made relative to the working directory.
+func (c *Config) Targets() []*Options {
+	var targets []*Options
+	for _, service := range c.Services {
+		opts := service
+		opts.merge(&c.Defaults)
+		opts.resolvePaths(c.path)
+		targets = append(targets, &opts)
+	}
+	return targets
+}
+
+func (c *Config) path(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.dir, path)
+}
+
+// resolvePaths replaces the paths in o, other than stdin and stdout, with the
+// result of calling path on them.
+func (o *Options) resolvePaths(resolve func(string) string) {
+	path := func(p string) string {
+		if p == stdio {
+			return p
+		}
+		return resolve(p)
+	}
+	o.Source = path(o.Source)
+	for _, p := range []*string{&o.Target, &o.ClientPackage, &o.ServerPackage, &o.OutputDir, &o.Template, &o.TemplateDir, &o.HeaderFile} {
+		if *p != "" {
+			*p = path(*p)
+		}
+	}
+	if strings.ContainsRune(o.Plugin, filepath.Separator) {
+		o.Plugin = path(o.Plugin)
+	}
+}
+
+// UnmarshalYAML decodes the options of a service, or the defaults, and
+// records the keys they set, so that merge can tell an option set to false
+// from one left out.
+func (o *Options) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Options
+	if err := unmarshal((*plain)(o)); err != nil {
+		return err
+	}
+	var keys map[string]interface{}
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	o.set = map[string]bool{}
+	for key := range keys {
+		o.set[key] = true
+	}
+	return nil
+}
+
+// merge fills options left unset in o from defaults. Boolean options the
+// config file sets, even to false, are kept.
+func (o *Options) merge(defaults *Options) {
+	if o.Imports == nil {
+		o.Imports = defaults.Imports
+	}
+	if o.Package == "" {
+		o.Package = defaults.Package
+	}
+	if o.RPCClientType == "" {
+		o.RPCClientType = defaults.RPCClientType
+	}
+	if o.Mode == "" {
+		o.Mode = defaults.Mode
+	}
+	if !o.set["split"] {
+		o.Split = defaults.Split
+	}
+	if o.OutputDir == "" {
+		o.OutputDir = defaults.OutputDir
+	}
+	if o.Suffix == "" {
+		o.Suffix = defaults.Suffix
+	}
+	if o.Template == "" {
+		o.Template = defaults.Template
+	}
+	if o.TemplateDir == "" {
+		o.TemplateDir = defaults.TemplateDir
+	}
+	if o.BuildTags == "" {
+		o.BuildTags = defaults.BuildTags
+	}
+	if o.HeaderFile == "" {
+		o.HeaderFile = defaults.HeaderFile
+	}
+	if o.Format == "" {
+		o.Format = defaults.Format
+	}
+	if o.Plugin == "" {
+		o.Plugin = defaults.Plugin
+	}
+	if o.ClientClose == "" {
+		o.ClientClose = defaults.ClientClose
+	}
+	if !o.set["pool"] {
+		o.Pool = defaults.Pool
+	}
+	if !o.set["binary_codec"] {
+		o.BinaryCodec = defaults.BinaryCodec
+	}
+	if !o.set["msgp"] {
+		o.Msgp = defaults.Msgp
+	}
+	if !o.set["easyjson"] {
+		o.Easyjson = defaults.Easyjson
+	}
+	if !o.set["bench"] {
+		o.Bench = defaults.Bench
+	}
+	if !o.set["dispatch"] {
+		o.Dispatch = defaults.Dispatch
+	}
+	if o.JobTTL == 0 {
+		o.JobTTL = defaults.JobTTL
+	}
+	if o.MaxJobs == 0 {
+		o.MaxJobs = defaults.MaxJobs
+	}
+	if !o.set["expvar"] {
+		o.Expvar = defaults.Expvar
+	}
+	if !o.set["pprof_labels"] {
+		o.PprofLabels = defaults.PprofLabels
+	}
+	if !o.set["wire_dump"] {
+		o.WireDump = defaults.WireDump
+	}
+	if !o.set["health"] {
+		o.Health = defaults.Health
+	}
+	if !o.set["runner"] {
+		o.Runner = defaults.Runner
+	}
+	if !o.set["handshake"] {
+		o.Handshake = defaults.Handshake
+	}
+	if !o.set["log_deprecated"] {
+		o.LogDeprecated = defaults.LogDeprecated
+	}
+	if o.ServiceVersion == "" {
+		o.ServiceVersion = defaults.ServiceVersion
+	}
+	if !o.set["manifest"] {
+		o.Manifest = defaults.Manifest
+	}
+	if !o.set["avro"] {
+		o.Avro = defaults.Avro
+	}
+	if !o.set["thrift"] {
+		o.Thrift = defaults.Thrift
+	}
+	if !o.set["ssh"] {
+		o.SSH = defaults.SSH
+	}
+	if !o.set["server_options"] {
+		o.ServerOptions = defaults.ServerOptions
+	}
+	if !o.set["client_options"] {
+		o.ClientOptions = defaults.ClientOptions
+	}
+	if !o.set["stringer"] {
+		o.Stringer = defaults.Stringer
+	}
+	if o.JSONNaming == "" {
+		o.JSONNaming = defaults.JSONNaming
+	}
+	if !o.set["hmac"] {
+		o.HMAC = defaults.HMAC
+	}
+	if !o.set["nacl"] {
+		o.NaCl = defaults.NaCl
+	}
+	if !o.set["transport"] {
+		o.Transport = defaults.Transport
+	}
+	if !o.set["faults"] {
+		o.Faults = defaults.Faults
+	}
+	if o.Combined == "" {
+		o.Combined = defaults.Combined
+	}
+	if !o.set["sort_methods"] {
+		o.SortMethods = defaults.SortMethods
+	}
+	if len(defaults.WireTypes) > 0 {
+		// Services map types of their own on top of the defaults.
+		wireTypes := map[string]*TypeMapping{}
+		for name, m := range defaults.WireTypes {
+			wireTypes[name] = m
+		}
+		for name, m := range o.WireTypes {
+			wireTypes[name] = m
+		}
+		o.WireTypes = wireTypes
+	}
+}
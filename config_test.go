@@ -0,0 +1,133 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes config to a file in a temporary directory and returns
+// its path.
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rpcgen.yaml")
+	if err := ioutil.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigMerge(t *testing.T) {
+	config, err := loadConfig(writeConfig(t, `
+defaults:
+  pool: true
+  health: true
+  mode: client
+services:
+  - source: a.go
+    type: A
+  - source: b.go
+    type: B
+    pool: false
+    mode: server
+  - source: c.go
+    type: C
+    health: false
+    stringer: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		typ      string
+		pool     bool
+		health   bool
+		stringer bool
+		mode     string
+	}{
+		{"A", true, true, false, ModeClient},
+		{"B", false, true, false, ModeServer},
+		{"C", true, false, true, ModeClient},
+	}
+	targets := config.Targets()
+	if len(targets) != len(tests) {
+		t.Fatalf("got %d targets, want %d", len(targets), len(tests))
+	}
+	for i, test := range tests {
+		opts := targets[i]
+		if opts.Type != test.typ {
+			t.Errorf("target %d: got type %s, want %s", i, opts.Type, test.typ)
+		}
+		if opts.Pool != test.pool || opts.Health != test.health || opts.Stringer != test.stringer {
+			t.Errorf("%s: got pool %t, health %t, stringer %t, want %t, %t, %t", test.typ,
+				opts.Pool, opts.Health, opts.Stringer, test.pool, test.health, test.stringer)
+		}
+		if opts.Mode != test.mode {
+			t.Errorf("%s: got mode %s, want %s", test.typ, opts.Mode, test.mode)
+		}
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"services:\n  - source: a.go\n    type: A\n    pools: true\n", "field pools not found"},
+		{"defaults:\n  pool: yes please\nservices:\n  - source: a.go\n    type: A\n", "cannot unmarshal"},
+		{"defaults:\n  pool: true\n", "no services listed"},
+		{"services:\n  - source: a.go\n", "expected source and type"},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			_, err := loadConfig(writeConfig(t, test.config))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"defaults", Options{}, ""},
+		{"mode", Options{Mode: "proxy"}, "invalid mode"},
+		{"build tags", Options{BuildTags: "linux &&"}, "invalid build tags"},
+		{"format", Options{Format: "prettier"}, "invalid format"},
+		{"name", Options{Name: "my-client"}, "invalid name"},
+		{"client close", Options{ClientClose: "close"}, "invalid client close method"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := test.opts
+			opts.Source, opts.Type = "arith.go", "Arith"
+			opts.setDefaults()
+			err := opts.validate()
+			switch {
+			case test.want == "" && err != nil:
+				t.Errorf("got error %v", err)
+			case test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)):
+				t.Errorf("got error %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
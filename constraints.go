@@ -0,0 +1,105 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/build"
+	"go/build/constraint"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// knownOS and knownArch are the GOOS and GOARCH values file names can be
+// constrained with, as in go/build.
+var (
+	knownOS = stringSet("aix android darwin dragonfly freebsd hurd illumos ios js linux nacl netbsd openbsd plan9 solaris wasip1 windows zos")
+
+	knownArch = stringSet("386 amd64 amd64p32 arm armbe arm64 arm64be loong64 mips mipsle mips64 mips64le mips64p32 mips64p32le ppc ppc64 ppc64le riscv riscv64 s390 s390x sparc sparc64 wasm")
+)
+
+func stringSet(s string) map[string]bool {
+	set := map[string]bool{}
+	for _, v := range strings.Fields(s) {
+		set[v] = true
+	}
+	return set
+}
+
+// buildContext returns the build context to match files against: the
+// GOOS and GOARCH of the environment, with the build tags given in GOFLAGS
+// and tags, a comma-separated list.
+func buildContext(tags string) *build.Context {
+	ctxt := build.Default
+	var all []string
+	flags := strings.Fields(os.Getenv("GOFLAGS"))
+	for i, flag := range flags {
+		flag = strings.TrimPrefix(flag, "-")
+		if strings.HasPrefix(flag, "-tags=") || strings.HasPrefix(flag, "tags=") {
+			all = append(all, strings.Split(flag[strings.Index(flag, "=")+1:], ",")...)
+		} else if (flag == "-tags" || flag == "tags") && i+1 < len(flags) {
+			all = append(all, strings.Split(flags[i+1], ",")...)
+		}
+	}
+	if tags != "" {
+		all = append(all, strings.Split(tags, ",")...)
+	}
+	for _, tag := range all {
+		if tag != "" {
+			ctxt.BuildTags = append(ctxt.BuildTags, tag)
+		}
+	}
+	return &ctxt
+}
+
+// sourceConstraint returns the build constraint expression the source file
+// at path, with contents src, is subject to: its //go:build line and the
+// GOOS and GOARCH in its name, if any. Stubs generated from the file need the
+// same constraint to build wherever the interface does.
+func sourceConstraint(path string, src []byte) string {
+	var exprs []string
+	for _, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimSpace(line)
+		if constraint.IsGoBuild(line) {
+			if expr, err := constraint.Parse(line); err == nil {
+				exprs = append(exprs, expr.String())
+			}
+			break
+		}
+		if line != "" && !strings.HasPrefix(line, "//") {
+			break
+		}
+	}
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".go"), "_test")
+	elems := strings.Split(name, "_")
+	if n := len(elems); n > 1 {
+		last, prev := elems[n-1], ""
+		if n > 2 {
+			prev = elems[n-2]
+		}
+		switch {
+		case knownOS[prev] && knownArch[last]:
+			exprs = append(exprs, prev, last)
+		case knownOS[last] || knownArch[last]:
+			exprs = append(exprs, last)
+		}
+	}
+	for i, expr := range exprs {
+		if len(exprs) > 1 && strings.ContainsAny(expr, "|") {
+			exprs[i] = "(" + expr + ")"
+		}
+	}
+	return strings.Join(exprs, " && ")
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"strings"
+)
+
+// Default is the value a service gives a pointer request field the client
+// left nil, before calling the implementation. It is part of the data model
+// passed to templates.
+type Default struct {
+	// Field is the exported name of the field.
+	Field string `json:"field"`
+	// Name is the name of the parameter as declared.
+	Name string `json:"name"`
+	// Type is the type the field points to.
+	Type string `json:"type"`
+	// Value is the Go expression of the default, converted to Type.
+	Value string `json:"value"`
+}
+
+// defaultOf returns the default of the request field named field, if any.
+func defaultOf(defaults []*Default, field string) *Default {
+	for _, d := range defaults {
+		if d.Field == field {
+			return d
+		}
+	}
+	return nil
+}
+
+// setDefault adds the default d gives a pointer parameter of m, which its
+// argument starts with, followed by a Go constant expression such as 10,
+// "asc" or true.
+func (r *InterfaceGen) setDefault(m *Method, d directive) {
+	fields := strings.SplitN(d.arg, " ", 2)
+	if len(fields) < 2 || strings.TrimSpace(fields[1]) == "" {
+		r.fail(directiveError(r.fileset, d.comment, d.name, "directive %s%s needs a parameter name and a value", directivePrefix, d.name))
+		return
+	}
+	def := &Default{Name: fields[0], Value: strings.TrimSpace(fields[1])}
+	var t *Type
+	for _, p := range m.Parameters {
+		for i, lowerName := range p.LowerNames {
+			if lowerName == def.Name {
+				t, def.Field = p, p.Names[i]
+			}
+		}
+	}
+	if t == nil {
+		r.fail(directiveError(r.fileset, d.comment, d.name, "method %s has no parameter %s to default", m.Name, def.Name))
+		return
+	}
+	if _, ok := t.expr.(*ast.StarExpr); !ok {
+		r.fail(directiveError(r.fileset, d.comment, d.name, "parameter %s of type %s can't have a default, only pointers can", def.Name, t.Type))
+		return
+	}
+	if defaultOf(m.Defaults, def.Field) != nil {
+		r.fail(directiveError(r.fileset, d.comment, d.name, "parameter %s of method %s already has a default", def.Name, m.Name))
+		return
+	}
+	if _, err := parser.ParseExpr(def.Value); err != nil {
+		r.fail(directiveError(r.fileset, d.comment, d.name, "invalid default %s of parameter %s: %s", def.Value, def.Name, err))
+		return
+	}
+	def.Type = strings.TrimPrefix(t.Type, "*")
+	m.Defaults = append(m.Defaults, def)
+}
+
+// defaultFills returns the statements of a service method setting the nil
+// request fields of method m that have defaults.
+func defaultFills(m *Method) string {
+	var out []string
+	for _, d := range m.Defaults {
+		out = append(out, fmt.Sprintf("if request.%s == nil {\n_default := %s(%s)\nrequest.%[1]s = &_default\n}", d.Field, d.Type, d.Value))
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,256 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// Formats of reported diagnostics.
+const (
+	DiagnosticsText = "text"
+	DiagnosticsJSON = "json"
+)
+
+// Severities of diagnostics.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic codes, identifying the kind of problem independently of the
+// wording of the message.
+const (
+	CodeSyntax            = "syntax"
+	CodeMissingError      = "missing-error"
+	CodeErrorPosition     = "error-position"
+	CodeUnnamedField      = "unnamed-field"
+	CodeUnsupportedType   = "unsupported-type"
+	CodeEmbeddedInterface = "embedded-interface"
+	CodeConstraint        = "constraint"
+	CodeNoMethods         = "no-methods"
+	CodeDirective         = "directive"
+	CodeNotifyResults     = "notify-results"
+	CodeUnexportedType    = "unexported-type"
+	CodeGob               = "gob"
+	CodeUnknownPackage    = "unknown-package"
+	CodeUnresolvedImport  = "unresolved-import"
+	CodeCollision         = "collision"
+	CodeIncompatible      = "incompatible"
+	CodeAvro              = "avro"
+	CodeThrift            = "thrift"
+	CodeNotGenerated      = "not-generated"
+	CodeTargetClash       = "target-clash"
+	CodeBadImport         = "bad-import"
+	CodeConfig            = "config"
+	CodeTemplate          = "template"
+	CodeInvalidOutput     = "invalid-output"
+	CodeOutOfDate         = "out-of-date"
+	CodeModified          = "modified"
+	CodeEnvironment       = "environment"
+	CodeFailed            = "failed"
+)
+
+// hints suggest how to fix the problems reported with each code.
+var hints = map[string]string{
+	CodeMissingError:      "add err error as the last result",
+	CodeErrorPosition:     "return a single error, after the other results, as in (n int, err error)",
+	CodeUnnamedField:      "name every parameter and result, as in Add(a, b int) (result int, err error)",
+	CodeUnsupportedType:   "use types that encoding/gob can transmit, such as named types, pointers, slices, arrays, maps and instantiated generic types; channels, functions, unsafe pointers and inline struct or interface types are not supported",
+	CodeEmbeddedInterface: "declare the embedded interface in the same file, or list its methods in the interface",
+	CodeConstraint:        "generate stubs for an interface listing methods only; interfaces with type elements, such as ~int | string, or embedding comparable, are constraints",
+	CodeNoMethods:         "add methods to the interface, or embed interfaces declaring them",
+	CodeDirective:         "the method directives are //rpcgen:notify, //rpcgen:job, //rpcgen:dedup, //rpcgen:deprecated, //rpcgen:redact, //rpcgen:secret, //rpcgen:omitempty, //rpcgen:unix, //rpcgen:unixmilli, //rpcgen:validate, //rpcgen:max, //rpcgen:maxlen, //rpcgen:scope, //rpcgen:timeout, //rpcgen:priority, //rpcgen:default and //rpcgen:field; types take //rpcgen:handle and //rpcgen:enum, and struct fields //rpcgen:field",
+	CodeNotifyResults:     "return only an error from notifications, as the client doesn't wait for the results",
+	CodeUnexportedType:    "export the type, or generate the stubs in the source package",
+	CodeGob:               "give the type exported fields, implement gob.GobEncoder or encoding.BinaryMarshaler, or register the concrete types of interface values with gob.Register",
+	CodeUnknownPackage:    "import the package in the source file; give the import a name if the package name differs from the last element of its path",
+	CodeUnresolvedImport:  "add the module providing the package to the go.work workspace with go work use, or require it in the go.mod of the generated package",
+	CodeCollision:         "rename the declaration, or derive the generated names from another one with --name",
+	CodeIncompatible:      "keep the old method and add one with a new name until all peers use stubs generated from the new interface",
+	CodeAvro:              "use predeclared types other than uint, uint64, uintptr and complex numbers, []byte, slices, arrays, maps with string keys, pointers, time.Time, time.Duration and types declared in the source file",
+	CodeThrift:            "use predeclared types other than uint, uint64, uintptr and complex numbers, []byte, slices, arrays, maps, pointers, time.Duration and types declared in the source file",
+	CodeNotGenerated:      "move the file away, choose another --target, or pass --force to overwrite it",
+	CodeTargetClash:       "give each interface of a source file its own target, with --target or target in rpcgen.yaml, as the default one is named after the file",
+	CodeBadImport:         "list imports as path or name=path, separated by commas",
+	CodeTemplate:          "run with --dump-model to see the data the template is executed with",
+	CodeInvalidOutput:     "the template produces invalid Go code at this line of the generated file, which was not written",
+	CodeOutOfDate:         "run go-rpcgen generate",
+	CodeModified:          "run go-rpcgen generate to discard the edits",
+}
+
+// directiveHints are the hints of the errors about a directive, by directive
+// name, more specific than the one for CodeDirective.
+var directiveHints = map[string]string{
+	DirectiveNotify:     "//rpcgen:notify takes no argument, and can't be combined with //rpcgen:job or //rpcgen:dedup",
+	DirectiveJob:        "//rpcgen:job takes no argument, and can't be combined with //rpcgen:notify or //rpcgen:dedup",
+	DirectiveDedup:      "//rpcgen:dedup takes no argument, and can't be combined with //rpcgen:notify or //rpcgen:job, whose calls aren't retried",
+	DirectiveDeprecated: "follow //rpcgen:deprecated with a message, as in //rpcgen:deprecated use Sum instead",
+	DirectiveRedact:     "follow //rpcgen:redact with names of parameters and results, separated by spaces or commas",
+	DirectiveSecret:     "follow //rpcgen:secret with names of parameters and results, separated by spaces or commas",
+	DirectiveOmitEmpty:  "follow //rpcgen:omitempty with names of parameters and results, separated by spaces or commas",
+	DirectiveUnix:       "follow //rpcgen:unix with names of time.Time parameters and results, separated by spaces or commas",
+	DirectiveUnixMilli:  "follow //rpcgen:unixmilli with names of time.Time parameters and results, separated by spaces or commas",
+	DirectiveValidate:   "follow //rpcgen:validate with a parameter name and validator rules without backquotes, as in //rpcgen:validate age gte=0,lte=130",
+	DirectiveMax:        "follow //rpcgen:max with the name of a string or byte slice parameter and a size, as in //rpcgen:max data 1MB, or put //rpcgen:max=1MB after the parameter on its line",
+	DirectiveMaxLen:     "follow //rpcgen:maxlen with the name of a string, slice or map parameter and a length, as in //rpcgen:maxlen name 256, or put //rpcgen:maxlen=256 after the parameter on its line",
+	DirectiveScope:      "follow //rpcgen:scope with scopes, separated by spaces or commas",
+	DirectiveTimeout:    "follow //rpcgen:timeout with a positive duration, as in //rpcgen:timeout 2s",
+	DirectivePriority:   "follow //rpcgen:priority with high or low",
+	DirectiveDefault:    "follow //rpcgen:default with the name of a pointer parameter and a Go constant, as in //rpcgen:default limit 100",
+	DirectiveField:      "follow //rpcgen:field with a parameter or result name and a Thrift field ID from 1 to 32767, as in //rpcgen:field name 2, or with the ID alone on a struct field",
+	DirectiveEnum:       "put //rpcgen:enum, optionally followed by nonzero, on an integer or string type whose constants are declared in a const block",
+}
+
+// diagnosticsFormat is the format diagnostics are reported in, set by the
+// --diagnostics flag.
+var diagnosticsFormat = DiagnosticsText
+
+// Diagnostic is a problem found while generating stubs, located in a file
+// when possible.
+type Diagnostic struct {
+	Pos      token.Position
+	Severity string
+	Code     string
+	Message  string
+	// Hint suggests how to fix the problem, if there is a known way.
+	Hint string
+}
+
+func (d *Diagnostic) Error() string {
+	if d.Pos.Filename != "" {
+		return d.Pos.String() + ": " + d.Message
+	}
+	return d.Message
+}
+
+// MarshalJSON encodes the diagnostic as a flat object, omitting the parts of
+// the position that are unknown.
+func (d *Diagnostic) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		File     string `json:"file,omitempty"`
+		Line     int    `json:"line,omitempty"`
+		Column   int    `json:"column,omitempty"`
+		Severity string `json:"severity"`
+		Code     string `json:"code"`
+		Message  string `json:"message"`
+		Hint     string `json:"hint,omitempty"`
+	}{d.Pos.Filename, d.Pos.Line, d.Pos.Column, d.Severity, d.Code, d.Message, d.Hint})
+}
+
+// Diagnostics are several problems found at once, such as those of all the
+// methods of an interface, reported one by one.
+type Diagnostics []error
+
+func (l Diagnostics) Error() string {
+	var msgs []string
+	for _, err := range l {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// posError returns an error diagnostic located at pos, with the hint for
+// code.
+func posError(pos token.Position, code string, format string, args ...interface{}) error {
+	return &Diagnostic{
+		Pos:      pos,
+		Severity: SeverityError,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Hint:     hints[code],
+	}
+}
+
+// nodeError returns an error diagnostic located at node.
+func nodeError(fileset *token.FileSet, node ast.Node, code string, format string, args ...interface{}) error {
+	return posError(fileset.Position(node.Pos()), code, format, args...)
+}
+
+// directiveError returns an error diagnostic about the directive name located
+// at node, with the hint for the directive.
+func directiveError(fileset *token.FileSet, node ast.Node, name string, format string, args ...interface{}) error {
+	d := nodeError(fileset, node, CodeDirective, format, args...).(*Diagnostic)
+	if hint, ok := directiveHints[name]; ok {
+		d.Hint = hint
+	}
+	return d
+}
+
+// fileError returns an error diagnostic about the file at path as a whole.
+func fileError(path string, code string, format string, args ...interface{}) error {
+	return posError(token.Position{Filename: path}, code, format, args...)
+}
+
+// syntaxError returns the first error of a syntax error list as a diagnostic
+// with the given code.
+func syntaxError(errs scanner.ErrorList, code string, format string) error {
+	return posError(errs[0].Pos, code, format, errs[0].Msg)
+}
+
+// asDiagnostic returns err as a diagnostic, taking the position of syntax
+// errors into account.
+func asDiagnostic(err error) *Diagnostic {
+	switch err := err.(type) {
+	case *Diagnostic:
+		return err
+	case scanner.ErrorList:
+		if len(err) > 0 {
+			return syntaxError(err, CodeSyntax, "%s").(*Diagnostic)
+		}
+	}
+	return &Diagnostic{Severity: SeverityError, Code: CodeFailed, Message: err.Error()}
+}
+
+// report prints err to stderr in the format selected by --diagnostics, or
+// each of its diagnostics if it has several. Warnings are left out with
+// --quiet.
+func report(err error) {
+	if list, ok := err.(Diagnostics); ok {
+		for _, err := range list {
+			report(err)
+		}
+		return
+	}
+	d, isDiagnostic := err.(*Diagnostic)
+	warning := isDiagnostic && d.Severity == SeverityWarning
+	if warning && verbosity < verbosityNormal {
+		return
+	}
+	if diagnosticsFormat != DiagnosticsJSON {
+		if warning {
+			fmt.Fprintf(os.Stderr, "%s: warning: %s\n", os.Args[0], err)
+		} else {
+			errorf("%s", err)
+		}
+		if isDiagnostic && d.Hint != "" {
+			fmt.Fprintf(os.Stderr, "\thint: %s\n", d.Hint)
+		}
+		return
+	}
+	json.NewEncoder(os.Stderr).Encode(asDiagnostic(err))
+}
+
+// addDiagnosticsFlag registers the --diagnostics flag in fs.
+func addDiagnosticsFlag(fs *flag.FlagSet) {
+	fs.StringVar(&diagnosticsFormat, "diagnostics", DiagnosticsText, "format of reported errors: text, or json for one object per line with file, line, column, severity, code and message")
+}
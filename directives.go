@@ -0,0 +1,310 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// directivePrefix starts the comment directives go-rpcgen reads in the doc
+// comments of interface methods, such as "//rpcgen:notify".
+const directivePrefix = "//rpcgen:"
+
+// Method directives.
+const (
+	// DirectiveNotify marks a method as a one-way notification, which the
+	// client sends without waiting for the reply. The server still replies,
+	// as net/rpc always does, and the client drops the reply.
+	DirectiveNotify = "notify"
+	// DirectiveJob makes the service run a method as a job as well, which
+	// the client starts, polls and collects the result of with separate
+	// calls.
+	DirectiveJob = "job"
+	// DirectiveDedup makes the client send a random idempotency key with
+	// each call of a method, the same for its retries, so that services
+	// with a dedup store run it once per key.
+	DirectiveDedup = "dedup"
+	// DirectiveDeprecated marks a method as deprecated, with a message
+	// telling what to use instead, as in "//rpcgen:deprecated use AddV2".
+	DirectiveDeprecated = "deprecated"
+	// DirectiveRedact names parameters and results of a method whose values
+	// the String methods added by --stringer hide, as in
+	// "//rpcgen:redact password token".
+	DirectiveRedact = "redact"
+	// DirectiveValidate gives a parameter of a method validation rules for
+	// github.com/go-playground/validator, added to its request field as a
+	// validate tag, as in "//rpcgen:validate age gte=0,lte=130".
+	DirectiveValidate = "validate"
+	// DirectiveMax limits the size in bytes of a string or byte slice
+	// parameter, as in "//rpcgen:max data 1MB", or "//rpcgen:max=1MB"
+	// after the parameter on its line.
+	DirectiveMax = "max"
+	// DirectiveMaxLen limits the number of characters of a string
+	// parameter, or of elements of a slice or map parameter, as in
+	// "//rpcgen:maxlen name 256", or "//rpcgen:maxlen=256" after the
+	// parameter on its line.
+	DirectiveMaxLen = "maxlen"
+	// DirectiveSecret names parameters and results of a method holding
+	// secrets, such as passwords. They are redacted, and String methods are
+	// added to the request and response structures of the method even
+	// without --stringer, so that logging them doesn't leak the secrets.
+	DirectiveSecret = "secret"
+	// DirectiveScope names the scopes a caller needs to call a method, as in
+	// "//rpcgen:scope admin", for the authorizer of the service to check.
+	DirectiveScope = "scope"
+	// DirectiveTimeout gives a method a default deadline, which clients
+	// apply to its calls and services with options enforce, as in
+	// "//rpcgen:timeout=2s".
+	DirectiveTimeout = "timeout"
+	// DirectivePriority makes services with a concurrency limit run the
+	// calls of a method before others, or shed them under load, as in
+	// "//rpcgen:priority=high".
+	DirectivePriority = "priority"
+	// DirectiveDefault gives a pointer parameter of a method the value the
+	// service sets when clients leave it nil, as in
+	// "//rpcgen:default limit 100".
+	DirectiveDefault = "default"
+	// DirectiveOmitEmpty names parameters and results of a method whose
+	// request and response fields JSON encoders leave out when empty, as in
+	// "//rpcgen:omitempty cursor items".
+	DirectiveOmitEmpty = "omitempty"
+	// DirectiveUnix names time.Time parameters and results of a method sent
+	// as the number of seconds since the Unix epoch, for peers expecting
+	// them, as in "//rpcgen:unix created".
+	DirectiveUnix = "unix"
+	// DirectiveUnixMilli names time.Time parameters and results of a method
+	// sent as the number of milliseconds since the Unix epoch, as in
+	// "//rpcgen:unixmilli expires".
+	DirectiveUnixMilli = "unixmilli"
+	// DirectiveField gives a parameter or result of a method the ID of its
+	// Thrift field, as in "//rpcgen:field cursor 3", in place of the one
+	// derived from its name. On a field of a struct type, as in
+	// "//rpcgen:field 3", it gives the ID of the field.
+	DirectiveField = "field"
+)
+
+// Priorities of methods, as set by the //rpcgen:priority directive. Methods
+// without the directive have the normal priority, between them.
+const (
+	PriorityHigh = "high"
+	PriorityLow  = "low"
+)
+
+// Type directives.
+const (
+	// DirectiveHandle marks an interface whose objects methods of other
+	// interfaces declared in the same file return. Their services keep the
+	// objects in a table and send handles to them, which their clients turn
+	// into clients of the objects.
+	DirectiveHandle = "handle"
+	// DirectiveEnum marks an integer or string type whose constants
+	// declared in a const block of the same file are all the values
+	// services accept, besides the zero value. With the EnumNonZero
+	// argument, as in "//rpcgen:enum nonzero", the zero value must be one
+	// of the constants too.
+	DirectiveEnum = "enum"
+	EnumNonZero   = "nonzero"
+)
+
+// typeDirectives returns the comments holding the directive name in the doc
+// comments of the types declared in f, by type name, along with its
+// argument, if any.
+func typeDirectives(f *ast.File, name string) map[string]directive {
+	found := map[string]directive{}
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.TypeSpec)
+			doc := spec.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+			if doc == nil {
+				continue
+			}
+			for _, c := range doc.List {
+				if !strings.HasPrefix(c.Text, directivePrefix) {
+					continue
+				}
+				text := strings.TrimSpace(strings.TrimPrefix(c.Text, directivePrefix))
+				d := directive{name: text, comment: c}
+				if i := strings.IndexAny(text, " ="); i >= 0 {
+					d.name, d.arg = text[:i], strings.TrimSpace(text[i+1:])
+				}
+				if d.name == name {
+					found[spec.Name.Name] = d
+				}
+			}
+		}
+	}
+	return found
+}
+
+// handleInterfaces returns the names of the interfaces declared in f with
+// the handle directive in their doc comment.
+func handleInterfaces(f *ast.File) map[string]bool {
+	handles := map[string]bool{}
+	decls := typeDecls(f)
+	for name, d := range typeDirectives(f, DirectiveHandle) {
+		if _, ok := decls[name].Type.(*ast.InterfaceType); ok && d.arg == "" {
+			handles[name] = true
+		}
+	}
+	return handles
+}
+
+// methodDirectives are the known method directives, mapped to whether they
+// take an argument.
+var methodDirectives = map[string]bool{
+	DirectiveNotify:     false,
+	DirectiveJob:        false,
+	DirectiveDedup:      false,
+	DirectiveDeprecated: true,
+	DirectiveRedact:     true,
+	DirectiveValidate:   true,
+	DirectiveMax:        true,
+	DirectiveMaxLen:     true,
+	DirectiveSecret:     true,
+	DirectiveScope:      true,
+	DirectiveTimeout:    true,
+	DirectivePriority:   true,
+	DirectiveDefault:    true,
+	DirectiveOmitEmpty:  true,
+	DirectiveUnix:       true,
+	DirectiveUnixMilli:  true,
+	DirectiveField:      true,
+}
+
+// directive is a go-rpcgen directive and its argument, if any.
+type directive struct {
+	name string
+	arg  string
+	// comment is the comment holding the directive, which errors about its
+	// argument are reported with.
+	comment *ast.Comment
+}
+
+// directives returns the go-rpcgen directives in doc, in order. The argument
+// of a directive follows its name after a space or an equals sign. Unknown
+// directives, and directives with a missing or unexpected argument, are
+// reported with the comment they are in.
+func (r *InterfaceGen) directives(doc *ast.CommentGroup) []directive {
+	if doc == nil {
+		return nil
+	}
+	var directives []directive
+	for _, c := range doc.List {
+		if !strings.HasPrefix(c.Text, directivePrefix) {
+			continue
+		}
+		text := strings.TrimSpace(strings.TrimPrefix(c.Text, directivePrefix))
+		d := directive{name: text, comment: c}
+		if i := strings.IndexAny(text, " ="); i >= 0 {
+			d.name, d.arg = text[:i], strings.TrimSpace(text[i+1:])
+		}
+		takesArg, known := methodDirectives[d.name]
+		switch {
+		case !known:
+			r.fail(nodeError(r.fileset, c, CodeDirective, "unknown directive %s%s", directivePrefix, d.name))
+			continue
+		case takesArg && d.arg == "":
+			r.fail(directiveError(r.fileset, c, d.name, "directive %s%s needs an argument", directivePrefix, d.name))
+			continue
+		case !takesArg && d.arg != "":
+			r.fail(directiveError(r.fileset, c, d.name, "directive %s%s takes no argument", directivePrefix, d.name))
+			continue
+		}
+		directives = append(directives, d)
+	}
+	return directives
+}
+
+// redact adds the parameters and results d names, separated by spaces or
+// commas, to the redacted fields of m. Names that are neither are reported
+// with the comment holding the directive.
+func (r *InterfaceGen) redact(m *Method, d directive) {
+	for _, field := range r.fieldsNamed(m, d, "redact") {
+		if !m.Redacts(field) {
+			m.Redacted = append(m.Redacted, field)
+		}
+	}
+}
+
+// omitEmpty adds the parameters and results d names, separated by spaces or
+// commas, to the fields of m with omitempty json tags.
+func (r *InterfaceGen) omitEmpty(m *Method, d directive) {
+	for _, field := range r.fieldsNamed(m, d, "omit when empty") {
+		if !m.OmitsEmpty(field) {
+			m.OmitEmpty = append(m.OmitEmpty, field)
+		}
+	}
+}
+
+// fieldsNamed returns the exported names of the parameters and results of m
+// the argument of d names, separated by spaces or commas. Names that are
+// neither are reported with the comment holding the directive, as having
+// nothing to do.
+func (r *InterfaceGen) fieldsNamed(m *Method, d directive, do string) []string {
+	var fields []string
+	names := strings.FieldsFunc(d.arg, func(c rune) bool { return c == ',' || c == ' ' || c == '\t' })
+	for _, name := range names {
+		field := ""
+		for _, t := range append(append([]*Type{}, m.Parameters...), m.Results...) {
+			for i, lowerName := range t.LowerNames {
+				if lowerName == name {
+					field = t.Names[i]
+				}
+			}
+		}
+		if field == "" {
+			r.fail(directiveError(r.fileset, d.comment, d.name, "method %s has no parameter or result %s to %s", m.Name, name, do))
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// validate sets the validation rules of the parameter d names, which its
+// argument starts with, to the rest of the argument.
+func (r *InterfaceGen) validate(m *Method, d directive) {
+	fields := strings.SplitN(d.arg, " ", 2)
+	if len(fields) < 2 || strings.TrimSpace(fields[1]) == "" {
+		r.fail(directiveError(r.fileset, d.comment, d.name, "directive %s%s needs a parameter name and rules", directivePrefix, d.name))
+		return
+	}
+	name, rules := fields[0], strings.TrimSpace(fields[1])
+	if strings.ContainsRune(rules, '`') {
+		r.fail(directiveError(r.fileset, d.comment, d.name, "validation rules of %s can't contain backquotes", name))
+		return
+	}
+	for _, t := range m.Parameters {
+		for i, lowerName := range t.LowerNames {
+			if lowerName == name {
+				if m.Validations == nil {
+					m.Validations = map[string]string{}
+				}
+				m.Validations[t.Names[i]] = rules
+				return
+			}
+		}
+	}
+	r.fail(directiveError(r.fileset, d.comment, d.name, "method %s has no parameter %s to validate", m.Name, name))
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func doctorCommand() *command {
+	cmd := newCommand("doctor", "", "Check the Go toolchain, the module, the config file, the templates and the sources go-rpcgen uses")
+	targetFlags := addTargetFlags(cmd.flags)
+	cmd.targets = targetFlags
+	cmd.run = func(args []string) error {
+		failed := false
+		problem := func(err error) {
+			report(err)
+			if d, ok := err.(*Diagnostic); !ok || d.Severity != SeverityWarning {
+				failed = true
+			}
+		}
+		if !checkToolchain(problem) {
+			return errFailed
+		}
+		if *targetFlags.source == "" && *targetFlags.rpcType == "" {
+			if _, err := os.Stat(*targetFlags.config); os.IsNotExist(err) {
+				infof("no %s here; pass --source and --type, or --config, to check sources", *targetFlags.config)
+				return nil
+			}
+		}
+		targets, err := targetFlags.targets("")
+		if err != nil {
+			problem(err)
+			return errFailed
+		}
+		if *targetFlags.source == "" {
+			infof("config: %s lists %s", *targetFlags.config, plural(len(targets), "service"))
+		}
+		for _, opts := range targets {
+			checkTarget(opts, problem)
+		}
+		if failed {
+			return errFailed
+		}
+		return nil
+	}
+	return cmd
+}
+
+// envError returns a diagnostic about the environment go-rpcgen runs in,
+// with a hint telling how to fix it.
+func envError(severity, hint, format string, args ...interface{}) error {
+	return &Diagnostic{Severity: severity, Code: CodeEnvironment, Message: fmt.Sprintf(format, args...), Hint: hint}
+}
+
+// checkToolchain checks that the go command, which resolves import paths and
+// loads packages, runs, and whether the working directory is in a module,
+// passing problems to problem. It returns false if go can't be run.
+func checkToolchain(problem func(error)) bool {
+	if _, err := exec.LookPath("go"); err != nil {
+		problem(envError(SeverityError, "install Go from https://go.dev/dl/ and add its bin directory to PATH", "go command not found: %s", err))
+		return false
+	}
+	out, err := exec.Command("go", "version").CombinedOutput()
+	if err != nil {
+		problem(envError(SeverityError, "check the Go installation, for example with GOROOT unset", "go version failed: %s: %s", err, strings.TrimSpace(string(out))))
+		return false
+	}
+	infof("go: %s", strings.TrimSpace(string(out)))
+	out, err = exec.Command("go", "env", "GOMOD").Output()
+	switch gomod := strings.TrimSpace(string(out)); {
+	case err != nil:
+		problem(envError(SeverityError, "check the Go installation and GOFLAGS", "go env failed: %s", err))
+	case gomod == "" || gomod == os.DevNull:
+		problem(envError(SeverityWarning, "run go mod init, or run go-rpcgen in a module, so that the packages of parameter types and generated packages can be resolved", "the working directory is not in a Go module"))
+	default:
+		infof("module: %s", gomod)
+	}
+	return true
+}
+
+// checkTarget checks that the template, template overrides or plugin of
+// opts load and that its source parses into an interface stubs can be
+// generated for, passing problems to problem.
+func checkTarget(opts *Options, problem func(error)) {
+	if opts.Template != "" || opts.TemplateDir != "" || opts.Plugin != "" {
+		if _, err := newBackend(opts); err != nil {
+			problem(err)
+		} else {
+			infof("%s: %s loads", opts.Source, backendName(opts))
+		}
+	}
+	gen, _, err := parse(opts)
+	if err != nil {
+		problem(err)
+		return
+	}
+	for _, warning := range gobWarnings(opts.Source, opts.Type) {
+		problem(warning)
+	}
+	infof("%s: %s parses, with %s", opts.Source, opts.Type, plural(len(gen.Methods), "method"))
+}
+
+// backendName describes the template or plugin opts renders stubs with.
+func backendName(opts *Options) string {
+	switch {
+	case opts.Plugin != "":
+		return "plugin " + opts.Plugin
+	case opts.Template != "":
+		return "template " + opts.Template
+	}
+	return "template overrides in " + opts.TemplateDir
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	gotypes "go/types"
+	"sort"
+	"strings"
+)
+
+// Enum is a type declared in the source file with the //rpcgen:enum
+// directive and an integer or string underlying type, whose constants
+// declared there in a const block are the values services accept for
+// parameters of the type, besides the zero value. It is part of the data
+// model passed to templates.
+type Enum struct {
+	// Name is the name of the type as declared.
+	Name string `json:"name"`
+	// Type is the type as generated code refers to it, qualified with the
+	// source package name when the file belongs to another package.
+	Type string `json:"type"`
+	// String reports whether the underlying type is a string type.
+	String bool `json:"string"`
+	// NonZero reports whether the zero value is rejected unless it is one
+	// of the constants, as asked by "//rpcgen:enum nonzero".
+	NonZero   bool            `json:"nonZero,omitempty"`
+	Constants []*EnumConstant `json:"constants"`
+}
+
+// EnumConstant is a constant of an enum type, in declaration order.
+type EnumConstant struct {
+	// Name is the constant as generated code refers to it, qualified like
+	// the type.
+	Name string `json:"name"`
+	// Value is the Go literal of the value of the constant.
+	Value string `json:"value"`
+	// value is the value of the constant, which schemas declare.
+	value constant.Value
+}
+
+// sourceEnums returns the enums declared in f, by name: the types with the
+// //rpcgen:enum directive. f is type-checked on its own, so the values of
+// constants defined with declarations of other files can't be known, and
+// the types of such constants aren't enums. Neither are bit flags, whose
+// constants are shifted or powers of two, as their combinations are valid
+// too.
+func (r *RPCGen) sourceEnums(f *ast.File) map[string]*Enum {
+	fileset := r.fileset
+	marked := typeDirectives(f, DirectiveEnum)
+	var names []string
+	for name := range marked {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if d := marked[name]; d.arg != "" && d.arg != EnumNonZero {
+			r.fail(directiveError(fileset, d.comment, DirectiveEnum, "invalid argument %q of directive %s%s of %s, expected none or %s", d.arg, directivePrefix, DirectiveEnum, name, EnumNonZero))
+			delete(marked, name)
+		}
+	}
+	if len(marked) == 0 {
+		return nil
+	}
+	info := &gotypes.Info{Defs: map[*ast.Ident]gotypes.Object{}}
+	// Errors, such as unresolved imports, only leave some objects untyped.
+	conf := gotypes.Config{Error: func(error) {}}
+	pkg, _ := conf.Check(f.Name.Name, fileset, []*ast.File{f}, info)
+	if pkg == nil {
+		return nil
+	}
+	enums := map[string]*Enum{}
+	unknown := map[string]bool{}
+	flags := map[string]bool{}
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST || !gen.Lparen.IsValid() {
+			continue
+		}
+		shifted := false
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.ValueSpec)
+			// Specs without values repeat the expressions of the previous
+			// one, as in 1 << iota.
+			if len(spec.Values) > 0 {
+				shifted = hasShift(spec.Values)
+			}
+			for _, name := range spec.Names {
+				c, ok := info.Defs[name].(*gotypes.Const)
+				if !ok || name.Name == "_" {
+					continue
+				}
+				named, ok := c.Type().(*gotypes.Named)
+				if !ok || named.Obj().Pkg() != pkg || named.TypeParams() != nil {
+					continue
+				}
+				basic, ok := named.Underlying().(*gotypes.Basic)
+				if !ok || basic.Info()&(gotypes.IsInteger|gotypes.IsString) == 0 {
+					continue
+				}
+				typeName := named.Obj().Name()
+				if _, ok := marked[typeName]; !ok {
+					continue
+				}
+				if shifted {
+					flags[typeName] = true
+				}
+				if c.Val().Kind() == constant.Unknown {
+					unknown[typeName] = true
+					continue
+				}
+				enum := enums[typeName]
+				if enum == nil {
+					enum = &Enum{Name: typeName, Type: typeName, String: basic.Info()&gotypes.IsString != 0, NonZero: marked[typeName].arg == EnumNonZero}
+					enums[typeName] = enum
+				}
+				enum.Constants = append(enum.Constants, &EnumConstant{Name: name.Name, Value: c.Val().ExactString(), value: c.Val()})
+			}
+		}
+	}
+	for name := range unknown {
+		debugf("%s: values of %s unknown, not validating it", fileset.Position(f.Pos()), name)
+		delete(enums, name)
+	}
+	for name, enum := range enums {
+		if flags[name] || powersOfTwo(enum) {
+			debugf("%s: %s holds bit flags, not validating it", fileset.Position(f.Pos()), name)
+			flags[name] = true
+			delete(enums, name)
+		}
+	}
+	for _, name := range names {
+		if d, ok := marked[name]; ok && enums[name] == nil && !unknown[name] && !flags[name] {
+			r.fail(directiveError(fileset, d.comment, DirectiveEnum, "enum %s must have an integer or string underlying type and constants declared in a const block", name))
+		}
+	}
+	return enums
+}
+
+// hasShift reports whether any of exprs shifts to the left, as bit flags
+// declared with 1 << iota do.
+func hasShift(exprs []ast.Expr) bool {
+	found := false
+	for _, expr := range exprs {
+		ast.Inspect(expr, func(n ast.Node) bool {
+			if b, ok := n.(*ast.BinaryExpr); ok && b.Op == token.SHL {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// powersOfTwo reports whether the constants of an integer enum other than
+// zero are all powers of two, the largest at least 4, as those of bit flags
+// declared one by one are.
+func powersOfTwo(enum *Enum) bool {
+	if enum.String {
+		return false
+	}
+	largest := int64(0)
+	for _, c := range enum.Constants {
+		v, ok := constant.Int64Val(c.value)
+		if !ok || v < 0 || v&(v-1) != 0 {
+			return false
+		}
+		if v > largest {
+			largest = v
+		}
+	}
+	return largest >= 4
+}
+
+// enumName returns the name of the enum type of a field of type expr, or of
+// the type it points to, or "" if it isn't one.
+func enumName(enums map[string]*Enum, expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if id, ok := expr.(*ast.Ident); ok && enums[id.Name] != nil {
+		return id.Name
+	}
+	return ""
+}
+
+// usedEnums returns the enums of the parameters and results of methods,
+// sorted by name.
+func usedEnums(enums map[string]*Enum, methods []*Method) []*Enum {
+	used := map[string]bool{}
+	var out []*Enum
+	for _, m := range methods {
+		for _, t := range append(append([]*Type{}, m.Parameters...), m.Results...) {
+			if t.Enum != "" && !used[t.Enum] {
+				used[t.Enum] = true
+				out = append(out, enums[t.Enum])
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// enumChecks returns the statements of a service method failing if a
+// parameter of method m of the service named service, of the interface
+// typeName, has a value of its enum type other than its constants.
+func enumChecks(typeName, service string, m *Method) string {
+	var out []string
+	for _, t := range m.Parameters {
+		if t.Enum == "" {
+			continue
+		}
+		_, pointer := t.expr.(*ast.StarExpr)
+		for i, name := range t.Names {
+			field := "request." + name
+			cond := fmt.Sprintf("!_%sValid%s(%s)", typeName, t.Enum, field)
+			if pointer {
+				field = "*" + field
+				cond = fmt.Sprintf("request.%s != nil && !_%sValid%s(%s)", name, typeName, t.Enum, field)
+			}
+			out = append(out, fmt.Sprintf("if %s {\nreturn fmt.Errorf(%q, %s)\n}", cond,
+				fmt.Sprintf("%s.%s: invalid %s %%v", service, m.Name, t.LowerNames[i]), field))
+		}
+	}
+	return strings.Join(out, "\n")
+}
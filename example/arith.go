@@ -1,5 +1,7 @@
 package example
 
+//go:generate go-rpcgen --source=arith.go --type=Arith
+
 type Arith interface {
 	Add(a, b int) (result int, err error)
 }
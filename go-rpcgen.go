@@ -17,226 +17,1388 @@ package main
 
 import (
 	"bytes"
-	"flag"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"go/ast"
+	"go/build/constraint"
 	"go/parser"
 	"go/printer"
+	"go/scanner"
 	"go/token"
+	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/alecthomas/template"
+	"golang.org/x/tools/go/analysis/unitchecker"
+	"golang.org/x/tools/imports"
+	gofumpt "mvdan.cc/gofumpt/format"
 )
 
-var rpcTemplate = `// Generated by go-rpcgen. Do not modify.
+// generatedMarker identifies files written by go-rpcgen. It appears in the
+// "// Code generated ... DO NOT EDIT." line before the package clause of
+// every generated file.
+const generatedMarker = "Code generated by go-rpcgen"
 
-package {{.Package}}
+// legacyGeneratedMarker identifies files written by older versions of
+// go-rpcgen, which had it on the first line.
+const legacyGeneratedMarker = "Generated by go-rpcgen"
 
-import (
-{{range $key, $value := .Imports}}  {{$value}} "{{$key}}"
-{{end}})
-{{$type := .Type}}
-// {{.Type}}Service is generated service for {{.Type}} interface.
-type {{.Type}}Service struct {
-	impl {{.Type}}
+const defaultRPCClientType = "*rpc.Client"
+
+const defaultClientClose = "Close"
+
+const defaultJobTTL = 10 * time.Minute
+
+const defaultMaxJobs = 1000
+
+const defaultSuffix = "rpc.gen.go"
+
+// Generation modes selecting which halves of the stubs are written.
+const (
+	ModeBoth   = "both"
+	ModeClient = "client"
+	ModeServer = "server"
+)
+
+// Formatting styles applied to generated files.
+const (
+	FormatGofmt   = "gofmt"
+	FormatGofumpt = "gofumpt"
+)
+
+// Naming strategies of the json tags of the request and response fields.
+const (
+	JSONNamingAsIs  = "asis"
+	JSONNamingSnake = "snake"
+	JSONNamingCamel = "camel"
+)
+
+var defaultImports = []string{"net/rpc"}
+
+// benchmarkImports are the imports of the codec benchmarks, which refer to
+// nothing but the request and response types of their package.
+var benchmarkImports = map[string]string{
+	"bytes": "", "encoding": "", "encoding/gob": "", "encoding/json": "",
+	"math/rand": "", "reflect": "", "testing": "", "testing/quick": "",
 }
 
-// New{{.Type}}Service creates a new {{.Type}}Service instance.
-func New{{.Type}}Service(impl {{.Type}}) *{{.Type}}Service {
-	return &{{.Type}}Service{impl}
+// sshImports are the imports of the client constructor added by --ssh.
+var sshImports = map[string]string{"golang.org/x/crypto/ssh": ""}
+
+// cryptoRandImports are the imports of the code drawing random numbers that
+// must not be guessed, which goimports could otherwise resolve to math/rand:
+// the nonces of the clients added by --hmac, the idempotency keys of clients
+// of methods with the //rpcgen:dedup directive, and the handles and job IDs
+// of services.
+var cryptoRandImports = map[string]string{"crypto/rand": ""}
+
+// naclImports are the imports of the encrypted connections added by --nacl.
+var naclImports = map[string]string{
+	"crypto/rand": "", "golang.org/x/crypto/nacl/box": "", "golang.org/x/crypto/nacl/secretbox": "",
 }
 
-// Register{{.Type}}Service registers impl in server.
-func Register{{.Type}}Service(server *rpc.Server, impl {{.Type}}) error {
-	return server.RegisterName("{{.Service}}", New{{.Type}}Service(impl))
+// stdio is the path standing for stdin as the source, and stdout as the
+// target.
+const stdio = "-"
+
+// Options describes how to generate stubs for a single interface.
+type Options struct {
+	Source        string   `yaml:"source"`
+	Type          string   `yaml:"type"`
+	Target        string   `yaml:"target"`
+	Imports       []string `yaml:"imports"`
+	Package       string   `yaml:"package"`
+	Service       string   `yaml:"service"`
+	RPCClientType string   `yaml:"rpc_client_type"`
+	Mode          string   `yaml:"mode"`
+	// Split writes the client, the service and the request and response
+	// types to separate files named after the source file.
+	Split bool `yaml:"split"`
+	// ClientPackage and ServerPackage are directories of other packages to
+	// write the client and the service to. Code generated there imports the
+	// source package to refer to the interface and its types.
+	ClientPackage string `yaml:"client_package"`
+	ServerPackage string `yaml:"server_package"`
+	// OutputDir is the directory generated files are written to by default,
+	// instead of the directory of the source file.
+	OutputDir string `yaml:"output_dir"`
+	// Suffix replaces the extension of the source file name to form the
+	// default target file name.
+	Suffix string `yaml:"suffix"`
+	// Template is the path of a template to use instead of the built-in
+	// one. It is executed with an RPCGen for each generated file.
+	Template string `yaml:"template"`
+	// TemplateDir is a directory of <section>.tmpl files overriding the
+	// sections of the same name defined by the template.
+	TemplateDir string `yaml:"template_dir"`
+	// BuildTags is a build constraint expression, such as "linux && amd64",
+	// added as a //go:build line to generated files. It defaults to the
+	// constraints of the source file.
+	BuildTags string `yaml:"build_tags"`
+	// HeaderFile is the path of a banner, such as a license, to put at the
+	// top of generated files. Lines not already commented are commented.
+	HeaderFile string `yaml:"header_file"`
+	// Format is the formatting style of generated files.
+	Format string `yaml:"format"`
+	// Plugin names a go-rpcgen-<plugin> executable, or gives the path of
+	// one, to render the stubs instead of the template.
+	Plugin string `yaml:"plugin"`
+	// Name replaces the interface name in the names of the generated
+	// identifiers, such as <Name>Service and <Name>Client, for example when
+	// they would collide with declarations of the package.
+	Name string `yaml:"name"`
+	// ClientClose is the name of the client method closing the connection.
+	// If the interface has a method of that name, its stub closes the
+	// connection after calling it.
+	ClientClose string `yaml:"client_close"`
+	// Pool makes the client reuse its request and response structures
+	// through a sync.Pool per method instead of allocating them per call.
+	Pool bool `yaml:"pool"`
+	// BinaryCodec adds MarshalBinary and UnmarshalBinary methods, which gob
+	// uses instead of reflection, to the request and response structures
+	// whose fields all have predeclared types.
+	BinaryCodec bool `yaml:"binary_codec"`
+	// Msgp adds a go:generate directive running msgp on the file of the
+	// request and response structures, for msgpack encoding.
+	Msgp bool `yaml:"msgp"`
+	// Easyjson marks the request and response structures for easyjson and
+	// adds a go:generate directive running it, for JSON codecs such as
+	// net/rpc/jsonrpc.
+	Easyjson bool `yaml:"easyjson"`
+	// Bench adds a test file next to the request and response types with
+	// benchmarks encoding them through each available codec.
+	Bench bool `yaml:"bench"`
+	// Dispatch adds Dispatch and NewMessages methods to the service, which
+	// call its methods by name through a generated switch, for transports
+	// other than net/rpc.
+	Dispatch bool `yaml:"dispatch"`
+	// JobTTL is how long the service keeps the result of a finished job
+	// that was not collected.
+	JobTTL time.Duration `yaml:"job_ttl"`
+	// MaxJobs is how many jobs, running or not yet collected, the service
+	// keeps at once; starting more fails.
+	MaxJobs int `yaml:"max_jobs"`
+	// Expvar makes the service publish the call count, error count and
+	// latency of each method with expvar, under the service name.
+	Expvar bool `yaml:"expvar"`
+	// PprofLabels makes the service run the methods of the implementation
+	// with pprof labels naming the service and the method, so that profiles
+	// attribute time to them.
+	PprofLabels bool `yaml:"pprof_labels"`
+	// WireDump gives the client a SetWireDump method, which turns on dumps
+	// of its calls and the bytes on its connection at run time.
+	WireDump bool `yaml:"wire_dump"`
+	// Health gives the service a HealthMux method returning an HTTP handler
+	// for liveness and readiness probes.
+	Health bool `yaml:"health"`
+	// Runner adds a Run<Name>Server function serving the service on a
+	// listener until the context is done or the process is interrupted.
+	Runner bool `yaml:"runner"`
+	// Handshake adds Handshake methods to the service and the client, which
+	// check that both were generated from the same interface, and makes
+	// Dial<Name>Client call it.
+	Handshake bool `yaml:"handshake"`
+	// LogDeprecated makes the service log the first call of each deprecated
+	// method.
+	LogDeprecated bool `yaml:"log_deprecated"`
+	// ServiceVersion is appended to the service name, as in "Arith.v2", so
+	// that two versions of a service can be registered on the same server.
+	ServiceVersion string `yaml:"service_version"`
+	// Manifest writes a JSON description of the service, its methods and
+	// their request and response fields next to the request and response
+	// types.
+	Manifest bool `yaml:"manifest"`
+	// Avro writes the Avro schemas of the request and response structures
+	// next to them.
+	Avro bool `yaml:"avro"`
+	// Thrift writes a Thrift definition of the interface next to the
+	// request and response structures.
+	Thrift bool `yaml:"thrift"`
+	// SSH adds a client constructor dialing the service through an SSH
+	// connection, with golang.org/x/crypto/ssh.
+	SSH bool `yaml:"ssh"`
+	// ServerOptions makes the service constructors take options adding
+	// interceptors, a logger, a concurrency limit, a timeout and request
+	// validation.
+	ServerOptions bool `yaml:"server_options"`
+	// ClientOptions makes the client constructors take options adding
+	// interceptors, a timeout and a retry policy.
+	ClientOptions bool `yaml:"client_options"`
+	// Stringer adds String methods to the request and response structures,
+	// printing their fields other than those listed by //rpcgen:redact
+	// directives.
+	Stringer bool `yaml:"stringer"`
+	// JSONNaming is how the json tags of the request and response fields
+	// name them, for JSON codecs. With JSONNamingAsIs they have no tags, and
+	// are named like the fields.
+	JSONNaming string `yaml:"json_naming"`
+	// HMAC adds constructors of clients signing their requests with a
+	// shared key, and a function serving the service to them only.
+	HMAC bool `yaml:"hmac"`
+	// NaCl adds constructors of clients and a function serving the service
+	// over connections encrypted with a pre-shared key, using
+	// golang.org/x/crypto/nacl.
+	NaCl bool `yaml:"nacl"`
+	// Transport adds a Transport interface of connections exchanging frames,
+	// with a client constructor dialing one and a function serving the
+	// service on those it accepts, for links other than TCP.
+	Transport bool `yaml:"transport"`
+	// Faults adds a <Name>WithFaults decorator of implementations injecting
+	// latency, errors and dropped responses into their calls, for testing
+	// resilience.
+	Faults bool `yaml:"faults"`
+	// Combined names a combined client the client joins, which creates the
+	// clients of all services joining it from the same package on one
+	// connection, as New<Combined>Client.
+	Combined string `yaml:"combined"`
+	// SortMethods orders the methods by name rather than as declared, so
+	// that reordering them in the interface changes neither the generated
+	// files nor the source hash.
+	SortMethods bool `yaml:"sort_methods"`
+	// WireTypes maps Go types declared in other packages, named by the
+	// path of their package and their name, such as
+	// github.com/google/uuid.UUID, to how they are sent. It can only be set
+	// in the config file.
+	WireTypes map[string]*TypeMapping `yaml:"wire_types"`
+
+	// set holds the keys of the config file that set these options.
+	set map[string]bool
 }
-{{range .Methods}}
-// {{$type}}{{.Name}}Request is a helper structure for {{.Name}} method.
-type {{$type}}{{.Name}}Request struct {
-	{{.Parameters | publicfields}}
+
+// setDefaults fills in the options that can be derived from the others.
+func (o *Options) setDefaults() {
+	if o.Suffix == "" {
+		o.Suffix = defaultSuffix
+	}
+	if o.Target == "" && o.Source == stdio {
+		o.Target = stdio
+	}
+	if o.Target == "" && !o.multiFile() {
+		dir := filepath.Dir(o.Source)
+		if o.OutputDir != "" {
+			dir = o.OutputDir
+		}
+		o.Target = filepath.Join(dir, o.outputName(o.Suffix))
+	}
+	if o.Service == "" {
+		o.Service = o.Type
+	}
+	if o.Imports == nil {
+		o.Imports = defaultImports
+	}
+	if o.RPCClientType == "" {
+		o.RPCClientType = defaultRPCClientType
+	}
+	if o.Mode == "" {
+		o.Mode = ModeBoth
+	}
+	if o.Format == "" {
+		o.Format = FormatGofmt
+	}
+	if o.ClientClose == "" {
+		o.ClientClose = defaultClientClose
+	}
+	if o.JSONNaming == "" {
+		o.JSONNaming = JSONNamingAsIs
+	}
+	if o.JobTTL == 0 {
+		o.JobTTL = defaultJobTTL
+	}
+	if o.MaxJobs == 0 {
+		o.MaxJobs = defaultMaxJobs
+	}
 }
 
-// {{$type}}{{.Name}}Response is a helper structure for {{.Name}} method.
-type {{$type}}{{.Name}}Response struct {
-	{{.Results | publicfields}}
+// validate checks the options for values that can't be generated.
+func (o *Options) validate() error {
+	switch o.Mode {
+	case ModeBoth, ModeClient, ModeServer:
+	default:
+		return fmt.Errorf("invalid mode %q, expected %s, %s or %s", o.Mode, ModeClient, ModeServer, ModeBoth)
+	}
+	if o.BuildTags != "" {
+		if _, err := constraint.Parse("//go:build " + o.BuildTags); err != nil {
+			return fmt.Errorf("invalid build tags %q: %s", o.BuildTags, err)
+		}
+	}
+	switch o.Format {
+	case FormatGofmt, FormatGofumpt:
+	default:
+		return fmt.Errorf("invalid format %q, expected %s or %s", o.Format, FormatGofmt, FormatGofumpt)
+	}
+	switch o.JSONNaming {
+	case JSONNamingAsIs, JSONNamingSnake, JSONNamingCamel:
+	default:
+		return fmt.Errorf("invalid JSON naming %q, expected %s, %s or %s", o.JSONNaming, JSONNamingSnake, JSONNamingCamel, JSONNamingAsIs)
+	}
+	if o.Name != "" && !token.IsIdentifier(o.Name) {
+		return fmt.Errorf("invalid name %q, expected an identifier", o.Name)
+	}
+	if o.Combined != "" && !token.IsIdentifier(o.Combined) {
+		return fmt.Errorf("invalid combined client name %q, expected an identifier", o.Combined)
+	}
+	if !token.IsIdentifier(o.ClientClose) || !ast.IsExported(o.ClientClose) {
+		return fmt.Errorf("invalid client close method %q, expected an exported identifier", o.ClientClose)
+	}
+	if strings.ContainsAny(o.ServiceVersion, ". \t\n") {
+		return fmt.Errorf("invalid service version %q, expected no dots or spaces", o.ServiceVersion)
+	}
+	if o.JobTTL < 0 {
+		return fmt.Errorf("invalid job TTL %s, expected a positive duration", o.JobTTL)
+	}
+	if o.MaxJobs < 0 {
+		return fmt.Errorf("invalid job limit %d, expected a positive number", o.MaxJobs)
+	}
+	if o.Plugin != "" && (o.Template != "" || o.TemplateDir != "") {
+		return fmt.Errorf("a plugin can't be used with a template")
+	}
+	var wireTypes []string
+	for name := range o.WireTypes {
+		wireTypes = append(wireTypes, name)
+	}
+	sort.Strings(wireTypes)
+	for _, name := range wireTypes {
+		m := o.WireTypes[name]
+		if i := strings.LastIndex(name, "."); i <= 0 || !token.IsIdentifier(name[i+1:]) {
+			return fmt.Errorf("invalid wire type %q, expected a package path and type name such as github.com/google/uuid.UUID", name)
+		}
+		if m == nil || m.Type == "" || m.Encode == "" || m.Decode == "" {
+			return fmt.Errorf("wire type %s: expected type, encode and decode", name)
+		}
+		if _, err := parser.ParseExpr(m.Type); err != nil {
+			return fmt.Errorf("wire type %s: invalid type %q", name, m.Type)
+		}
+		if m.Avro != "" && !json.Valid([]byte(m.Avro)) {
+			return fmt.Errorf("wire type %s: invalid Avro schema %s", name, m.Avro)
+		}
+	}
+	if o.Source == stdio && o.Package == "" {
+		return fmt.Errorf("a package is required when reading the source from stdin")
+	}
+	if o.testSource() && (o.ClientPackage != "" || o.ServerPackage != "") {
+		return fmt.Errorf("interfaces declared in test files can't be used from other packages")
+	}
+	if o.Bench && o.Target == stdio {
+		return fmt.Errorf("benchmarks can't be written to stdout")
+	}
+	if o.Manifest && o.Target == stdio {
+		return fmt.Errorf("a manifest can't be written to stdout")
+	}
+	if o.ClientOptions && o.Pool {
+		return fmt.Errorf("client options can't be used with pooling, as calls that time out leave their request and response in use")
+	}
+	if o.Avro && o.Target == stdio {
+		return fmt.Errorf("Avro schemas can't be written to stdout")
+	}
+	if o.Thrift && o.Target == stdio {
+		return fmt.Errorf("a Thrift definition can't be written to stdout")
+	}
+	if o.Source == stdio && o.multiFile() {
+		return fmt.Errorf("output can't be split or generated into other packages when reading the source from stdin")
+	}
+	if o.multiFile() && o.Target != "" {
+		return fmt.Errorf("a target can't be used when splitting output or generating into other packages")
+	}
+	return nil
 }
 
-// {{.Name}} is RPC implementation of {{.Name}} calling it.
-func (s *{{$type}}Service) {{.Name}}(request *{{$type}}{{.Name}}Request, response *{{$type}}{{.Name}}Response) (err error) {
-	{{.Results | publicrefswithprefix "response."}}{{if .Results}}, {{end}}err = s.impl.{{.Name}}({{.Parameters | publicrefswithprefix "request."}})
-	return
+// testSource reports whether the source is a test file, in which case the
+// stubs are written to test files too, so that they never ship.
+func (o *Options) testSource() bool {
+	return strings.HasSuffix(o.Source, "_test.go")
 }
-{{end}}
-// {{.Type}}Client is generated client for {{.Type}} interface.
-type {{.Type}}Client struct {
-	client {{.RPCType}}
+
+// outputName returns the name of the generated file made of the name of the
+// source file and suffix, such as "arith_client.gen.go" for "arith.go", or
+// "arith_client.gen_test.go" for "arith_test.go".
+func (o *Options) outputName(suffix string) string {
+	base := strings.TrimSuffix(filepath.Base(o.Source), filepath.Ext(o.Source))
+	if o.testSource() {
+		return strings.TrimSuffix(base, "_test") + strings.TrimSuffix(suffix, ".go") + "_test.go"
+	}
+	return base + suffix
 }
 
-// Dial{{.Type}}Client connects to addr and creates a new {{.Type}}Client instance.
-func Dial{{.Type}}Client(addr string) (*{{.Type}}Client, error) {
-	client, err := rpc.Dial("tcp", addr)
-	return &{{.Type}}Client{client}, err
+// serviceName returns the name the service is registered under, including
+// its version, if any.
+func (o *Options) serviceName() string {
+	if o.ServiceVersion == "" {
+		return o.Service
+	}
+	return o.Service + "." + o.ServiceVersion
 }
 
-// New{{.Type}}Client creates a new {{.Type}}Client instance.
-func New{{.Type}}Client(client {{.RPCType}}) *{{.Type}}Client {
-	return &{{.Type}}Client{client}
+// multiFile reports whether the stubs are written to more than one file.
+func (o *Options) multiFile() bool {
+	return o.Split || o.ClientPackage != "" || o.ServerPackage != ""
 }
 
-// Close terminates the connection.
-func (_c *{{$type}}Client) Close() error {
-	return _c.client.Close()
+// part is one generated file and the parts of the stubs it contains.
+type part struct {
+	path   string
+	dir    string // directory of the package the file belongs to
+	types  bool
+	server bool
+	client bool
+	// benchmarks is set for the test file benchmarking the codecs.
+	benchmarks bool
+	// manifest is set for the JSON manifest of the service.
+	manifest bool
+	// avro is set for the Avro schemas of the request and response types.
+	avro bool
+	// thrift is set for the Thrift definition of the interface.
+	thrift bool
 }
-{{range .Methods}}
-// {{.Name}} is part of implementation of {{$type}} calling corresponding method on RPC server.
-func (_c *{{$type}}Client) {{.Name}}({{.Parameters | functionargs}}) ({{.Results | functionargs}}{{if .Results}}, {{end}}err error) {
-	_request := &{{$type}}{{.Name}}Request{{"{"}}{{.Parameters | refswithprefix ""}}{{"}"}}
-	_response := &{{$type}}{{.Name}}Response{}
-	err = _c.client.Call("{{$.Service}}.{{.Name}}", _request, _response)
-	return {{.Results | publicrefswithprefix "_response."}}{{if .Results}}, {{end}}err
+
+// parts returns the files generated for the options. Unless all stubs go to
+// the target file, the client and the service are written next to the source
+// or to their own packages. The request and response types are shared
+// through a separate file when both halves end up in the same package, and
+// are otherwise included in each half.
+func (o *Options) parts() []*part {
+	parts := o.stubParts()
+	if o.Bench {
+		name := o.outputName("_bench.gen.go")
+		if !o.testSource() {
+			name = strings.TrimSuffix(name, ".go") + "_test.go"
+		}
+		for _, p := range parts {
+			if p.types {
+				parts = append(parts, &part{path: filepath.Join(p.dir, name), dir: p.dir, benchmarks: true})
+				break
+			}
+		}
+	}
+	base := strings.TrimSuffix(filepath.Base(o.Source), filepath.Ext(o.Source))
+	for _, p := range parts {
+		if !p.types {
+			continue
+		}
+		if o.Manifest {
+			parts = append(parts, &part{path: filepath.Join(p.dir, base+".rpc.json"), dir: p.dir, manifest: true})
+		}
+		if o.Avro {
+			parts = append(parts, &part{path: filepath.Join(p.dir, base+".avsc"), dir: p.dir, avro: true})
+		}
+		if o.Thrift {
+			parts = append(parts, &part{path: filepath.Join(p.dir, base+".thrift"), dir: p.dir, thrift: true})
+		}
+		break
+	}
+	return parts
 }
-{{end}}`
 
-var usage = `usage: %s --source=<source.go> --type=<interface_type_name>
+// stubParts returns the files of the stubs themselves.
+func (o *Options) stubParts() []*part {
+	server, client := o.Mode != ModeClient, o.Mode != ModeServer
+	if !o.multiFile() {
+		return []*part{{path: o.Target, dir: filepath.Dir(o.Target), types: true, server: server, client: client}}
+	}
+	outputDir := filepath.Dir(o.Source)
+	if o.OutputDir != "" {
+		outputDir = o.OutputDir
+	}
+	clientDir, serverDir := outputDir, outputDir
+	if o.ClientPackage != "" {
+		clientDir = o.ClientPackage
+	}
+	if o.ServerPackage != "" {
+		serverDir = o.ServerPackage
+	}
+	shared := o.Split || (client && server && filepath.Clean(clientDir) == filepath.Clean(serverDir))
+	var parts []*part
+	dirs := map[string]bool{}
+	if client {
+		parts = append(parts, &part{path: filepath.Join(clientDir, o.outputName("_client.gen.go")), dir: clientDir, types: !shared, client: true})
+		dirs[filepath.Clean(clientDir)] = true
+	}
+	if server {
+		parts = append(parts, &part{path: filepath.Join(serverDir, o.outputName("_server.gen.go")), dir: serverDir, types: !shared, server: true})
+		dirs[filepath.Clean(serverDir)] = true
+	}
+	if shared {
+		for _, dir := range []string{clientDir, serverDir} {
+			if dirs[filepath.Clean(dir)] {
+				delete(dirs, filepath.Clean(dir))
+				parts = append(parts, &part{path: filepath.Join(dir, o.outputName("_types.gen.go")), dir: dir, types: true})
+			}
+		}
+	}
+	return parts
+}
 
-This utility generates server and client RPC stubs from a Go interface.
+// Outputs returns the paths of the files generated for the options.
+func (o *Options) Outputs() []string {
+	var outputs []string
+	for _, part := range o.parts() {
+		outputs = append(outputs, part.path)
+	}
+	return outputs
+}
 
-If you had a file "arith.go" containing this interface:
+func main() {
+	args := os.Args[1:]
+	if isVetInvocation(args) {
+		unitchecker.Main(analyzer)
+	}
+	name := "generate"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	} else if len(args) > 0 && isHelpFlag(args[0]) {
+		name = "help"
+	}
+	cmd := findCommand(name)
+	if cmd == nil {
+		errorf("unknown command %q", name)
+		printUsage()
+		os.Exit(2)
+	}
+	args, _ = parseArgs(cmd.flags, args)
+	if diagnosticsFormat != DiagnosticsText && diagnosticsFormat != DiagnosticsJSON {
+		fatalf("invalid diagnostics format %q, expected %s or %s", diagnosticsFormat, DiagnosticsText, DiagnosticsJSON)
+	}
+	if err := cmd.run(args); err != nil {
+		if err != errFailed {
+			report(err)
+		}
+		os.Exit(1)
+	}
+}
 
-  package arith
+// File is a generated source file.
+type File struct {
+	Path    string
+	Content []byte
+}
 
-  type Arith interface {
-  	Add(a, b int)
-  }
+// parse parses the source file and returns the model of the requested
+// interface, with all parts of the stubs enabled according to the mode.
+func parse(opts *Options) (*RPCGen, *ast.File, error) {
+	defer timed("parsing "+opts.Source, time.Now())
+	filename := opts.Source
+	var src []byte
+	var err error
+	if opts.Source == stdio {
+		filename = "<stdin>"
+		src, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		src, err = ioutil.ReadFile(opts.Source)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %s", filename, err)
+	}
+	fileset, f, err := parseSource(filename, src)
+	if _, ok := err.(scanner.ErrorList); ok {
+		return nil, nil, err
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %s", opts.Source, err)
+	}
+	imports := map[string]string{}
+	for _, imp := range opts.Imports {
+		namedImport := strings.Split(imp, "=")
+		name, path := "", namedImport[len(namedImport)-1]
+		if len(namedImport) == 2 {
+			name = namedImport[0]
+		}
+		if len(namedImport) > 2 || !validImportPath(path) || (name != "" && name != "." && !token.IsIdentifier(name)) {
+			return nil, nil, posError(token.Position{}, CodeBadImport, "invalid import %q", imp)
+		}
+		imports[path] = name
+	}
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = f.Name.Name
+	}
+	header, err := loadHeader(opts.HeaderFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	buildTags := opts.BuildTags
+	if buildTags == "" {
+		buildTags = sourceConstraint(opts.Source, src)
+	}
+	gen := &RPCGen{
+		Service:        opts.serviceName(),
+		ServiceVersion: opts.ServiceVersion,
+		Type:           opts.Type,
+		Interface:      opts.Type,
+		RPCType:        opts.RPCClientType,
+		ClientClose:    opts.ClientClose,
+		Pool:           opts.Pool,
+		BinaryCodec:    opts.BinaryCodec,
+		Msgp:           opts.Msgp,
+		Easyjson:       opts.Easyjson,
+		Dispatch:       opts.Dispatch,
+		JobTTL:         opts.JobTTL,
+		MaxJobs:        opts.MaxJobs,
+		Expvar:         opts.Expvar,
+		PprofLabels:    opts.PprofLabels,
+		WireDump:       opts.WireDump,
+		Health:         opts.Health,
+		Runner:         opts.Runner,
+		Handshake:      opts.Handshake,
+		LogDeprecated:  opts.LogDeprecated,
+		SSH:            opts.SSH,
+		ServerOptions:  opts.ServerOptions,
+		ClientOptions:  opts.ClientOptions,
+		Stringer:       opts.Stringer,
+		JSONNaming:     opts.JSONNaming,
+		HMAC:           opts.HMAC,
+		NaCl:           opts.NaCl,
+		Transport:      opts.Transport,
+		Faults:         opts.Faults,
+		Combined:       opts.Combined,
+		Package:        pkg,
+		Imports:        imports,
+		Types:          true,
+		Server:         opts.Mode != ModeClient,
+		Client:         opts.Mode != ModeServer,
+		BuildTags:      buildTags,
+		Header:         header,
+		Version:        versionString(),
+		fileset:        fileset,
+		comments:       f.Comments,
+		userImports:    imports,
+		mappings:       opts.WireTypes,
+	}
+	for _, spec := range interfaceSpecs(f) {
+		debugf("%s: found interface %s", fileset.Position(spec.Pos()), spec.Name.Name)
+	}
+	gen.handles = handleInterfaces(f)
+	gen.Handle = gen.handles[opts.Type]
+	gen.enums = gen.sourceEnums(f)
+	ast.Walk(gen, f)
+	switch {
+	case len(gen.errs) == 1:
+		return nil, nil, gen.errs[0]
+	case len(gen.errs) > 1:
+		return nil, nil, Diagnostics(gen.errs)
+	}
+	gen.Enums = usedEnums(gen.enums, gen.Methods)
+	if opts.Dispatch {
+		for _, name := range []string{"Dispatch", "NewMessages"} {
+			if gen.HasMethod(name) {
+				return nil, nil, fmt.Errorf("method %s of %s clashes with the service method added by --dispatch", name, opts.Type)
+			}
+		}
+	}
+	if opts.Handshake && gen.HasMethod("Handshake") {
+		return nil, nil, fmt.Errorf("method Handshake of %s clashes with the method added by --handshake", opts.Type)
+	}
+	if opts.Health && gen.HasMethod("HealthMux") {
+		return nil, nil, fmt.Errorf("method HealthMux of %s clashes with the service method added by --health", opts.Type)
+	}
+	if gen.Handle {
+		for _, name := range []string{"Release", "ReleaseHandle"} {
+			if gen.HasMethod(name) {
+				return nil, nil, fmt.Errorf("method %s of %s clashes with the method releasing handles", name, opts.Type)
+			}
+		}
+		if gen.HasJobs() {
+			return nil, nil, fmt.Errorf("%s objects are served through handles, and can't run jobs", opts.Type)
+		}
+		for _, m := range gen.Methods {
+			for _, t := range m.Parameters {
+				for _, name := range t.Names {
+					if name == "Handle" {
+						return nil, nil, fmt.Errorf("field Handle of the request of method %s of %s clashes with the handle of the object", m.Name, opts.Type)
+					}
+				}
+			}
+		}
+	}
+	for _, m := range gen.Methods {
+		if !m.Dedup {
+			continue
+		}
+		for _, t := range m.Parameters {
+			for _, name := range t.Names {
+				if name == "IdempotencyKey" {
+					return nil, nil, fmt.Errorf("field IdempotencyKey of the request of method %s of %s clashes with its idempotency key", m.Name, opts.Type)
+				}
+			}
+		}
+	}
+	for _, m := range gen.Methods {
+		if m.Job && m.HasHandles() {
+			return nil, nil, fmt.Errorf("method %s of %s returns objects served through handles, and can't be a job", m.Name, opts.Type)
+		}
+	}
+	for _, m := range gen.Methods {
+		if opts.Stringer || m.Secret {
+			for _, t := range append(append([]*Type{}, m.Parameters...), m.Results...) {
+				for _, name := range t.Names {
+					if name == "String" {
+						return nil, nil, fmt.Errorf("field String of the request or response of method %s of %s clashes with the String method of the structure", m.Name, opts.Type)
+					}
+				}
+			}
+		}
+	}
+	for _, m := range gen.Methods {
+		for _, fields := range [][]*Type{m.Parameters, m.Results} {
+			tags := map[string]string{}
+			for _, t := range fields {
+				for _, name := range t.Names {
+					tag := jsonName(opts.JSONNaming, name)
+					if other, ok := tags[tag]; ok {
+						return nil, nil, fmt.Errorf("fields %s and %s of method %s of %s have the same JSON name %s", other, name, m.Name, opts.Type, tag)
+					}
+					tags[tag] = name
+				}
+			}
+		}
+	}
+	for _, m := range gen.Methods {
+		if !m.Job {
+			continue
+		}
+		for _, name := range jobMethods(m.Name) {
+			if gen.HasMethod(name) {
+				return nil, nil, fmt.Errorf("method %s of %s clashes with the job method generated for %s", name, opts.Type, m.Name)
+			}
+		}
+	}
+	if opts.Name != "" {
+		gen.Type = opts.Name
+	}
+	for _, m := range gen.Methods {
+		m.avoidNames(clientIdentifiers(gen.Type, m.Name)...)
+	}
+	if opts.SortMethods {
+		sort.SliceStable(gen.Methods, func(i, j int) bool { return gen.Methods[i].Name < gen.Methods[j].Name })
+	}
+	gen.Imports = mergeImports(imports, gen.typeImports)
+	gen.SourceHash = gen.sourceHash()
+	return gen, f, nil
+}
 
-The following command will generate stubs for the interface:
+// render parses the source file and returns the model of the requested
+// interface and its formatted RPC stubs.
+func render(opts *Options) (*RPCGen, []*File, error) {
+	defer timed("generating stubs for "+opts.Type, time.Now())
+	gen, f, err := parse(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	imports := gen.userImports
+	backend, err := newBackend(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The service only refers to types declared in the generated files, so
+	// the imports needed for parameter types are only added where the client
+	// or the request and response types are generated.
+	var files []*File
+	var q *qualifier
+	var sideFiles []string
+	for _, p := range opts.parts() {
+		if p.manifest || p.avro || p.thrift {
+			sideFiles = append(sideFiles, filepath.Base(p.path))
+		}
+	}
+	for _, p := range opts.parts() {
+		if p.manifest || p.avro || p.thrift {
+			var content []byte
+			switch {
+			case p.manifest:
+				content, err = gen.manifest(f.Name.Name)
+			case p.avro:
+				content, err = gen.avro(f)
+			default:
+				content, err = gen.thrift(f)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			files = append(files, &File{Path: p.path, Content: content})
+			continue
+		}
+		part := *gen
+		part.Types, part.Server, part.Client = p.types, p.server, p.client
+		part.Benchmarks = p.benchmarks
+		if p.types {
+			part.SideFiles = sideFiles
+		}
+		var partImports []map[string]string
+		if p.benchmarks {
+			partImports = append(partImports, benchmarkImports)
+		}
+		if p.server || p.client {
+			partImports = append(partImports, imports)
+		}
+		if p.types || p.client {
+			partImports = append(partImports, gen.typeImports)
+		}
+		if p.client && opts.SSH {
+			partImports = append(partImports, sshImports)
+		}
+		if (p.client && (opts.HMAC || gen.HasDedup())) || (p.server && (gen.Handle || gen.HasJobs())) {
+			partImports = append(partImports, cryptoRandImports)
+		}
+		if p.types && opts.NaCl {
+			partImports = append(partImports, naclImports)
+		}
+		// Files written to another directory, or next to the source but
+		// in another package, such as an external test package, refer to
+		// the source package by its import path.
+		foreign := !sameDir(p.dir, filepath.Dir(opts.Source)) || (opts.Source != stdio && opts.Package != "" && opts.Package != f.Name.Name)
+		if foreign {
+			if q == nil {
+				if q, err = newQualifier(f, filepath.Dir(opts.Source)); err != nil {
+					return nil, nil, err
+				}
+			}
+			if opts.Package == "" {
+				if part.Package, err = packageName(p.dir); err != nil {
+					return nil, nil, err
+				}
+			}
+			methods, qualified, err := q.methods(gen.Methods)
+			if err != nil {
+				return nil, nil, nodeError(gen.fileset, f.Name, CodeUnexportedType, "%s", err)
+			}
+			part.Methods = methods
+			if part.Enums, err = q.enums(gen.Enums); err != nil {
+				return nil, nil, nodeError(gen.fileset, f.Name, CodeUnexportedType, "%s", err)
+			}
+			qualified = qualified || len(part.Enums) > 0
+			if p.server {
+				part.Interface = q.name + "." + opts.Type
+			}
+			if p.server || (qualified && (p.types || p.client)) {
+				partImports = append(partImports, q.imports())
+			}
+		}
+		part.Imports = mergeImports(partImports...)
+		if q != nil && !sameDir(p.dir, filepath.Dir(opts.Source)) {
+			// The package generated into may be in another module.
+			if err := checkResolvable(p.dir, part.Imports); err != nil {
+				return nil, nil, err
+			}
+		}
+		out, err := backend.Render(&part, p.path)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, out...)
+	}
+	if err := checkCollisions(files); err != nil {
+		return nil, nil, err
+	}
+	return gen, files, nil
+}
 
-  ./%s --source=arith.go --type=Arith
+// execute renders gen with t.
+func execute(t *template.Template, gen *RPCGen) ([]byte, error) {
+	var out bytes.Buffer
+	if err := t.Execute(&out, gen); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
 
-That will generate a file containing two types, ArithService and ArithClient,
-that can be used with the Go RPC system, and as a client for the system,
-respectively.
+func mergeImports(imports ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, m := range imports {
+		for path, name := range m {
+			merged[path] = name
+		}
+	}
+	return merged
+}
 
-Flags:
-`
+// formatSource formats src like goimports would for a file at path: unused
+// imports are removed and missing ones for referenced packages are added.
+// With FormatGofumpt the stricter gofumpt rules are applied on top. Source
+// that fails to parse is reported at its position in the generated file,
+// since it means the template is broken.
+func formatSource(path string, src []byte, style string) ([]byte, error) {
+	out, err := imports.Process(path, src, &imports.Options{Comments: true, TabIndent: true, TabWidth: 8})
+	if list, ok := err.(scanner.ErrorList); ok && len(list) > 0 {
+		return nil, syntaxError(list, CodeInvalidOutput, "generated code is invalid: %s")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %s", err)
+	}
+	if style == FormatGofumpt {
+		if out, err = gofumpt.Source(out, gofumpt.Options{}); err != nil {
+			return nil, fmt.Errorf("failed to format generated code: %s", err)
+		}
+	}
+	return out, nil
+}
 
-var source = flag.String("source", "", "source file to parse RPC interface from")
-var rpcType = flag.String("type", "", "type to generate RPC interface from")
-var target = flag.String("target", "", "target file to write stubs to")
-var importsFlag = flag.String("imports", "net/rpc", "list of imports to add")
-var packageFlag = flag.String("package", "", "package to export under")
-var serviceName = flag.String("service", "", "service name to use (defaults to type name)")
-var rpcClientTypeFlag = flag.String("rpc_client_type", "*rpc.Client", "type to use for RPC client interfaces")
+// rendered is the outcome of rendering the stubs of a target.
+type rendered struct {
+	gen   *RPCGen
+	files []*File
+	// warnings are problems that don't prevent generating the stubs.
+	warnings []error
+	err      error
+}
 
-func main() {
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, usage, os.Args[0], os.Args[0])
-		flag.PrintDefaults()
+// renderAll renders the stubs of targets with up to jobs of them in
+// parallel, and checks their gob compatibility. The outcome of each target
+// is at its index. Targets writing a file an earlier one writes fail, rather
+// than overwrite its stubs.
+func renderAll(targets []*Options, jobs int) []rendered {
+	results := make([]rendered, len(targets))
+	if jobs < 1 {
+		jobs = 1
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for j := 0; j < jobs && j < len(targets); j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				r := &results[i]
+				if r.gen, r.files, r.err = render(targets[i]); r.err == nil {
+					r.warnings = gobWarnings(targets[i].Source, targets[i].Type)
+				}
+			}
+		}()
 	}
-	flag.Parse()
-	if *source == "" || *rpcType == "" {
-		fatalf("expected --source and --type")
+	for i := range targets {
+		indexes <- i
 	}
-	if *target == "" {
-		parts := strings.Split(*source, ".")
-		parts = parts[:len(parts)-1]
-		*target = strings.Join(parts, ".") + "rpc.go"
+	close(indexes)
+	wg.Wait()
+	written := map[string]string{}
+	for i := range results {
+		r := &results[i]
+		for _, file := range r.files {
+			if other, ok := written[file.Path]; ok && file.Path != stdio {
+				r.gen, r.files, r.err = nil, nil, fileError(file.Path, CodeTargetClash, "is generated for both %s and %s", other, targets[i].Type)
+				break
+			}
+		}
+		for _, file := range r.files {
+			written[file.Path] = targets[i].Type
+		}
 	}
+	return results
+}
 
-	fileset := token.NewFileSet()
-	f, err := parser.ParseFile(fileset, *source, nil, 0)
+// generateAll generates the stubs of targets, rendering up to jobs of them
+// in parallel, then the combined clients they join. Files are written and
+// errors reported in the order of targets, so the output doesn't depend on
+// scheduling. It returns the summary of the run, which counts the targets
+// that failed. Files existing at the paths written to must have been
+// generated by go-rpcgen, unless force is set.
+func generateAll(targets []*Options, jobs int, force bool) *summary {
+	s := &summary{Interfaces: []*interfaceSummary{}}
+	results := renderAll(targets, jobs)
+	for i, r := range results {
+		for _, warning := range r.warnings {
+			report(warning)
+		}
+		err := r.err
+		if err == nil {
+			err = write(targets[i].Type, r.files, force)
+		}
+		s.add(targets[i], r.gen, r.files, err)
+		if err != nil {
+			report(err)
+		}
+	}
+	clients, err := combinedClients(targets, results)
 	if err != nil {
-		fatalf("failed to parse %s: %s", *source, err)
+		report(err)
+		s.Failed++
+		return s
 	}
-	imports := map[string]string{}
-	if *importsFlag != "" {
-		for _, imp := range strings.Split(*importsFlag, ",") {
-			namedImport := strings.Split(imp, "=")
-			if len(namedImport) == 2 {
-				imports[namedImport[1]] = namedImport[0]
-			} else {
-				imports[imp] = ""
+	for _, c := range clients {
+		err := write(c.Name, []*File{c.file}, force)
+		s.addCombined(c, err)
+		if err != nil {
+			report(err)
+		}
+	}
+	return s
+}
+
+// write writes the files rendered for the interface or combined client name.
+// Unless force is set, nothing is written if one of the files would replace a
+// Go file not generated by go-rpcgen, such as a hand-written file with a
+// similar name.
+func write(name string, files []*File, force bool) error {
+	for _, file := range files {
+		if force || file.Path == stdio || !strings.HasSuffix(file.Path, ".go") {
+			continue
+		}
+		info, err := os.Stat(file.Path)
+		if os.IsNotExist(err) || (err == nil && info.Size() == 0) {
+			continue
+		}
+		if generated, err := isGenerated(file.Path); err != nil {
+			return err
+		} else if !generated {
+			return fileError(file.Path, CodeNotGenerated, "exists and was not generated by go-rpcgen, not overwriting it")
+		}
+	}
+	for _, file := range files {
+		if file.Path == stdio {
+			if _, err := os.Stdout.Write(file.Content); err != nil {
+				return fmt.Errorf("failed to write to stdout: %s", err)
 			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(file.Path), 0777); err != nil {
+			return fmt.Errorf("failed to create output directory: %s", err)
 		}
+		if err := writeFile(file.Path, file.Content); err != nil {
+			return fmt.Errorf("failed to write output file %s: %s", file.Path, err)
+		}
+		infof("wrote RPC stubs for %s to %s", name, file.Path)
 	}
-	if *packageFlag == "" {
-		*packageFlag = f.Name.Name
+	return nil
+}
+
+// writeFile writes content to path through a temporary file in the same
+// directory, renamed to path once complete, so that path holds either its
+// previous content or content, never part of it. An existing file keeps its
+// permissions.
+func writeFile(path string, content []byte) error {
+	tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.%d.tmp", filepath.Base(path), os.Getpid()))
+	perm, keep := os.FileMode(0666), false
+	if info, err := os.Stat(path); err == nil {
+		perm, keep = info.Mode().Perm(), true
 	}
-	if *serviceName == "" {
-		*serviceName = *rpcType
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
 	}
-	gen := &RPCGen{
-		Service: *serviceName,
-		Type:    *rpcType,
-		RPCType: *rpcClientTypeFlag,
-		Package: *packageFlag,
-		Imports: imports,
-		fileset: fileset,
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
 	}
-	ast.Walk(gen, f)
-	funcs := map[string]interface{}{
-		"publicfields":         func(fields []*Type) string { return FieldList(fields, "", "\n\t", true, true) },
-		"refswithprefix":       func(prefix string, fields []*Type) string { return FieldList(fields, prefix, ", ", false, false) },
-		"publicrefswithprefix": func(prefix string, fields []*Type) string { return FieldList(fields, prefix, ", ", false, true) },
-		"functionargs":         func(fields []*Type) string { return FieldList(fields, "", ", ", true, false) },
+	if err == nil && keep {
+		err = os.Chmod(tmp, perm)
 	}
-	t, err := template.New("rpc").Funcs(funcs).Parse(rpcTemplate)
-	if err != nil {
-		fatalf("failed to parse template: %s", err)
+	if err == nil {
+		err = os.Rename(tmp, path)
 	}
-	out, err := os.Create(*target)
 	if err != nil {
-		fatalf("failed to create output file %s: %s", *target, err)
+		os.Remove(tmp)
 	}
-	err = t.Execute(out, gen)
-	if err != nil {
-		fatalf("failed to execute template: %s", err)
+	return err
+}
+
+// watchInterval is how often the source packages are polled in watch mode.
+const watchInterval = 100 * time.Millisecond
+
+// watch regenerates the stubs whenever a Go file in one of the source
+// packages changes. Changes are debounced so that a burst of saves triggers a
+// single regeneration, and failures are reported without stopping the loop,
+// which only ends once stop is closed.
+func watch(targets []*Options, debounce time.Duration, jobs int, force bool, stop <-chan struct{}) {
+	regenerate := func() {
+		generateAll(targets, jobs, force)
 	}
-	fmt.Printf("%s: wrote RPC stubs for %s to %s\n", os.Args[0], *rpcType, *target)
-	if out, err := exec.Command("go", "fmt", *target).CombinedOutput(); err != nil {
-		fatalf("failed to run go fmt on %s: %s: %s", *target, err, string(out))
+	regenerate()
+	last := snapshot(targets)
+	var changed time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(watchInterval):
+		}
+		current := snapshot(targets)
+		if !sameSnapshot(last, current) {
+			last = current
+			changed = time.Now()
+			continue
+		}
+		if !changed.IsZero() && time.Since(changed) >= debounce {
+			changed = time.Time{}
+			regenerate()
+			last = snapshot(targets)
+		}
 	}
 }
 
-func fatalf(format string, args ...interface{}) {
+// snapshot returns the modification times of the Go files in the source
+// packages of targets, excluding the generated files themselves.
+func snapshot(targets []*Options) map[string]time.Time {
+	generated := map[string]bool{}
+	dirs := map[string]bool{}
+	for _, opts := range targets {
+		for _, output := range opts.Outputs() {
+			abs, _ := filepath.Abs(output)
+			generated[abs] = true
+		}
+		dirs[filepath.Dir(opts.Source)] = true
+	}
+	files := map[string]time.Time{}
+	for dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+		for _, m := range matches {
+			if abs, _ := filepath.Abs(m); generated[abs] {
+				continue
+			}
+			if info, err := os.Stat(m); err == nil {
+				files[m] = info.ModTime()
+			}
+		}
+	}
+	return files
+}
+
+func sameSnapshot(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, mtime := range a {
+		if other, ok := b[name]; !ok || !other.Equal(mtime) {
+			return false
+		}
+	}
+	return true
+}
+
+func errorf(format string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, "%s: error: %s\n", os.Args[0], fmt.Sprintf(format, args...))
-	os.Exit(1)
 }
 
-func fatalNode(fileset *token.FileSet, node ast.Node, format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, "%s: error: %s: %s\n", os.Args[0], fileset.Position(node.Pos()).String(), fmt.Sprintf(format, args...))
+func fatalf(format string, args ...interface{}) {
+	errorf(format, args...)
 	os.Exit(1)
 }
 
+// Type is a group of parameters or results of a method sharing a type, such
+// as "a, b int". It is part of the data model passed to templates.
 type Type struct {
-	Names      []string
-	LowerNames []string
-	Type       string
+	// Names are the exported names used for the fields of the request and
+	// response structures, e.g. "A", "B".
+	Names []string `json:"names"`
+	// LowerNames are the names as declared in the interface, e.g. "a", "b".
+	LowerNames []string `json:"lowerNames"`
+	// Type is the Go type expression, e.g. "int" or "arith.Matrix".
+	Type string `json:"type"`
+	// Handle is the name of the interface of the results of the group if
+	// their objects are served through handles, as marked by the
+	// //rpcgen:handle directive.
+	Handle string `json:"handle,omitempty"`
+	// Enum is the name of the enum type of the group, or of the type it
+	// points to, if any.
+	Enum string `json:"enum,omitempty"`
+	// Unix is the unit of the Unix time a time.Time group is sent as, as
+	// set by //rpcgen:unix and //rpcgen:unixmilli directives: seconds or
+	// milliseconds. Such groups have a single name.
+	Unix string `json:"unix,omitempty"`
+	// Mapping is how values of the type of the group are sent, if the
+	// wire_types option maps it to another type.
+	Mapping *TypeMapping `json:"mapping,omitempty"`
+	expr    ast.Expr
+}
+
+// WireType returns the type of the request or response fields of the group:
+// uint64 for handles, int64 for Unix times, the type of the mapping of mapped
+// types, and otherwise Type.
+func (t *Type) WireType() string {
+	switch {
+	case t.Handle != "":
+		return "uint64"
+	case t.Unix != "":
+		return "int64"
+	case t.Mapping != nil:
+		return t.Mapping.Type
+	}
+	return t.Type
 }
 
+// NamesString returns Names separated by commas.
 func (t *Type) NamesString() string {
 	return strings.Join(t.Names, ", ")
 }
 
+// LowerNamesString returns LowerNames separated by commas.
 func (t *Type) LowerNamesString() string {
 	return strings.Join(t.LowerNames, ", ")
 }
 
+// Method is a method of the interface. It is part of the data model passed to
+// templates.
 type Method struct {
-	Name       string
-	Parameters []*Type
-	Results    []*Type
+	Name string `json:"name"`
+	// Parameters are the parameters of the method.
+	Parameters []*Type `json:"parameters"`
+	// Results are the results of the method, excluding the final error.
+	Results []*Type `json:"results"`
+	// Notify reports whether the client sends calls of the method without
+	// waiting for the reply, as marked by the //rpcgen:notify directive.
+	Notify bool `json:"notify,omitempty"`
+	// Job reports whether the service can run the method as a job, as
+	// marked by the //rpcgen:job directive.
+	Job bool `json:"job,omitempty"`
+	// Dedup reports whether the request of the method carries an
+	// idempotency key, as marked by the //rpcgen:dedup directive.
+	Dedup bool `json:"dedup,omitempty"`
+	// Deprecated is the message of the //rpcgen:deprecated directive of the
+	// method, if any, telling what to use instead.
+	Deprecated string `json:"deprecated,omitempty"`
+	// Redacted are the names of the request and response fields whose
+	// values String methods hide, as listed by //rpcgen:redact and
+	// //rpcgen:secret directives.
+	Redacted []string `json:"redacted,omitempty"`
+	// Secret reports whether some of the redacted fields hold secrets, as
+	// listed by //rpcgen:secret directives, so that the request and response
+	// structures have String methods regardless of --stringer.
+	Secret bool `json:"secret,omitempty"`
+	// Validations map request fields to their validation rules, as given by
+	// //rpcgen:validate directives.
+	Validations map[string]string `json:"validations,omitempty"`
+	// Limits are the limits on the sizes of request fields, as given by
+	// //rpcgen:max and //rpcgen:maxlen directives.
+	Limits []*Limit `json:"limits,omitempty"`
+	// Defaults are the values of the pointer request fields the service
+	// sets when clients leave them nil, as given by //rpcgen:default
+	// directives.
+	Defaults []*Default `json:"defaults,omitempty"`
+	// OmitEmpty are the names of the request and response fields whose
+	// json tags have the omitempty option, as listed by //rpcgen:omitempty
+	// directives.
+	OmitEmpty []string `json:"omitEmpty,omitempty"`
+	// Scopes are the scopes a caller needs to call the method, as given by
+	// //rpcgen:scope directives.
+	Scopes []string `json:"scopes,omitempty"`
+	// Timeout is the default deadline of the calls of the method, as given
+	// by the //rpcgen:timeout directive, if any.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Priority is the priority of the calls of the method, PriorityHigh or
+	// PriorityLow, as given by the //rpcgen:priority directive, if any.
+	Priority string `json:"priority,omitempty"`
+	// FieldIDs are the IDs of the Thrift fields of parameters and results
+	// given by the //rpcgen:field directive, by name as declared. The others
+	// have IDs derived from their names.
+	FieldIDs map[string]int `json:"fieldIDs,omitempty"`
+}
+
+// HasHandles reports whether some results of the method are objects served
+// through handles.
+func (m *Method) HasHandles() bool {
+	for _, t := range m.Results {
+		if t.Handle != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasConversions reports whether some parameters or results of the method
+// are sent as another type, which WireType returns: objects served through
+// handles and Unix times. The service calls the implementation through a
+// method converting them, and the client converts them itself.
+func (m *Method) HasConversions() bool {
+	for _, t := range append(append([]*Type{}, m.Parameters...), m.Results...) {
+		if t.WireType() != t.Type {
+			return true
+		}
+	}
+	return false
 }
 
+// HasEnums reports whether some parameters of the method are enums, which
+// the service checks the values of.
+func (m *Method) HasEnums() bool {
+	for _, t := range m.Parameters {
+		if t.Enum != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasChecks reports whether the service sets defaults or checks values in
+// requests of the method before calling it.
+func (m *Method) HasChecks() bool {
+	return len(m.Defaults) > 0 || len(m.Limits) > 0 || m.HasEnums()
+}
+
+// OmitsEmpty reports whether JSON encoders leave out the request or response
+// field name when empty.
+func (m *Method) OmitsEmpty(name string) bool {
+	for _, field := range m.OmitEmpty {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacts reports whether String methods hide the value of the request or
+// response field name.
+func (m *Method) Redacts(name string) bool {
+	for _, redacted := range m.Redacted {
+		if redacted == name {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIdentifiers returns the identifiers the built-in template declares or
+// refers to in the body of the client method name, besides its parameters and
+// results: the receiver, the locals, the request and response types and their
+// pools.
+func clientIdentifiers(typeName, name string) []string {
+	prefix := typeName + name
+	return []string{"_c", "_request", "_response", "err", "closeErr", "_call", "_job", "_attempt", prefix + "Request", prefix + "Response", "_" + prefix + "RequestPool", "_" + prefix + "ResponsePool"}
+}
+
+// avoidNames renames the parameters and results of m named like one of
+// names, by appending underscores, so that they don't shadow identifiers of
+// the generated code. Only the names used in the client method signature
+// change, not the exported names of the request and response fields.
+func (m *Method) avoidNames(names ...string) {
+	used := map[string]bool{}
+	for _, name := range names {
+		used[name] = true
+	}
+	fields := append(append([]*Type{}, m.Parameters...), m.Results...)
+	for _, t := range fields {
+		for _, name := range t.LowerNames {
+			used[name] = true
+		}
+	}
+	for _, name := range names {
+		for _, t := range fields {
+			for j, lowerName := range t.LowerNames {
+				if lowerName != name {
+					continue
+				}
+				for used[lowerName] {
+					lowerName += "_"
+				}
+				used[lowerName] = true
+				t.LowerNames[j] = lowerName
+			}
+		}
+	}
+}
+
+// FieldList joins the names of fields with delim, optionally prefixing each
+// name, following each group with its type and using the exported names,
+// which are those of the request and response fields, typed as sent. It backs
+// the field list functions available to templates.
 func FieldList(fields []*Type, prefix string, delim string, withTypes bool, public bool) string {
 	var out []string
 	for _, p := range fields {
 		suffix := ""
-		if withTypes {
+		if withTypes && public {
+			suffix = " " + p.WireType()
+		} else if withTypes {
 			suffix = " " + p.Type
 		}
 		names := p.LowerNames
@@ -252,21 +1414,260 @@ func FieldList(fields []*Type, prefix string, delim string, withTypes bool, publ
 	return strings.Join(out, delim)
 }
 
+// RPCGen describes the interface stubs are generated for, and is the data
+// passed to templates. It is rendered once per generated file.
 type RPCGen struct {
-	Service      string
-	Type         string
-	Package      string
-	Methods      []*Method
-	Imports      map[string]string
-	RPCType      string
+	// Service is the name the service is registered under, including its
+	// version, if any.
+	Service string `json:"service"`
+	// ServiceVersion is the version of the service (--service-version), if
+	// any.
+	ServiceVersion string `json:"serviceVersion,omitempty"`
+	// Type is the name of the interface type, used to name the generated
+	// types.
+	Type string `json:"type"`
+	// Interface is the interface type expression, qualified with the source
+	// package name when the file belongs to another package.
+	Interface string `json:"interface"`
+	// Package is the name of the package of the generated file.
+	Package string `json:"package"`
+	// Methods are the methods of the interface, including those of embedded
+	// interfaces, in declaration order.
+	Methods []*Method `json:"methods"`
+	// Imports maps the import paths needed by the file to their names, or
+	// to "" for the default name.
+	Imports map[string]string `json:"imports"`
+	// RPCType is the type of the RPC client used by the generated client.
+	RPCType string `json:"rpcType"`
+	// ClientClose is the name of the client method closing the connection.
+	ClientClose string `json:"clientClose"`
+	// Pool reports whether the client reuses its request and response
+	// structures.
+	Pool bool `json:"pool"`
+	// BinaryCodec reports whether the request and response structures get
+	// reflection-free binary encoding methods.
+	BinaryCodec bool `json:"binaryCodec"`
+	// Msgp reports whether the file runs msgp on the request and response
+	// structures.
+	Msgp bool `json:"msgp"`
+	// Easyjson reports whether the file runs easyjson on the request and
+	// response structures.
+	Easyjson bool `json:"easyjson"`
+	// Dispatch reports whether the service gets methods calling the others
+	// by name.
+	Dispatch bool `json:"dispatch"`
+	// JobTTL is how long the service keeps uncollected job results.
+	JobTTL time.Duration `json:"jobTTL"`
+	// MaxJobs is how many jobs the service keeps at once.
+	MaxJobs int `json:"maxJobs"`
+	// Expvar reports whether the service publishes call statistics.
+	Expvar bool `json:"expvar"`
+	// PprofLabels reports whether the service labels its calls for pprof.
+	PprofLabels bool `json:"pprofLabels"`
+	// WireDump reports whether the client can dump its traffic.
+	WireDump bool `json:"wireDump"`
+	// Health reports whether the service serves health probes over HTTP.
+	Health bool `json:"health"`
+	// Runner reports whether the file has a function running the server.
+	Runner bool `json:"runner"`
+	// Handshake reports whether the stubs check that they were generated
+	// from the same interface, by comparing SourceHash.
+	Handshake bool `json:"handshake"`
+	// LogDeprecated reports whether the service logs calls of deprecated
+	// methods.
+	LogDeprecated bool `json:"logDeprecated"`
+	// SSH reports whether the client can be dialed through an SSH
+	// connection.
+	SSH bool `json:"ssh"`
+	// ServerOptions reports whether the service constructors take options.
+	ServerOptions bool `json:"serverOptions"`
+	// ClientOptions reports whether the client constructors take options.
+	ClientOptions bool `json:"clientOptions"`
+	// Stringer reports whether the request and response structures have
+	// String methods.
+	Stringer bool `json:"stringer"`
+	// JSONNaming is the naming strategy of the json tags of the request and
+	// response fields (--json-naming).
+	JSONNaming string `json:"jsonNaming"`
+	// HMAC reports whether clients can sign their requests, and the service
+	// be served to such clients only.
+	HMAC bool `json:"hmac"`
+	// NaCl reports whether the client and the service can encrypt their
+	// connections.
+	NaCl bool `json:"nacl"`
+	// Transport reports whether the client and the service can use
+	// connections of a Transport interface.
+	Transport bool `json:"transport"`
+	// Faults reports whether implementations can be decorated with
+	// injected faults.
+	Faults bool `json:"faults"`
+	// Combined is the name of the combined client the client joins, if
+	// any.
+	Combined string `json:"combined,omitempty"`
+	// Handle reports whether the objects of the interface are served
+	// through handles returned by methods of other interfaces, as marked by
+	// the //rpcgen:handle directive.
+	Handle bool `json:"handle,omitempty"`
+	// Enums are the enum types of the parameters and results, sorted by
+	// name.
+	Enums []*Enum `json:"enums,omitempty"`
+	// Types, Server and Client report whether the request and response
+	// types, the service and the client are part of the file.
+	Types  bool `json:"types"`
+	Server bool `json:"server"`
+	Client bool `json:"client"`
+	// Benchmarks reports whether the file is the test file benchmarking the
+	// codecs on the request and response types, which is generated apart.
+	Benchmarks bool `json:"benchmarks"`
+	// BuildTags is the build constraint expression of the file, if any.
+	BuildTags string `json:"buildTags,omitempty"`
+	// Header is the commented banner to put at the top of the file, if any.
+	Header string `json:"header,omitempty"`
+	// Version is the version of go-rpcgen generating the file.
+	Version string `json:"version"`
+	// SourceHash identifies the interface the file is generated from. It
+	// changes whenever the service, the interface or its methods do.
+	SourceHash string `json:"sourceHash"`
+	// SideFiles are the names of the schema files, such as the Thrift
+	// definition, written next to the file holding the request and response
+	// types, so that clean can remove them with it.
+	SideFiles []string `json:"sideFiles,omitempty"`
+
 	fileset      *token.FileSet
-	CheckImports []*ast.ImportSpec
+	comments     []*ast.CommentGroup
+	checkImports []*ast.ImportSpec
+	userImports  map[string]string
+	typeImports  map[string]string
+	// handles are the interfaces of the source file marked by the
+	// //rpcgen:handle directive.
+	handles map[string]bool
+	// enums are the enum types declared in the source file, by name.
+	enums map[string]*Enum
+	// mappings are the types sent as others, as set by the wire_types
+	// option.
+	mappings map[string]*TypeMapping
+	errs     []error
+}
+
+// sourceHash returns a hash of the service, the interface and its methods.
+func (r *RPCGen) sourceHash() string {
+	data, err := json.Marshal(struct {
+		Service string
+		Type    string
+		Methods []*Method
+	}{r.Service, r.Type, r.Methods})
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// HasJobs reports whether any method of the interface can run as a job.
+func (r *RPCGen) HasJobs() bool {
+	for _, m := range r.Methods {
+		if m.Job {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleTypes returns the interfaces of the objects served through handles
+// methods of the interface return, sorted.
+func (r *RPCGen) HandleTypes() []string {
+	seen := map[string]bool{}
+	var types []string
+	for _, m := range r.Methods {
+		for _, t := range m.Results {
+			if t.Handle != "" && !seen[t.Handle] {
+				seen[t.Handle] = true
+				types = append(types, t.Handle)
+			}
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// HasScopes reports whether any method of the interface requires scopes.
+func (r *RPCGen) HasScopes() bool {
+	for _, m := range r.Methods {
+		if len(m.Scopes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTimeouts reports whether any method of the interface has a default
+// deadline.
+func (r *RPCGen) HasTimeouts() bool {
+	for _, m := range r.Methods {
+		if m.Timeout > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasDedup reports whether any method of the interface carries idempotency
+// keys.
+func (r *RPCGen) HasDedup() bool {
+	for _, m := range r.Methods {
+		if m.Dedup {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPriorities reports whether any method of the interface has a priority.
+func (r *RPCGen) HasPriorities() bool {
+	for _, m := range r.Methods {
+		if m.Priority != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasSecrets reports whether any method of the interface has parameters or
+// results holding secrets.
+func (r *RPCGen) HasSecrets() bool {
+	for _, m := range r.Methods {
+		if m.Secret {
+			return true
+		}
+	}
+	return false
+}
+
+// jobMethods returns the names of the service and client methods running
+// the method name as a job.
+func jobMethods(name string) []string {
+	return []string{"Start" + name, name + "Status", name + "Result", "Cancel" + name}
+}
+
+// HasMethod reports whether the interface has a method named name.
+func (r *RPCGen) HasMethod(name string) bool {
+	for _, m := range r.Methods {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fail records a problem found while walking the source. Walking goes on, so
+// that all the problems of the interface are reported together.
+func (r *RPCGen) fail(err error) {
+	r.errs = append(r.errs, err)
 }
 
 func (r *RPCGen) Visit(node ast.Node) (w ast.Visitor) {
 	switch n := node.(type) {
 	case *ast.ImportSpec:
-		r.CheckImports = append(r.CheckImports, n)
+		r.checkImports = append(r.checkImports, n)
 
 	case *ast.TypeSpec:
 		name := n.Name.Name
@@ -277,6 +1678,14 @@ func (r *RPCGen) Visit(node ast.Node) (w ast.Visitor) {
 	return r
 }
 
+// addTypeImport records an import needed by a parameter or result type.
+func (r *RPCGen) addTypeImport(path, name string) {
+	if r.typeImports == nil {
+		r.typeImports = map[string]string{}
+	}
+	r.typeImports[path] = name
+}
+
 type InterfaceGen struct {
 	*RPCGen
 }
@@ -291,26 +1700,149 @@ func (r *InterfaceGen) VisitMethodList(n *ast.InterfaceType) {
 				Results:    make([]*Type, 0),
 			}
 			for _, v := range t.Params.List {
-				method.Parameters = append(method.Parameters, r.formatType(r.fileset, v))
+				if name, ok := v.Type.(*ast.Ident); ok && r.handles[name.Name] {
+					r.fail(nodeError(r.fileset, v, CodeUnsupportedType, "%s objects are served through handles, and can only be results", name.Name))
+				}
+				param := r.formatType(r.fileset, v)
+				param.Enum = enumName(r.enums, v.Type)
+				param.Mapping = typeMapping(r.mappings, r.checkImports, v.Type)
+				method.Parameters = append(method.Parameters, param)
 			}
 			hasError := false
 			if t.Results != nil {
-				for _, v := range t.Results.List {
+				for i, v := range t.Results.List {
 					result := r.formatType(r.fileset, v)
-					if result.Type == "error" {
-						hasError = true
-					} else {
+					result.Enum = enumName(r.enums, v.Type)
+					result.Mapping = typeMapping(r.mappings, r.checkImports, v.Type)
+					if name, ok := v.Type.(*ast.Ident); ok && r.handles[name.Name] {
+						result.Handle = name.Name
+					}
+					switch {
+					case result.Type != "error":
 						method.Results = append(method.Results, result)
+					case i < len(t.Results.List)-1 || len(v.Names) > 1:
+						// The stubs return the error last, and send it as
+						// its message, so it can't be a field of the response.
+						r.fail(nodeError(r.fileset, v, CodeErrorPosition, "error result of method %s must be the last result", method.Name))
+						hasError = true
+					default:
+						hasError = true
 					}
 				}
 			}
 			if !hasError {
-				fatalNode(r.fileset, m, "method %s must have error as last return value", method.Name)
+				r.fail(nodeError(r.fileset, m, CodeMissingError, "method %s must have error as last return value", method.Name))
 			}
+			var redact, omitEmpty, unix, validate, limits, defaults, fieldIDs []directive
+			for _, d := range r.directives(m.Doc) {
+				switch d.name {
+				case DirectiveNotify:
+					method.Notify = true
+				case DirectiveJob:
+					method.Job = true
+				case DirectiveDedup:
+					method.Dedup = true
+				case DirectiveDeprecated:
+					method.Deprecated = d.arg
+				case DirectiveRedact:
+					redact = append(redact, d)
+				case DirectiveSecret:
+					method.Secret = true
+					redact = append(redact, d)
+				case DirectiveValidate:
+					validate = append(validate, d)
+				case DirectiveMax, DirectiveMaxLen:
+					limits = append(limits, d)
+				case DirectiveDefault:
+					defaults = append(defaults, d)
+				case DirectiveOmitEmpty:
+					omitEmpty = append(omitEmpty, d)
+				case DirectiveUnix, DirectiveUnixMilli:
+					unix = append(unix, d)
+				case DirectiveField:
+					fieldIDs = append(fieldIDs, d)
+				case DirectiveScope:
+					for _, scope := range strings.FieldsFunc(d.arg, func(c rune) bool { return c == ',' || unicode.IsSpace(c) }) {
+						method.Scopes = append(method.Scopes, scope)
+					}
+				case DirectiveTimeout:
+					timeout, err := time.ParseDuration(d.arg)
+					if err != nil || timeout <= 0 {
+						r.fail(directiveError(r.fileset, d.comment, d.name, "invalid timeout %q of method %s, expected a positive duration", d.arg, method.Name))
+						continue
+					}
+					method.Timeout = timeout
+				case DirectivePriority:
+					if d.arg != PriorityHigh && d.arg != PriorityLow {
+						r.fail(directiveError(r.fileset, d.comment, d.name, "invalid priority %q of method %s, expected %s or %s", d.arg, method.Name, PriorityHigh, PriorityLow))
+						continue
+					}
+					method.Priority = d.arg
+				}
+			}
+			if method.Notify && method.Job {
+				r.fail(directiveError(r.fileset, m, DirectiveJob, "method %s can't be both a notification and a job", method.Name))
+			}
+			if method.Dedup && (method.Notify || method.Job) {
+				r.fail(directiveError(r.fileset, m, DirectiveDedup, "method %s can't be deduplicated, as notifications and jobs aren't retried", method.Name))
+			}
+			if method.Notify && len(method.Results) > 0 {
+				r.fail(nodeError(r.fileset, t.Results, CodeNotifyResults, "notification %s can't have results besides error", method.Name))
+			}
+			uniqueNames(method.Parameters)
+			uniqueNames(method.Results)
+			for _, d := range redact {
+				r.redact(method, d)
+			}
+			for _, d := range omitEmpty {
+				r.omitEmpty(method, d)
+			}
+			for _, d := range unix {
+				r.unixTime(method, d)
+			}
+			for _, d := range validate {
+				r.validate(method, d)
+			}
+			for i, v := range t.Params.List {
+				end := t.Params.Closing
+				if i+1 < len(t.Params.List) {
+					end = t.Params.List[i+1].Pos()
+				}
+				limits = append(limits, r.paramDirectives(v, end)...)
+			}
+			for _, d := range limits {
+				r.limit(method, d)
+			}
+			for _, d := range defaults {
+				r.setDefault(method, d)
+			}
+			for _, d := range fieldIDs {
+				r.fieldID(method, d)
+			}
+			debugf("%s: method %s of %s", r.fileset.Position(m.Pos()), method.Name, r.Type)
 			r.Methods = append(r.Methods, method)
+		case *ast.UnaryExpr, *ast.BinaryExpr:
+			r.fail(nodeError(r.fileset, m, CodeConstraint, "interface %s has a type set, and can only constrain type parameters", r.Type))
 		case *ast.Ident:
+			if predeclared[t.Name] && t.Name != "any" && t.Name != "error" {
+				r.fail(nodeError(r.fileset, m, CodeConstraint, "interface %s has a type set, and can only constrain type parameters", r.Type))
+				continue
+			}
 			// Embedded interface
-			r.VisitMethodList(t.Obj.Decl.(*ast.TypeSpec).Type.(*ast.InterfaceType))
+			var embedded *ast.InterfaceType
+			if t.Obj != nil {
+				if spec, ok := t.Obj.Decl.(*ast.TypeSpec); ok {
+					embedded, _ = spec.Type.(*ast.InterfaceType)
+				}
+			}
+			if embedded == nil {
+				r.fail(nodeError(r.fileset, m, CodeEmbeddedInterface, "embedded interface %s must be declared in the same file", t.Name))
+				continue
+			}
+			debugf("%s: including the methods of embedded interface %s", r.fileset.Position(m.Pos()), t.Name)
+			r.VisitMethodList(embedded)
+		case *ast.SelectorExpr:
+			r.fail(nodeError(r.fileset, m, CodeEmbeddedInterface, "embedded interface %s.%s from another package is not supported", t.X, t.Sel))
 		}
 	}
 }
@@ -319,25 +1851,207 @@ func (r *InterfaceGen) Visit(node ast.Node) (w ast.Visitor) {
 	switch n := node.(type) {
 	case *ast.InterfaceType:
 		r.VisitMethodList(n)
+		if len(r.Methods) == 0 && len(r.errs) == 0 {
+			r.fail(nodeError(r.fileset, n, CodeNoMethods, "interface %s has no methods to serve", r.Type))
+		}
 	}
 	return r.RPCGen
 }
 
-func types(t ast.Expr) []string {
+// validImportPath reports whether path is syntactically an import path.
+func validImportPath(path string) bool {
+	if path == "" || strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") {
+		return false
+	}
+	for _, r := range path {
+		if !unicode.IsGraphic(r) || unicode.IsSpace(r) || strings.ContainsRune("!\"#$%&'()*,:;<=>?[\\]^`{|}", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// guessPackageName returns the name the package at the import path most
+// likely has: the last element of the path, without a major version suffix
+// and the usual "go-" prefix or "-go" suffix.
+func guessPackageName(importPath string) string {
+	elems := strings.Split(importPath, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = elems[len(elems)-2]
+	}
+	if i := strings.Index(name, ".v"); i > 0 {
+		name = name[:i]
+	}
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "go-"), "-go")
+	return strings.Replace(name, "-", "_", -1)
+}
+
+// types returns the names of the types referenced by t, or false if t is not
+// a supported type expression.
+func types(t ast.Expr) ([]string, bool) {
 	switch n := t.(type) {
 	case *ast.StarExpr:
 		return types(n.X)
 	case *ast.SelectorExpr:
-		return []string{strings.Join(append(types(n.X), types(n.Sel)...), ".")}
+		x, ok := types(n.X)
+		return []string{strings.Join(append(x, n.Sel.Name), ".")}, ok
 	case *ast.MapType:
-		keys := types(n.Key)
-		return append(keys, types(n.Value)...)
+		keys, ok := types(n.Key)
+		values, valuesOk := types(n.Value)
+		return append(keys, values...), ok && valuesOk
 	case *ast.ArrayType:
 		return types(n.Elt)
+	case *ast.IndexExpr:
+		return typesOf(n.X, n.Index)
+	case *ast.IndexListExpr:
+		return typesOf(append([]ast.Expr{n.X}, n.Indices...)...)
 	case *ast.Ident:
-		return []string{n.Name}
+		return []string{n.Name}, true
 	default:
-		panic(fmt.Sprintf("unknown expression node %s %s\n", reflect.TypeOf(t), t))
+		return nil, false
+	}
+}
+
+// typesOf returns the names of the types referenced by exprs, such as the
+// generic type and the type arguments of an instantiation.
+func typesOf(exprs ...ast.Expr) ([]string, bool) {
+	var names []string
+	for _, expr := range exprs {
+		n, ok := types(expr)
+		if !ok {
+			return nil, false
+		}
+		names = append(names, n...)
+	}
+	return names, true
+}
+
+// unserializable returns the part of the type expression t that gob can't
+// encode, if any, and what kind of type it is: channels, functions and
+// unsafe pointers, however deeply nested.
+func (r *InterfaceGen) unserializable(t ast.Expr) (ast.Node, string) {
+	var found ast.Node
+	var kind string
+	ast.Inspect(t, func(n ast.Node) bool {
+		if found != nil {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.ChanType:
+			found, kind = n, "channels"
+		case *ast.FuncType:
+			found, kind = n, "functions"
+		case *ast.SelectorExpr:
+			if x, ok := n.X.(*ast.Ident); ok && n.Sel.Name == "Pointer" && r.isUnsafe(x.Name) {
+				found, kind = n, "unsafe pointers"
+			}
+			return false
+		}
+		return found == nil
+	})
+	return found, kind
+}
+
+// isUnsafe reports whether name refers to the unsafe package in the source.
+func (r *InterfaceGen) isUnsafe(name string) bool {
+	for _, imp := range r.checkImports {
+		if imp.Path.Value != `"unsafe"` {
+			continue
+		}
+		if (imp.Name == nil && name == "unsafe") || (imp.Name != nil && imp.Name.Name == name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTimePackage reports whether name refers to the time package in a file
+// with imports.
+func isTimePackage(imports []*ast.ImportSpec, name string) bool {
+	for _, imp := range imports {
+		if imp.Path.Value != `"time"` {
+			continue
+		}
+		if (imp.Name == nil && name == "time") || (imp.Name != nil && imp.Name.Name == name) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeDecls returns the types declared in f, by name.
+func typeDecls(f *ast.File) map[string]*ast.TypeSpec {
+	decls := map[string]*ast.TypeSpec{}
+	for _, decl := range f.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.TYPE {
+			for _, spec := range gen.Specs {
+				spec := spec.(*ast.TypeSpec)
+				decls[spec.Name.Name] = spec
+			}
+		}
+	}
+	return decls
+}
+
+// exportedName returns the exported form of the parameter or result name,
+// used for the fields of the request and response structures: the name with
+// its first letter in upper case, or prefixed with X if that letter has no
+// upper case, as in Chinese, or it is not a letter.
+func exportedName(name string) string {
+	first, size := utf8.DecodeRuneInString(name)
+	exported := string(unicode.ToUpper(first)) + name[size:]
+	if !ast.IsExported(exported) {
+		exported = "X" + name
+	}
+	return exported
+}
+
+// uniqueNames renames the fields of a parameter or result list that the
+// stubs could not declare or refer to as they are: blank names get the
+// position of the field, as in _2, and exported names used more than once,
+// as for a and A, get a number, so that the request and response structures
+// don't declare a field twice.
+func uniqueNames(fields []*Type) {
+	declared := map[string]bool{}
+	for _, t := range fields {
+		for _, name := range t.LowerNames {
+			declared[name] = true
+		}
+	}
+	i := 0
+	for _, t := range fields {
+		for j, lowerName := range t.LowerNames {
+			if lowerName == "_" {
+				for k := i; lowerName == "_" || declared[lowerName]; k++ {
+					lowerName = fmt.Sprintf("_%d", k)
+				}
+				declared[lowerName] = true
+				t.LowerNames[j] = lowerName
+				t.Names[j] = exportedName(lowerName)
+			}
+			i++
+		}
+	}
+	taken := map[string]bool{}
+	for _, t := range fields {
+		for _, name := range t.Names {
+			taken[name] = true
+		}
+	}
+	seen := map[string]bool{}
+	for _, t := range fields {
+		for j, name := range t.Names {
+			if seen[name] {
+				k := 2
+				for taken[fmt.Sprintf("%s%d", name, k)] {
+					k++
+				}
+				t.Names[j] = fmt.Sprintf("%s%d", name, k)
+				taken[t.Names[j]] = true
+			}
+			seen[t.Names[j]] = true
+		}
 	}
 }
 
@@ -345,25 +2059,39 @@ func (r *InterfaceGen) formatType(fileset *token.FileSet, field *ast.Field) *Typ
 	var typeBuf bytes.Buffer
 	_ = printer.Fprint(&typeBuf, fileset, field.Type)
 	if len(field.Names) == 0 {
-		fatalNode(fileset, field, "RPC interface parameters and results must all be named")
+		r.fail(nodeError(fileset, field, CodeUnnamedField, "RPC interface parameters and results must all be named"))
+	}
+	typeNames, ok := types(field.Type)
+	if node, kind := r.unserializable(field.Type); node != nil {
+		var nodeBuf bytes.Buffer
+		_ = printer.Fprint(&nodeBuf, fileset, node)
+		r.fail(nodeError(fileset, node, CodeUnsupportedType, "%s can't be sent over RPC: encoding/gob can't encode %s", nodeBuf.String(), kind))
+	} else if !ok {
+		r.fail(nodeError(fileset, field, CodeUnsupportedType, "unsupported type %s", typeBuf.String()))
 	}
-	for _, typeName := range types(field.Type) {
+	for _, typeName := range typeNames {
 		parts := strings.SplitN(typeName, ".", 2)
 		if len(parts) > 1 {
-			for _, imp := range r.CheckImports {
+			found := false
+			for _, imp := range r.checkImports {
 				importPath := imp.Path.Value[1 : len(imp.Path.Value)-1]
 				if imp.Name != nil && imp.Name.String() == parts[0] {
-					r.Imports[importPath] = imp.Name.String()
-				} else if filepath.Base(importPath) == parts[0] {
-					r.Imports[importPath] = ""
+					r.addTypeImport(importPath, imp.Name.String())
+					found = true
+				} else if imp.Name == nil && (filepath.Base(importPath) == parts[0] || guessPackageName(importPath) == parts[0]) {
+					r.addTypeImport(importPath, "")
+					found = true
 				}
 			}
+			if !found {
+				r.fail(nodeError(fileset, field, CodeUnknownPackage, "package %s of type %s is not imported", parts[0], typeName))
+			}
 		}
 	}
-	t := &Type{Type: typeBuf.String()}
+	t := &Type{Type: typeBuf.String(), expr: field.Type}
 	for _, n := range field.Names {
 		lowerName := n.Name
-		name := strings.ToUpper(lowerName[0:1]) + lowerName[1:]
+		name := exportedName(lowerName)
 		t.Names = append(t.Names, name)
 		t.LowerNames = append(t.LowerNames, lowerName)
 	}
@@ -0,0 +1,492 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseInterface parses the interface typ of a source file holding src in a
+// temporary directory, with the other options of opts.
+func parseInterface(t *testing.T, src, typ string, opts Options) (*RPCGen, error) {
+	t.Helper()
+	opts.Source = filepath.Join(t.TempDir(), "source.go")
+	opts.Type = typ
+	if err := ioutil.WriteFile(opts.Source, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts.setDefaults()
+	gen, _, err := parse(&opts)
+	return gen, err
+}
+
+// diagnosticCodes returns the codes of the diagnostics of err, in order.
+func diagnosticCodes(err error) []string {
+	var codes []string
+	switch err := err.(type) {
+	case nil:
+	case Diagnostics:
+		for _, err := range err {
+			codes = append(codes, asDiagnostic(err).Code)
+		}
+	default:
+		codes = append(codes, asDiagnostic(err).Code)
+	}
+	return codes
+}
+
+func TestErrorPosition(t *testing.T) {
+	tests := []struct {
+		method string
+		codes  []string
+	}{
+		{"M() (err error)", nil},
+		{"M(a int) (n int, err error)", nil},
+		{"M() (n, m int, err error)", nil},
+		{"M() (err error, n int)", []string{CodeErrorPosition}},
+		{"M() (a, b error)", []string{CodeErrorPosition}},
+		{"M() (first error, n int, err error)", []string{CodeErrorPosition}},
+		{"M() (n int)", []string{CodeMissingError}},
+	}
+	for _, test := range tests {
+		t.Run(test.method, func(t *testing.T) {
+			_, err := parseInterface(t, "package p\n\ntype I interface {\n\t"+test.method+"\n}\n", "I", Options{})
+			if codes := diagnosticCodes(err); !reflect.DeepEqual(codes, test.codes) {
+				t.Errorf("got %v (%v), want %v", codes, err, test.codes)
+			}
+		})
+	}
+}
+
+func TestUniqueNames(t *testing.T) {
+	tests := []struct {
+		name       string
+		lowerNames [][]string
+		names      [][]string
+		wantLower  [][]string
+		wantNames  [][]string
+	}{
+		{
+			name:       "distinct",
+			lowerNames: [][]string{{"a", "b"}, {"c"}},
+			names:      [][]string{{"A", "B"}, {"C"}},
+			wantLower:  [][]string{{"a", "b"}, {"c"}},
+			wantNames:  [][]string{{"A", "B"}, {"C"}},
+		},
+		{
+			name:       "blank",
+			lowerNames: [][]string{{"_", "a"}, {"_"}},
+			names:      [][]string{{"_", "A"}, {"_"}},
+			wantLower:  [][]string{{"_0", "a"}, {"_2"}},
+			wantNames:  [][]string{{"X_0", "A"}, {"X_2"}},
+		},
+		{
+			name:       "blank taken",
+			lowerNames: [][]string{{"_", "_0"}},
+			names:      [][]string{{"_", "X_0"}},
+			wantLower:  [][]string{{"_1", "_0"}},
+			wantNames:  [][]string{{"X_1", "X_0"}},
+		},
+		{
+			name:       "same exported name",
+			lowerNames: [][]string{{"a"}, {"A"}},
+			names:      [][]string{{"A"}, {"A"}},
+			wantLower:  [][]string{{"a"}, {"A"}},
+			wantNames:  [][]string{{"A"}, {"A2"}},
+		},
+		{
+			name:       "number taken",
+			lowerNames: [][]string{{"a", "A", "a2"}},
+			names:      [][]string{{"A", "A", "A2"}},
+			wantLower:  [][]string{{"a", "A", "a2"}},
+			wantNames:  [][]string{{"A", "A3", "A2"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var fields []*Type
+			for i := range test.lowerNames {
+				fields = append(fields, &Type{LowerNames: test.lowerNames[i], Names: test.names[i], Type: "int"})
+			}
+			uniqueNames(fields)
+			for i, f := range fields {
+				if !reflect.DeepEqual(f.LowerNames, test.wantLower[i]) || !reflect.DeepEqual(f.Names, test.wantNames[i]) {
+					t.Errorf("group %d: got %v %v, want %v %v", i, f.LowerNames, f.Names, test.wantLower[i], test.wantNames[i])
+				}
+			}
+		})
+	}
+}
+
+// TestForeignPackage checks that the stubs refer to the source package by
+// name when --package names another package than the source's, even in the
+// same directory.
+func TestForeignPackage(t *testing.T) {
+	tests := []struct {
+		pkg       string
+		qualified bool
+	}{
+		{"", false},
+		{"store", false},
+		{"store_test", true},
+		{"storerpc", true},
+	}
+	for _, test := range tests {
+		t.Run(test.pkg, func(t *testing.T) {
+			opts := Options{Source: "testdata/qualify/store.go", Type: "Store", Package: test.pkg}
+			opts.setDefaults()
+			_, files, err := render(&opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			content := string(files[0].Content)
+			if qualified := strings.Contains(content, "impl store.Store"); qualified != test.qualified {
+				t.Errorf("qualified = %v, want %v", qualified, test.qualified)
+			}
+			if want := "package " + test.pkg; test.pkg != "" && !strings.Contains(content, want) {
+				t.Errorf("missing %q", want)
+			}
+		})
+	}
+}
+
+// TestInterfaceKinds checks which interfaces stubs can be generated for, as
+// generate and list both tell from the same validation.
+func TestInterfaceKinds(t *testing.T) {
+	tests := []struct {
+		name  string
+		decls string
+		codes []string
+	}{
+		{"methods", "type I interface{ M() (err error) }", nil},
+		{"embedded", "type I interface{ J }\ntype J interface{ M() (err error) }", nil},
+		{"empty", "type I interface{}", []string{CodeNoMethods}},
+		{"embedded empty", "type I interface{ J }\ntype J interface{}", []string{CodeNoMethods}},
+		{"union", "type I interface{ ~int | string }", []string{CodeConstraint}},
+		{"tilde", "type I interface {\n\t~int\n\tM() (err error)\n}", []string{CodeConstraint}},
+		{"comparable", "type I interface {\n\tcomparable\n\tM() (err error)\n}", []string{CodeConstraint}},
+		{"embedded union", "type I interface{ J }\ntype J interface{ int | string }", []string{CodeConstraint}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseInterface(t, "package p\n\n"+test.decls+"\n", "I", Options{})
+			if codes := diagnosticCodes(err); !reflect.DeepEqual(codes, test.codes) {
+				t.Errorf("got %v (%v), want %v", codes, err, test.codes)
+			}
+		})
+	}
+}
+
+func TestLimitDirectives(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		limits []Limit
+		err    string
+	}{
+		{
+			name:   "doc comment",
+			method: "//rpcgen:max data 1MB\n\t//rpcgen:maxlen name 256\n\tM(name string, data []byte) (err error)",
+			limits: []Limit{{Field: "Data", Name: "data", Bytes: true, Max: 1 << 20}, {Field: "Name", Name: "name", String: true, Max: 256}},
+		},
+		{
+			name:   "parameters",
+			method: "M(\n\t\tname string, //rpcgen:maxlen=256\n\t\tdata []byte, //rpcgen:max=1MB\n\t) (err error)",
+			limits: []Limit{{Field: "Name", Name: "name", String: true, Max: 256}, {Field: "Data", Name: "data", Bytes: true, Max: 1 << 20}},
+		},
+		{
+			name:   "last parameter",
+			method: "M(\n\t\tname string,\n\t\ttags []string, //rpcgen:maxlen 8\n\t) (err error)",
+			limits: []Limit{{Field: "Tags", Name: "tags", Max: 8}},
+		},
+		{
+			name:   "parameter group",
+			method: "M(\n\t\ta, b string, //rpcgen:maxlen=4\n\t) (err error)",
+			limits: []Limit{{Field: "A", Name: "a", String: true, Max: 4}, {Field: "B", Name: "b", String: true, Max: 4}},
+		},
+		{
+			name:   "other directive after a parameter",
+			method: "M(\n\t\tname string, //rpcgen:notify\n\t) (err error)",
+			err:    "goes in the doc comment of the method",
+		},
+		{
+			name:   "invalid size after a parameter",
+			method: "M(\n\t\tdata []byte, //rpcgen:max=lots\n\t) (err error)",
+			err:    `invalid size "lots"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gen, err := parseInterface(t, "package p\n\ntype I interface {\n\t"+test.method+"\n}\n", "I", Options{})
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var limits []Limit
+			for _, l := range gen.Methods[0].Limits {
+				limits = append(limits, *l)
+			}
+			if !reflect.DeepEqual(limits, test.limits) {
+				t.Errorf("got limits %+v, want %+v", limits, test.limits)
+			}
+		})
+	}
+}
+
+func TestDirectiveHints(t *testing.T) {
+	tests := []struct {
+		method, hint string
+	}{
+		{"//rpcgen:bogus\n\tM() (err error)", "the method directives are"},
+		{"//rpcgen:timeout soon\n\tM() (err error)", "follow //rpcgen:timeout with a positive duration"},
+		{"//rpcgen:notify x\n\tM() (err error)", "//rpcgen:notify takes no argument"},
+		{"//rpcgen:notify\n\t//rpcgen:job\n\tM() (err error)", "//rpcgen:job takes no argument, and can't be combined with //rpcgen:notify"},
+		{"//rpcgen:max data\n\tM(data []byte) (err error)", "follow //rpcgen:max with the name of a string or byte slice parameter"},
+		{"//rpcgen:default n 1\n\tM(n int) (err error)", "follow //rpcgen:default with the name of a pointer parameter"},
+	}
+	for _, test := range tests {
+		t.Run(test.hint, func(t *testing.T) {
+			_, err := parseInterface(t, "package p\n\ntype I interface {\n\t"+test.method+"\n}\n", "I", Options{})
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if d := asDiagnostic(err); d.Code != CodeDirective || !strings.HasPrefix(d.Hint, test.hint) {
+				t.Errorf("got %s diagnostic with hint %q, want one starting with %q", d.Code, d.Hint, test.hint)
+			}
+		})
+	}
+}
+
+func TestTargetClash(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "source.go")
+	src := "package p\n\ntype A interface {\n\tM() (err error)\n}\n\ntype B interface {\n\tM() (err error)\n}\n"
+	if err := ioutil.WriteFile(source, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	targets := func(bTarget string) []*Options {
+		a, b := &Options{Source: source, Type: "A"}, &Options{Source: source, Type: "B", Target: bTarget}
+		a.setDefaults()
+		b.setDefaults()
+		return []*Options{a, b}
+	}
+
+	results := renderAll(targets(""), 2)
+	if results[0].err != nil {
+		t.Errorf("rendering A failed: %v", results[0].err)
+	}
+	if d := asDiagnostic(results[1].err); results[1].err == nil || d.Code != CodeTargetClash || !strings.Contains(d.Message, "both A and B") {
+		t.Errorf("rendering B to the target of A returned %v, want a %s error", results[1].err, CodeTargetClash)
+	}
+
+	results = renderAll(targets(filepath.Join(filepath.Dir(source), "brpc.gen.go")), 2)
+	for i, r := range results {
+		if r.err != nil {
+			t.Errorf("rendering target %d failed: %v", i, r.err)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "source.go")
+	write := func(src string) {
+		t.Helper()
+		if err := ioutil.WriteFile(source, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("package p\n\ntype I interface {\n\tFirst() (err error)\n}\n")
+	opts := &Options{Source: source, Type: "I"}
+	opts.setDefaults()
+	// waitFor waits for the target to contain s.
+	waitFor := func(s string) {
+		t.Helper()
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if content, err := ioutil.ReadFile(opts.Target); err == nil && bytes.Contains(content, []byte(s)) {
+				return
+			}
+		}
+		t.Fatalf("%s never contained %s", opts.Target, s)
+	}
+
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		watch([]*Options{opts}, 50*time.Millisecond, 1, false, stop)
+		close(stopped)
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+	waitFor("func (s *IService) First(")
+
+	// The generated file is left out of the snapshot, so that writing it
+	// doesn't trigger another generation.
+	if _, ok := snapshot([]*Options{opts})[opts.Target]; ok {
+		t.Errorf("the snapshot holds the target %s", opts.Target)
+	}
+
+	write("package p\n\ntype I interface {\n\tFirst() (err error)\n\tSecond() (err error)\n}\n")
+	// Make sure the modification time changes on file systems with a
+	// coarse resolution.
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(source, later, later); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("func (s *IService) Second(")
+}
+
+func TestWriteProtection(t *testing.T) {
+	dir := t.TempDir()
+	generated := []byte("// Code generated by go-rpcgen. DO NOT EDIT.\n\npackage p\n")
+	tests := []struct {
+		name     string
+		existing string // content of the file before writing, if any
+		force    bool
+		written  bool
+	}{
+		{name: "missing", written: true},
+		{name: "empty", existing: "", written: true},
+		{name: "generated", existing: "// Code generated by go-rpcgen. DO NOT EDIT.\n\npackage p\n\nvar old int\n", written: true},
+		{name: "hand-written", existing: "package p\n\nvar mine int\n"},
+		{name: "hand-written forced", existing: "package p\n\nvar mine int\n", force: true, written: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(test.name, " ", "_")+".go")
+			if test.name != "missing" {
+				if err := ioutil.WriteFile(path, []byte(test.existing), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// A file that can be written must not be written either when
+			// another one of the interface can't.
+			other := filepath.Join(dir, strings.ReplaceAll(test.name, " ", "_")+"_other.go")
+			err := write("I", []*File{{Path: other, Content: generated}, {Path: path, Content: generated}}, test.force)
+			content, _ := ioutil.ReadFile(path)
+			_, otherErr := os.Stat(other)
+			if test.written {
+				if err != nil || !bytes.Equal(content, generated) || otherErr != nil {
+					t.Errorf("write failed with %v, leaving %q", err, content)
+				}
+				return
+			}
+			if d := asDiagnostic(err); err == nil || d.Code != CodeNotGenerated {
+				t.Errorf("write returned %v, want a %s error", err, CodeNotGenerated)
+			}
+			if string(content) != test.existing || otherErr == nil {
+				t.Errorf("write changed the files, leaving %q", content)
+			}
+		})
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	// leftovers returns the temporary files left in dir.
+	leftovers := func() []string {
+		matches, _ := filepath.Glob(filepath.Join(dir, ".*.tmp"))
+		return matches
+	}
+
+	path := filepath.Join(dir, "new.go")
+	if err := writeFile(path, []byte("package p\n")); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadFile(path); string(content) != "package p\n" {
+		t.Errorf("wrote %q, want %q", content, "package p\n")
+	}
+
+	// An existing file keeps its permissions.
+	existing := filepath.Join(dir, "existing.go")
+	if err := ioutil.WriteFile(existing, []byte("package old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(existing, []byte("package p\n")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(existing); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("the rewritten file has mode %v, %v, want %v", info.Mode().Perm(), err, os.FileMode(0o600))
+	}
+
+	// A failed write leaves no temporary file behind.
+	if err := os.Mkdir(filepath.Join(dir, "taken.go"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(filepath.Join(dir, "taken.go"), []byte("package p\n")); err == nil {
+		t.Error("writing over a directory succeeded")
+	}
+	if files := leftovers(); len(files) != 0 {
+		t.Errorf("temporary files were left behind: %q", files)
+	}
+}
+
+func TestParallelGeneration(t *testing.T) {
+	defer func(level int) { verbosity = level }(verbosity)
+	verbosity = verbosityQuiet
+	dir := t.TempDir()
+	var targets []*Options
+	for i := 0; i < 12; i++ {
+		name := fmt.Sprintf("I%d", i)
+		method := fmt.Sprintf("M%d(n int) (m int, err error)", i)
+		if i == 5 {
+			method = "Broken(n int) (m int)"
+		}
+		source := filepath.Join(dir, strings.ToLower(name)+".go")
+		if err := ioutil.WriteFile(source, []byte("package p\n\ntype "+name+" interface {\n\t"+method+"\n}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		opts := &Options{Source: source, Type: name}
+		opts.setDefaults()
+		targets = append(targets, opts)
+	}
+
+	// Rendering in parallel gives the outcome of each target at its
+	// index, as rendering them one by one does.
+	serial, parallel := renderAll(targets, 1), renderAll(targets, 4)
+	for i := range targets {
+		if (serial[i].err == nil) != (i != 5) || (parallel[i].err == nil) != (i != 5) {
+			t.Errorf("target %d failed with %v serially and %v in parallel, want only target 5 to fail", i, serial[i].err, parallel[i].err)
+		}
+		if !reflect.DeepEqual(serial[i].files, parallel[i].files) {
+			t.Errorf("target %d rendered different files in parallel", i)
+		}
+	}
+
+	s := generateAll(targets, 4, false)
+	if s.Failed != 1 || len(s.Interfaces) != len(targets) {
+		t.Fatalf("generateAll summarized %d interfaces and %d failures, want %d and 1", len(s.Interfaces), s.Failed, len(targets))
+	}
+	for i, summary := range s.Interfaces {
+		if summary.Interface != targets[i].Type {
+			t.Errorf("interface %d of the summary is %s, want %s", i, summary.Interface, targets[i].Type)
+		}
+		if _, err := os.Stat(targets[i].Target); (err == nil) != (i != 5) {
+			t.Errorf("the target of %s exists: %v, want %v", targets[i].Type, err == nil, i != 5)
+		}
+	}
+}
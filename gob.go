@@ -0,0 +1,165 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/token"
+	gotypes "go/types"
+	"path/filepath"
+	"time"
+)
+
+// gobWarnings type-checks the package of the source file and returns
+// warnings about the parameters and results of the methods of the interface
+// typeName whose types encoding/gob silently sends empty, or can only send
+// after registering the concrete types of interface values. Named types are
+// followed to their declarations, wherever they are. Without type
+// information, for example because the package doesn't build, there are no
+// warnings.
+func gobWarnings(source, typeName string) []error {
+	if source == stdio {
+		return nil
+	}
+	defer timed("checking gob compatibility of "+typeName, time.Now())
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return nil
+	}
+	pkg, err := loadPackage(abs)
+	if err != nil {
+		debugf("no type information for %s: %s", source, err)
+		return nil
+	}
+	obj, ok := pkg.Types.Scope().Lookup(typeName).(*gotypes.TypeName)
+	if !ok {
+		return nil
+	}
+	iface, ok := obj.Type().Underlying().(*gotypes.Interface)
+	if !ok {
+		return nil
+	}
+	position := func(pos token.Pos) token.Position {
+		p := pkg.Fset.Position(pos)
+		if p.Filename == abs {
+			p.Filename = source
+		}
+		return p
+	}
+	// Objects served through handles aren't encoded.
+	handles := map[string]bool{}
+	for i, file := range pkg.GoFiles {
+		if file == abs && i < len(pkg.Syntax) {
+			handles = handleInterfaces(pkg.Syntax[i])
+		}
+	}
+	c := &gobChecker{pkg: pkg.Types, seen: map[gotypes.Type]bool{}}
+	var warnings []error
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		sig := m.Type().(*gotypes.Signature)
+		for _, vars := range []*gotypes.Tuple{sig.Params(), sig.Results()} {
+			for j := 0; j < vars.Len(); j++ {
+				v := vars.At(j)
+				if v.Type() == gotypes.Universe.Lookup("error").Type() {
+					// net/rpc sends errors as their message.
+					continue
+				}
+				if named, ok := v.Type().(*gotypes.Named); ok && named.Obj().Pkg() == pkg.Types && handles[named.Obj().Name()] {
+					continue
+				}
+				if problem := c.check(v.Type()); problem != "" {
+					warnings = append(warnings, &Diagnostic{
+						Pos:      position(v.Pos()),
+						Severity: SeverityWarning,
+						Code:     CodeGob,
+						Message:  fmt.Sprintf("%s of %s: %s", v.Name(), m.Name(), problem),
+						Hint:     hints[CodeGob],
+					})
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+// gobChecker finds the problems encoding/gob has with types, visiting each
+// type once so that recursive types terminate.
+type gobChecker struct {
+	pkg  *gotypes.Package
+	seen map[gotypes.Type]bool
+}
+
+// check returns a description of the problem gob has with t, or "" if
+// there is none.
+func (c *gobChecker) check(t gotypes.Type) string {
+	if c.seen[t] || isGobMarshaler(t, c.pkg) {
+		return ""
+	}
+	c.seen[t] = true
+	name := gotypes.TypeString(t, gotypes.RelativeTo(c.pkg))
+	switch u := t.Underlying().(type) {
+	case *gotypes.Pointer:
+		return c.check(u.Elem())
+	case *gotypes.Slice:
+		return c.check(u.Elem())
+	case *gotypes.Array:
+		return c.check(u.Elem())
+	case *gotypes.Map:
+		if problem := c.check(u.Key()); problem != "" {
+			return problem
+		}
+		return c.check(u.Elem())
+	case *gotypes.Interface:
+		return fmt.Sprintf("%s is an interface type, whose values can only be sent once their concrete types are registered with gob.Register", name)
+	case *gotypes.Struct:
+		sent := 0
+		for i := 0; i < u.NumFields(); i++ {
+			f := u.Field(i)
+			if !f.Exported() {
+				continue
+			}
+			switch f.Type().Underlying().(type) {
+			case *gotypes.Chan, *gotypes.Signature:
+				// gob skips channel and function fields.
+				continue
+			}
+			sent++
+			if problem := c.check(f.Type()); problem != "" {
+				return fmt.Sprintf("field %s of %s: %s", f.Name(), name, problem)
+			}
+		}
+		if sent == 0 {
+			return fmt.Sprintf("%s has no exported fields gob can send", name)
+		}
+	}
+	return ""
+}
+
+// isGobMarshaler reports whether gob encodes t with methods of its own,
+// rather than by its structure.
+func isGobMarshaler(t gotypes.Type, pkg *gotypes.Package) bool {
+	if _, ok := t.(*gotypes.Named); !ok {
+		return false
+	}
+	for _, name := range []string{"GobEncode", "MarshalBinary", "MarshalText"} {
+		if obj, _, _ := gotypes.LookupFieldOrMethod(t, true, pkg, name); obj != nil {
+			if _, ok := obj.(*gotypes.Func); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
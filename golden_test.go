@@ -0,0 +1,102 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// updateGolden reports whether the golden files under testdata are rewritten
+// with the generated files instead of compared with them, as running the
+// tests with RPCGEN_UPDATE=1 asks.
+var updateGolden = os.Getenv("RPCGEN_UPDATE") != ""
+
+// renderGolden generates the files of opts and compares each with the golden
+// file of the same name, with a .golden suffix, in testdata/dir.
+func renderGolden(t *testing.T, dir string, opts Options) {
+	t.Helper()
+	opts.setDefaults()
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	_, files, err := render(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		golden := filepath.Join("testdata", dir, filepath.Base(f.Path)+".golden")
+		if updateGolden {
+			if err := ioutil.WriteFile(golden, f.Content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("%s; run the tests with RPCGEN_UPDATE=1 to add it", err)
+		}
+		if !bytes.Equal(f.Content, want) {
+			t.Errorf("%s differs from %s; run the tests with RPCGEN_UPDATE=1 to accept it\n%s", f.Path, golden, lineDifference(want, f.Content))
+		}
+	}
+}
+
+// lineDifference describes the first line where got differs from want.
+func lineDifference(want, got []byte) string {
+	wantLines, gotLines := strings.Split(string(want), "\n"), strings.Split(string(got), "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g || i >= len(wantLines) || i >= len(gotLines) {
+			return fmt.Sprintf("line %d:\n\twant: %s\n\tgot:  %s", i+1, w, g)
+		}
+	}
+	return ""
+}
+
+// TestExpvarGolden generates a service publishing its call statistics, which
+// shares the variable of services of the same name instead of publishing it
+// again.
+func TestExpvarGolden(t *testing.T) {
+	renderGolden(t, "expvar", Options{
+		Source: "testdata/expvar/counter.go",
+		Type:   "Counter",
+		Mode:   ModeServer,
+		Expvar: true,
+	})
+}
+
+// TestChecksGolden generates a service setting defaults and checking enums and
+// limits, which with server options it does once the authorizer and the
+// interceptors let the call through.
+func TestChecksGolden(t *testing.T) {
+	renderGolden(t, "checks", Options{
+		Source:        "testdata/checks/search.go",
+		Type:          "Search",
+		Mode:          ModeServer,
+		ServerOptions: true,
+	})
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the units sizes given to //rpcgen:max can end with.
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+	{"B", 1},
+}
+
+// Limit is a limit on the size of a request field, checked by the service
+// before calling the implementation. It is part of the data model passed to
+// templates.
+type Limit struct {
+	// Field is the exported name of the field.
+	Field string `json:"field"`
+	// Name is the name of the parameter as declared.
+	Name string `json:"name"`
+	// Bytes reports whether Max is a number of bytes, as set by
+	// //rpcgen:max, rather than a number of elements or characters, as set
+	// by //rpcgen:maxlen.
+	Bytes bool `json:"bytes"`
+	// String reports whether the field is a string.
+	String bool  `json:"string"`
+	Max    int64 `json:"max"`
+}
+
+// parseSize parses a size such as 512, 64KB or 1MiB. KB, MB and GB are
+// multiples of 1024, like KiB, MiB and GiB.
+func parseSize(s string) (int64, error) {
+	n, unit := s, int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			n, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+	v, err := strconv.ParseInt(n, 10, 64)
+	if err != nil || v < 0 || v > (1<<62)/unit {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return v * unit, nil
+}
+
+// limit adds the limit d sets on a parameter of m, which its argument starts
+// with, followed by the limit. //rpcgen:max limits the bytes of strings and
+// byte slices, and //rpcgen:maxlen the characters of strings and the
+// elements of slices and maps.
+func (r *InterfaceGen) limit(m *Method, d directive) {
+	fields := strings.Fields(d.arg)
+	if len(fields) != 2 {
+		r.fail(directiveError(r.fileset, d.comment, d.name, "directive %s%s needs a parameter name and a limit", directivePrefix, d.name))
+		return
+	}
+	limit := &Limit{Name: fields[0], Bytes: d.name == DirectiveMax}
+	var t *Type
+	for _, p := range m.Parameters {
+		for i, lowerName := range p.LowerNames {
+			if lowerName == limit.Name {
+				t, limit.Field = p, p.Names[i]
+			}
+		}
+	}
+	if t == nil {
+		r.fail(directiveError(r.fileset, d.comment, d.name, "method %s has no parameter %s to limit", m.Name, limit.Name))
+		return
+	}
+	var err error
+	if limit.Bytes {
+		limit.Max, err = parseSize(fields[1])
+	} else {
+		limit.Max, err = strconv.ParseInt(fields[1], 10, 64)
+		if err == nil && limit.Max < 0 {
+			err = fmt.Errorf("invalid length %q", fields[1])
+		}
+	}
+	if err != nil {
+		r.fail(directiveError(r.fileset, d.comment, d.name, "%s", err))
+		return
+	}
+	if !limitable(t.expr, limit.Bytes) {
+		r.fail(directiveError(r.fileset, d.comment, d.name, "parameter %s of type %s can't be limited by %s%s", limit.Name, t.Type, directivePrefix, d.name))
+		return
+	}
+	if id, ok := t.expr.(*ast.Ident); ok {
+		limit.String = id.Name == "string"
+	}
+	m.Limits = append(m.Limits, limit)
+}
+
+// paramDirectives returns the //rpcgen:max and //rpcgen:maxlen directives
+// in the comments following parameter field on its line, before end, as in
+// "data []byte, //rpcgen:max=1MB", with the names of the parameters of the
+// field put before their argument, as in the doc comment of the method.
+// Other directives are reported with their comment.
+func (r *InterfaceGen) paramDirectives(field *ast.Field, end token.Pos) []directive {
+	line := r.fileset.Position(field.End()).Line
+	var directives []directive
+	for _, group := range r.comments {
+		if group.Pos() < field.End() || group.Pos() >= end || r.fileset.Position(group.Pos()).Line != line {
+			continue
+		}
+		for _, d := range r.directives(group) {
+			if d.name != DirectiveMax && d.name != DirectiveMaxLen {
+				r.fail(directiveError(r.fileset, d.comment, d.name, "directive %s%s goes in the doc comment of the method, not after a parameter", directivePrefix, d.name))
+				continue
+			}
+			for _, name := range field.Names {
+				directives = append(directives, directive{name: d.name, arg: name.Name + " " + d.arg, comment: d.comment})
+			}
+		}
+	}
+	return directives
+}
+
+// limitable reports whether a field of type expr can be limited in bytes, if
+// bytes is set, or in characters or elements otherwise.
+func limitable(expr ast.Expr, bytes bool) bool {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name == "string"
+	case *ast.ArrayType:
+		elem, ok := t.Elt.(*ast.Ident)
+		return t.Len == nil && (!bytes || ok && (elem.Name == "byte" || elem.Name == "uint8"))
+	case *ast.MapType:
+		return !bytes
+	}
+	return false
+}
+
+// limitChecks returns the statements of a service method failing if the
+// request breaks the limits of method m of the service named service.
+func limitChecks(service string, m *Method) string {
+	var out []string
+	for _, l := range m.Limits {
+		size, what := fmt.Sprintf("len(request.%s)", l.Field), "elements"
+		switch {
+		case l.Bytes:
+			what = "bytes"
+		case l.String:
+			size, what = fmt.Sprintf("utf8.RuneCountInString(request.%s)", l.Field), "characters"
+		}
+		out = append(out, fmt.Sprintf("if %s > %d {\nreturn fmt.Errorf(%q, %s)\n}", size, l.Max,
+			fmt.Sprintf("%s.%s: %s has %%d %s, over the limit of %d", service, m.Name, l.Name, what, l.Max), size))
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Verbosity levels, selected with --quiet and --verbose.
+const (
+	verbosityQuiet   = -1
+	verbosityNormal  = 0
+	verbosityVerbose = 1
+)
+
+var verbosity = verbosityNormal
+
+// infof prints a progress message to stdout, unless --quiet is given.
+func infof(format string, args ...interface{}) {
+	if verbosity >= verbosityNormal {
+		fmt.Printf("%s: %s\n", os.Args[0], fmt.Sprintf(format, args...))
+	}
+}
+
+// debugf prints a message to stderr if --verbose is given.
+func debugf(format string, args ...interface{}) {
+	if verbosity >= verbosityVerbose {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], fmt.Sprintf(format, args...))
+	}
+}
+
+// timed logs how long the phase started at start took, if --verbose is
+// given. It is meant to be deferred.
+func timed(phase string, start time.Time) {
+	debugf("%s took %s", phase, time.Since(start).Round(time.Microsecond))
+}
+
+// verbosityFlag is a boolean flag setting the verbosity to its level.
+type verbosityFlag int
+
+func (f verbosityFlag) String() string { return "false" }
+
+func (f verbosityFlag) IsBoolFlag() bool { return true }
+
+func (f verbosityFlag) Set(s string) error {
+	set, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if set {
+		verbosity = int(f)
+	}
+	return nil
+}
+
+// addVerbosityFlags registers the --quiet and --verbose flags in fs.
+func addVerbosityFlags(fs *flag.FlagSet) {
+	fs.Var(verbosityFlag(verbosityQuiet), "quiet", "only print errors")
+	fs.Var(verbosityFlag(verbosityVerbose), "verbose", "print the interfaces and methods found and how long each phase takes")
+	fs.Var(verbosityFlag(verbosityVerbose), "v", "shorthand for --verbose")
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "encoding/json"
+
+// manifest describes a service for API catalogs and gateway configuration.
+// It is written as JSON next to the stubs with --manifest.
+type manifest struct {
+	// Service is the name the service is registered under.
+	Service string `json:"service"`
+	// Version is the version of the service, if any.
+	Version string `json:"version,omitempty"`
+	// Package and Interface name the interface the stubs implement.
+	Package   string `json:"package"`
+	Interface string `json:"interface"`
+	// Fingerprint is the SourceHash of the stubs, which Handshake compares.
+	Fingerprint string            `json:"fingerprint"`
+	Methods     []*manifestMethod `json:"methods"`
+	// Generator is the version of go-rpcgen that wrote the manifest.
+	Generator string `json:"generator"`
+}
+
+// manifestMethod is a method of the service, as called on the wire.
+type manifestMethod struct {
+	Name string `json:"name"`
+	// Call is the name clients call the method with, as in "Arith.Add".
+	Call string `json:"call"`
+	// Request and Response are the fields of the request and response
+	// structures, as encoded.
+	Request  []*manifestField `json:"request"`
+	Response []*manifestField `json:"response"`
+	// Notify, Job and Deprecated are the directives of the method.
+	Notify     bool   `json:"notify,omitempty"`
+	Job        bool   `json:"job,omitempty"`
+	Deprecated string `json:"deprecated,omitempty"`
+}
+
+// manifestField is a field of a request or response structure, with its Go
+// type as written in the interface.
+type manifestField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Optional reports whether the field can be missing: left nil, for the
+	// service to set it to Default, or left out of JSON when empty.
+	Optional bool   `json:"optional,omitempty"`
+	Default  string `json:"default,omitempty"`
+	// Unix is the unit of the Unix time a time.Time field is sent as, if
+	// any: seconds or milliseconds.
+	Unix string `json:"unix,omitempty"`
+	// Wire is the type a field of a type mapped by the wire_types option
+	// is sent as.
+	Wire string `json:"wire,omitempty"`
+}
+
+// manifest returns the JSON manifest of the service, whose interface is
+// declared in package pkg.
+func (r *RPCGen) manifest(pkg string) ([]byte, error) {
+	m := &manifest{
+		Service:     r.Service,
+		Version:     r.ServiceVersion,
+		Package:     pkg,
+		Interface:   r.Interface,
+		Fingerprint: r.SourceHash,
+		Methods:     []*manifestMethod{},
+		Generator:   r.Version,
+	}
+	for _, method := range r.Methods {
+		m.Methods = append(m.Methods, &manifestMethod{
+			Name:       method.Name,
+			Call:       r.Service + "." + method.Name,
+			Request:    manifestFields(method.Parameters, method.Defaults, method),
+			Response:   manifestFields(method.Results, nil, method),
+			Notify:     method.Notify,
+			Job:        method.Job,
+			Deprecated: method.Deprecated,
+		})
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func manifestFields(types []*Type, defaults []*Default, m *Method) []*manifestField {
+	fields := []*manifestField{}
+	for _, field := range wireFields(types) {
+		f := &manifestField{Name: field.name, Type: field.typ, Optional: m.OmitsEmpty(field.name), Unix: field.unix, Wire: field.wire}
+		if d := defaultOf(defaults, field.name); d != nil {
+			f.Optional, f.Default = true, d.Value
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// expandPatterns returns the Go source files matched by patterns. A pattern
+// is either a Go file, a directory, or a directory followed by "/..." to
+// include every directory below it, like the go tool's package patterns.
+// Directories the go tool ignores (vendor, testdata and names starting with
+// "." or "_") are skipped, and so are test files unless tests is set, and
+// files found in directories that ctxt, if not nil, excludes by build
+// constraints.
+func expandPatterns(patterns []string, ctxt *build.Context, tests bool) ([]string, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	seen := map[string]bool{}
+	var files []string
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, ".go") {
+			add(pattern)
+			continue
+		}
+		root := pattern
+		recursive := false
+		if pattern == "..." || strings.HasSuffix(pattern, "/...") {
+			root = strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+			if root == "" {
+				root = "."
+			}
+			recursive = true
+		}
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory or Go file", root)
+		}
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name := info.Name()
+			if info.IsDir() {
+				if path != root && (!recursive || ignoredName(name) || name == "vendor" || name == "testdata") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.HasSuffix(name, ".go") || (!tests && strings.HasSuffix(name, "_test.go")) || ignoredName(name) {
+				return nil
+			}
+			if ctxt != nil {
+				// Files that can't be read are left to the caller to report.
+				if match, err := ctxt.MatchFile(filepath.Dir(path), name); err == nil && !match {
+					return nil
+				}
+			}
+			add(path)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func ignoredName(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// writeTree writes files, by path relative to dir, holding their content.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExpandPatterns(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a.go":               "package a\n",
+		"a_test.go":          "package a\n",
+		"b/b.go":             "package b\n",
+		"b/c/c.go":           "package c\n",
+		"b/other.go":         "//go:build ignore\n\npackage b\n",
+		"vendor/v/v.go":      "package v\n",
+		"testdata/t/t.go":    "package t\n",
+		"_skipped/s.go":      "package s\n",
+		".hidden/h.go":       "package h\n",
+		"b/_generated.go":    "package b\n",
+		"b/notes.txt":        "not Go\n",
+		"b/c/d/deep_test.go": "package d\n",
+	})
+	tests := []struct {
+		name     string
+		patterns []string
+		tests    bool
+		want     []string
+	}{
+		{"directory", []string{dir}, false, []string{"a.go"}},
+		{"directory with tests", []string{dir}, true, []string{"a.go", "a_test.go"}},
+		{"recursive", []string{dir + "/..."}, false, []string{"a.go", "b/b.go", "b/c/c.go"}},
+		{"recursive with tests", []string{dir + "/..."}, true, []string{"a.go", "a_test.go", "b/b.go", "b/c/c.go", "b/c/d/deep_test.go"}},
+		{"subtree", []string{filepath.Join(dir, "b") + "/..."}, false, []string{"b/b.go", "b/c/c.go"}},
+		{"file", []string{filepath.Join(dir, "b", "other.go")}, false, []string{"b/other.go"}},
+		{"overlapping", []string{dir + "/...", filepath.Join(dir, "b")}, false, []string{"a.go", "b/b.go", "b/c/c.go"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files, err := expandPatterns(test.patterns, buildContext(""), test.tests)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, file := range files {
+				rel, _ := filepath.Rel(dir, file)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	if _, err := expandPatterns([]string{filepath.Join(dir, "missing") + "/..."}, nil, false); err == nil {
+		t.Error("a missing directory was accepted")
+	}
+	if _, err := expandPatterns([]string{filepath.Join(dir, "b", "notes.txt")}, nil, false); err == nil {
+		t.Error("a file other than Go source was accepted")
+	}
+}
+
+func TestAnnotatedTargets(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"arith/arith.go":      "package arith\n\n//go:generate go-rpcgen generate --source=arith.go --type=Arith\n\ntype Arith interface {\n\tAdd(a, b int) (sum int, err error)\n}\n",
+		"store/v1/store.go":   "package store\n\n//go:generate go run github.com/dobegor/go-rpcgen --source=store.go --type=Store --target=store.gen.go\n\ntype Store interface {\n\tGet(key string) (value string, err error)\n}\n",
+		"store/v1/version.go": "package store\n\n//go:generate go-rpcgen version\n",
+		"other/other.go":      "package other\n\n//go:generate stringer -type=Kind\n",
+	})
+	targets, failed, err := annotatedTargets([]string{dir + "/..."})
+	if err != nil || failed {
+		t.Fatalf("annotatedTargets failed: %v", err)
+	}
+	var got []string
+	for _, opts := range targets {
+		rel, _ := filepath.Rel(dir, opts.Target)
+		got = append(got, opts.Type+" "+filepath.ToSlash(rel))
+	}
+	want := []string{"Arith arith/arithrpc.gen.go", "Store store/v1/store.gen.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got targets %q, want %q", got, want)
+	}
+}
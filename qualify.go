@@ -0,0 +1,322 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// predeclared are the predeclared type names, which never need qualifying.
+var predeclared = map[string]bool{
+	"any": true, "bool": true, "byte": true, "comparable": true,
+	"complex64": true, "complex128": true, "error": true,
+	"float32": true, "float64": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"rune": true, "string": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"uintptr": true,
+}
+
+// qualifier rewrites types declared in the source package so that they can
+// be referred to from generated code in another package.
+type qualifier struct {
+	name string // name of the source package
+	path string // import path of the source package
+}
+
+func newQualifier(f *ast.File, dir string) (*qualifier, error) {
+	path, err := importPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &qualifier{name: f.Name.Name, path: path}, nil
+}
+
+// imports returns the import of the source package.
+func (q *qualifier) imports() map[string]string {
+	name := ""
+	if filepath.Base(q.path) != q.name {
+		name = q.name
+	}
+	return map[string]string{q.path: name}
+}
+
+// methods returns copies of methods with the parameter and result types, and
+// the types of their defaults, qualified, and whether any type needed
+// qualifying.
+func (q *qualifier) methods(methods []*Method) ([]*Method, bool, error) {
+	var out []*Method
+	qualified := false
+	for _, m := range methods {
+		copied := *m
+		var err error
+		var used bool
+		if copied.Parameters, used, err = q.fields(m.Parameters); err != nil {
+			return nil, false, fmt.Errorf("method %s: %s", m.Name, err)
+		}
+		qualified = qualified || used
+		if copied.Results, used, err = q.fields(m.Results); err != nil {
+			return nil, false, fmt.Errorf("method %s: %s", m.Name, err)
+		}
+		qualified = qualified || used
+		copied.Defaults = nil
+		for _, d := range m.Defaults {
+			def := *d
+			expr, err := parser.ParseExpr(d.Type)
+			if err != nil {
+				return nil, false, err
+			}
+			if expr, used, err = q.qualify(expr); err != nil {
+				return nil, false, fmt.Errorf("method %s: %s", m.Name, err)
+			}
+			var buf bytes.Buffer
+			_ = printer.Fprint(&buf, token.NewFileSet(), expr)
+			def.Type = buf.String()
+			qualified = qualified || used
+			copied.Defaults = append(copied.Defaults, &def)
+		}
+		out = append(out, &copied)
+	}
+	return out, qualified, nil
+}
+
+// enums returns copies of enums with their types and constants qualified.
+func (q *qualifier) enums(enums []*Enum) ([]*Enum, error) {
+	var out []*Enum
+	for _, e := range enums {
+		if !ast.IsExported(e.Name) {
+			return nil, fmt.Errorf("unexported type %s can't be used from another package", e.Name)
+		}
+		copied := *e
+		copied.Type = q.name + "." + e.Name
+		copied.Constants = nil
+		for _, c := range e.Constants {
+			if !ast.IsExported(c.Name) {
+				return nil, fmt.Errorf("unexported constant %s of %s can't be used from another package", c.Name, e.Name)
+			}
+			constant := *c
+			constant.Name = q.name + "." + c.Name
+			copied.Constants = append(copied.Constants, &constant)
+		}
+		out = append(out, &copied)
+	}
+	return out, nil
+}
+
+func (q *qualifier) fields(fields []*Type) ([]*Type, bool, error) {
+	out := []*Type{}
+	qualified := false
+	for _, field := range fields {
+		copied := *field
+		// Work on a fresh copy of the expression, as it is modified in place.
+		expr, err := parser.ParseExpr(field.Type)
+		if err != nil {
+			return nil, false, err
+		}
+		expr, used, err := q.qualify(expr)
+		if err != nil {
+			return nil, false, err
+		}
+		var buf bytes.Buffer
+		_ = printer.Fprint(&buf, token.NewFileSet(), expr)
+		copied.Type = buf.String()
+		copied.expr = expr
+		qualified = qualified || used
+		out = append(out, &copied)
+	}
+	return out, qualified, nil
+}
+
+// qualify returns expr with the names of source package types it references
+// replaced by selector expressions of the package name, and reports whether
+// there were any. Composite expressions are rewritten in place.
+func (q *qualifier) qualify(expr ast.Expr) (ast.Expr, bool, error) {
+	var used bool
+	var err error
+	switch n := expr.(type) {
+	case *ast.Ident:
+		if predeclared[n.Name] {
+			return n, false, nil
+		}
+		if !ast.IsExported(n.Name) {
+			return nil, false, fmt.Errorf("unexported type %s can't be used from another package", n.Name)
+		}
+		return &ast.SelectorExpr{X: ast.NewIdent(q.name), Sel: ast.NewIdent(n.Name)}, true, nil
+	case *ast.SelectorExpr:
+		return n, false, nil
+	case *ast.StarExpr:
+		n.X, used, err = q.qualify(n.X)
+	case *ast.ParenExpr:
+		n.X, used, err = q.qualify(n.X)
+	case *ast.Ellipsis:
+		n.Elt, used, err = q.qualify(n.Elt)
+	case *ast.ArrayType:
+		n.Elt, used, err = q.qualify(n.Elt)
+	case *ast.ChanType:
+		n.Value, used, err = q.qualify(n.Value)
+	case *ast.MapType:
+		used, err = q.qualifyAll(&n.Key, &n.Value)
+	case *ast.IndexExpr:
+		used, err = q.qualifyAll(&n.X, &n.Index)
+	case *ast.IndexListExpr:
+		exprs := []*ast.Expr{&n.X}
+		for i := range n.Indices {
+			exprs = append(exprs, &n.Indices[i])
+		}
+		used, err = q.qualifyAll(exprs...)
+	case *ast.FuncType:
+		used, err = q.qualifyFields(n.Params, n.Results)
+	case *ast.StructType:
+		used, err = q.qualifyFields(n.Fields)
+	case *ast.InterfaceType:
+		used, err = q.qualifyFields(n.Methods)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return expr, used, nil
+}
+
+// qualifyAll qualifies the expressions exprs point to, replacing them.
+func (q *qualifier) qualifyAll(exprs ...*ast.Expr) (bool, error) {
+	qualified := false
+	for _, expr := range exprs {
+		qualifiedExpr, used, err := q.qualify(*expr)
+		if err != nil {
+			return false, err
+		}
+		*expr = qualifiedExpr
+		qualified = qualified || used
+	}
+	return qualified, nil
+}
+
+func (q *qualifier) qualifyFields(lists ...*ast.FieldList) (bool, error) {
+	var exprs []*ast.Expr
+	for _, list := range lists {
+		if list != nil {
+			for _, field := range list.List {
+				exprs = append(exprs, &field.Type)
+			}
+		}
+	}
+	return q.qualifyAll(exprs...)
+}
+
+// checkResolvable checks that the packages imported by a file generated in
+// dir, which may belong to another module than the source, can be imported
+// there. The go command resolves them, following go.work workspaces.
+func checkResolvable(dir string, imports map[string]string) error {
+	var paths []string
+	for path := range imports {
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	sort.Strings(paths)
+	// The directory is only created when the stubs are written.
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	args := append([]string{"list", "-mod=readonly", "-e", "-find", "-f", "{{if .Error}}{{.ImportPath}}: {{.Error.Err}}{{end}}"}, paths...)
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to resolve imports from %s: %s", dir, strings.TrimSpace(stderr.String()))
+	}
+	if problems := strings.TrimSpace(string(out)); problems != "" {
+		return fileError(dir, CodeUnresolvedImport, "generated code can't import %s", strings.Replace(problems, "\n", "; ", -1))
+	}
+	return nil
+}
+
+// listImportPath runs go list to find the import path of the package in dir.
+func listImportPath(dir string) (string, error) {
+	cmd := exec.Command("go", "list", "-f", "{{.ImportPath}}", ".")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine import path of %s: %s", dir, strings.TrimSpace(stderr.String()))
+	}
+	path := strings.TrimSpace(string(out))
+	if strings.HasPrefix(path, "_") || path == "command-line-arguments" {
+		return "", fmt.Errorf("failed to determine import path of %s: not in a module or GOPATH", dir)
+	}
+	return path, nil
+}
+
+// packageName returns the name of the package in dir, taken from its
+// existing Go files or, if there are none, from the directory name.
+func packageName(dir string) (string, error) {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, m := range matches {
+		if strings.HasSuffix(m, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), m, nil, parser.PackageClauseOnly)
+		if err != nil {
+			return "", err
+		}
+		return f.Name.Name, nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, filepath.Base(abs))
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		return "", fmt.Errorf("can't derive a package name from directory %s", dir)
+	}
+	return name, nil
+}
+
+func sameDir(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	if a == b {
+		return true
+	}
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQualifyFields(t *testing.T) {
+	q := &qualifier{name: "store", path: "example.com/store"}
+	tests := []struct {
+		typ       string
+		want      string
+		qualified bool
+		err       string
+	}{
+		{typ: "int", want: "int"},
+		{typ: "[]byte", want: "[]byte"},
+		{typ: "time.Time", want: "time.Time"},
+		{typ: "Item", want: "store.Item", qualified: true},
+		{typ: "*Item", want: "*store.Item", qualified: true},
+		{typ: "[4][]*Item", want: "[4][]*store.Item", qualified: true},
+		{typ: "map[Key]time.Duration", want: "map[store.Key]time.Duration", qualified: true},
+		{typ: "Page[Item]", want: "store.Page[store.Item]", qualified: true},
+		{typ: "Page[Pair[string, Item]]", want: "store.Page[store.Pair[string, store.Item]]", qualified: true},
+		{typ: "Pair[Page[*Item], map[string][]Item]", want: "store.Pair[store.Page[*store.Item], map[string][]store.Item]", qualified: true},
+		{typ: "func(Item) (Page[Item], error)", want: "func(store.Item) (store.Page[store.Item], error)", qualified: true},
+		{typ: "chan<- func() *Item", want: "chan<- func() *store.Item", qualified: true},
+		{typ: "struct{ A Item }", want: "struct{ A store.Item }", qualified: true},
+		{typ: "Page[item]", err: "unexported type item"},
+	}
+	for _, test := range tests {
+		t.Run(test.typ, func(t *testing.T) {
+			fields := []*Type{{Type: test.typ, Names: []string{"V"}, LowerNames: []string{"v"}}}
+			out, qualified, err := q.fields(fields)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out[0].Type != test.want || qualified != test.qualified {
+				t.Errorf("got %s, %v, want %s, %v", out[0].Type, qualified, test.want, test.qualified)
+			}
+			if fields[0].Type != test.typ {
+				t.Errorf("the source field was modified to %s", fields[0].Type)
+			}
+		})
+	}
+}
+
+// TestQualifyGolden generates the stubs of an interface with generic and
+// qualified types into an external test package, which refers to the source
+// package by name.
+func TestQualifyGolden(t *testing.T) {
+	renderGolden(t, "qualify", Options{
+		Source:  "testdata/qualify/store.go",
+		Type:    "Store",
+		Package: "store_test",
+	})
+}
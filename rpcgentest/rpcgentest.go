@@ -0,0 +1,270 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rpcgentest tests custom templates, plugins and config with golden
+// files: it runs go-rpcgen on the interfaces of a testdata directory and
+// compares the files it generates with those checked in next to them.
+//
+//	func TestStubs(t *testing.T) {
+//		rpcgentest.Run(t, "testdata")
+//	}
+//
+// Each directory of testdata is a case, run as a subtest named after it,
+// holding the source files and usually an rpcgen.yaml listing the services
+// to generate. The expected content of each file go-rpcgen writes there is
+// kept in the same path with a .golden suffix. Running the tests with
+// RPCGEN_UPDATE=1 rewrites the golden files with what go-rpcgen generates
+// instead, and removes those of files it no longer writes. It is an
+// environment variable rather than a flag so that it never clashes with the
+// flags of the package under test, such as its own -update.
+//
+// Cases holding _test.go files also have their tests run with go test once
+// the stubs are generated, so that they can call the generated code, for
+// example serving an implementation and calling it through the client.
+// Those cases are generated inside the package of the test calling Run, in a
+// directory starting with an underscore, so that they build in its module
+// with its dependencies, and go commands listing ./... skip them.
+package rpcgentest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// goldenSuffix is the suffix of golden files.
+const goldenSuffix = ".golden"
+
+// UpdateEnv is the environment variable which, when set to a non-empty value,
+// makes Run rewrite the golden files instead of comparing them.
+const UpdateEnv = "RPCGEN_UPDATE"
+
+// Command is the go-rpcgen command Run runs, followed by the generate command
+// and its arguments. It defaults to the go-rpcgen found in PATH; tests can set
+// it to run another build, such as
+// []string{"go", "run", "github.com/alecthomas/go-rpcgen"} to use the
+// version the module requires.
+var Command = []string{"go-rpcgen"}
+
+// Run runs go-rpcgen generate with args in a copy of each directory of dir,
+// without its golden files, and fails the subtest of the directory for every
+// generated file whose golden file is missing or differs, and every golden
+// file of a file that isn't generated. With UpdateEnv set, the golden files
+// are rewritten instead.
+func Run(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		caseDir := filepath.Join(dir, entry.Name())
+		t.Run(entry.Name(), func(t *testing.T) {
+			runCase(t, caseDir, args)
+		})
+	}
+}
+
+// runCase generates the files of the case in dir, compares them with its
+// golden files and runs its tests, if any.
+func runCase(t *testing.T, dir string, args []string) {
+	t.Helper()
+	inputs, golden, err := readCase(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	work, err := workDir(t, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range inputs {
+		if err := writeFile(filepath.Join(work, name), content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(Command[0], append(append(append([]string{}, Command[1:]...), "generate"), args...)...)
+	cmd.Dir = work
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s generate %s: %s\n%s", strings.Join(Command, " "), strings.Join(args, " "), err, out)
+	}
+	generated, err := generatedFiles(work, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.Getenv(UpdateEnv) != "" {
+		for name := range golden {
+			if _, ok := generated[name]; !ok {
+				if err := os.Remove(filepath.Join(dir, name+goldenSuffix)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		for name, content := range generated {
+			if err := writeFile(filepath.Join(dir, name+goldenSuffix), content); err != nil {
+				t.Fatal(err)
+			}
+		}
+	} else {
+		compare(t, generated, golden)
+	}
+	if hasTests(inputs) {
+		test := exec.Command("go", "test", "-count=1", "./...")
+		test.Dir = work
+		if out, err := test.CombinedOutput(); err != nil {
+			t.Errorf("go test: %s\n%s", err, out)
+		}
+	}
+}
+
+// compare fails the test for every generated file that differs from its
+// golden file or has none, and every golden file of a file that wasn't
+// generated.
+func compare(t *testing.T, generated, golden map[string][]byte) {
+	t.Helper()
+	for _, name := range sortedNames(generated) {
+		want, ok := golden[name]
+		switch {
+		case !ok:
+			t.Errorf("%s was generated but has no golden file; run the tests with %s=1 to add it", name, UpdateEnv)
+		case !bytes.Equal(generated[name], want):
+			t.Errorf("%s differs from its golden file; run the tests with %s=1 to accept it\n%s", name, UpdateEnv, firstDifference(want, generated[name]))
+		}
+	}
+	for _, name := range sortedNames(golden) {
+		if _, ok := generated[name]; !ok {
+			t.Errorf("%s has a golden file but wasn't generated", name)
+		}
+	}
+}
+
+// workDir returns the directory to generate the case with inputs in: a
+// temporary directory, or for cases with tests one in the working
+// directory, which is removed once the test ends.
+func workDir(t *testing.T, inputs map[string][]byte) (string, error) {
+	if !hasTests(inputs) {
+		return t.TempDir(), nil
+	}
+	dir, err := ioutil.TempDir(".", "_rpcgentest")
+	if err != nil {
+		return "", err
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Abs(dir)
+}
+
+// hasTests reports whether some of the files of a case are Go tests.
+func hasTests(inputs map[string][]byte) bool {
+	for name := range inputs {
+		if strings.HasSuffix(name, "_test.go") {
+			return true
+		}
+	}
+	return false
+}
+
+// readCase returns the contents of the files of the case in dir, and of its
+// golden files by the name of the file they hold the content of, by path
+// relative to dir.
+func readCase(dir string) (inputs, golden map[string][]byte, err error) {
+	inputs, golden = map[string][]byte{}, map[string][]byte{}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(name, goldenSuffix) {
+			golden[strings.TrimSuffix(name, goldenSuffix)] = content
+		} else {
+			inputs[name] = content
+		}
+		return nil
+	})
+	return inputs, golden, err
+}
+
+// generatedFiles returns the contents of the files in dir that are not among
+// inputs or differ from them, by path relative to dir.
+func generatedFiles(dir string, inputs map[string][]byte) (map[string][]byte, error) {
+	generated := map[string][]byte{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if input, ok := inputs[name]; !ok || !bytes.Equal(input, content) {
+			generated[name] = content
+		}
+		return nil
+	})
+	return generated, err
+}
+
+// firstDifference describes the first line where got differs from want.
+func firstDifference(want, got []byte) string {
+	wantLines, gotLines := strings.Split(string(want), "\n"), strings.Split(string(got), "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g || i >= len(wantLines) || i >= len(gotLines) {
+			return fmt.Sprintf("line %d:\n\twant: %s\n\tgot:  %s", i+1, w, g)
+		}
+	}
+	return ""
+}
+
+// writeFile writes content to path, creating its directory.
+func writeFile(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0666)
+}
+
+// sortedNames returns the names of files in order.
+func sortedNames(files map[string][]byte) []string {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
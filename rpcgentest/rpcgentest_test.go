@@ -0,0 +1,70 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcgentest
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// An -update flag of the package under test must not clash with Run.
+var _ = flag.Bool("update", false, "the package's own -update flag")
+
+// TestMain builds the go-rpcgen of this module for Run to use, without
+// version control stamping so that the version in the golden files stays
+// devel.
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "rpcgentest")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	binary := filepath.Join(dir, "go-rpcgen")
+	if out, err := exec.Command("go", "build", "-buildvcs=false", "-o", binary, "..").CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "building go-rpcgen: %s\n%s", err, out)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	Command = []string{binary}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestRun(t *testing.T) {
+	Run(t, "testdata")
+}
+
+func TestFirstDifference(t *testing.T) {
+	tests := []struct {
+		want, got string
+		diff      string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"a\nb\n", "a\nc\n", "line 2:\n\twant: b\n\tgot:  c"},
+		{"a\n", "a\nb\n", "line 2:\n\twant: \n\tgot:  b"},
+		{"a\nb", "a", "line 2:\n\twant: b\n\tgot:  "},
+	}
+	for _, test := range tests {
+		if diff := firstDifference([]byte(test.want), []byte(test.got)); diff != test.diff {
+			t.Errorf("firstDifference(%q, %q) = %q, want %q", test.want, test.got, diff, test.diff)
+		}
+	}
+}
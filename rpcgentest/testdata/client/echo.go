@@ -0,0 +1,10 @@
+package echo
+
+// Echo echoes messages.
+type Echo interface {
+	// Echo returns message.
+	Echo(message string) (reply string, err error)
+	// Slow returns message, but may take its time.
+	//rpcgen:timeout=50ms
+	Slow(message string) (reply string, err error)
+}
@@ -0,0 +1,35 @@
+package echo
+
+import (
+	"net"
+	"testing"
+)
+
+// gated is an Echo whose calls signal started, then wait for release to be
+// closed.
+type gated struct {
+	started chan string
+	release chan struct{}
+}
+
+func newGated() *gated {
+	return &gated{started: make(chan string, 16), release: make(chan struct{})}
+}
+
+func (g *gated) Echo(message string) (string, error) {
+	g.started <- message
+	<-g.release
+	return message, nil
+}
+
+func (g *gated) Slow(message string) (string, error) { return g.Echo(message) }
+
+// dial serves impl and returns a client with opts calling it.
+func dial(t *testing.T, impl Echo, opts ...EchoClientOption) *EchoClient {
+	t.Helper()
+	server, conn := net.Pipe()
+	go ServeEchoConn(server, impl)
+	client := NewEchoClientConn(conn, opts...)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
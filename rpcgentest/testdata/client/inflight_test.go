@@ -0,0 +1,83 @@
+package echo
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMaxInFlightFailsFast(t *testing.T) {
+	impl := newGated()
+	client := dial(t, impl, WithEchoMaxInFlight(1, false))
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := client.Echo("first")
+		first <- err
+	}()
+	<-impl.started
+	if _, err := client.Echo("second"); err != ErrEchoTooManyCalls {
+		t.Errorf("Echo beyond the limit returned %v, want %v", err, ErrEchoTooManyCalls)
+	}
+	close(impl.release)
+	if err := <-first; err != nil {
+		t.Errorf("the first Echo failed: %v", err)
+	}
+	if reply, err := client.Echo("third"); err != nil || reply != "third" {
+		t.Errorf("Echo once below the limit = %q, %v, want third", reply, err)
+	}
+}
+
+func TestMaxInFlightWaits(t *testing.T) {
+	impl := newGated()
+	client := dial(t, impl, WithEchoMaxInFlight(1, true))
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := client.Echo("first")
+		first <- err
+	}()
+	<-impl.started
+	second := make(chan error, 1)
+	go func() {
+		_, err := client.Echo("second")
+		second <- err
+	}()
+	select {
+	case err := <-second:
+		t.Fatalf("Echo beyond the limit returned %v rather than wait", err)
+	case message := <-impl.started:
+		t.Fatalf("%s reached the service beyond the limit", message)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(impl.release)
+	for _, done := range []chan error{first, second} {
+		if err := <-done; err != nil {
+			t.Errorf("Echo failed: %v", err)
+		}
+	}
+}
+
+func TestMaxInFlightCountsTimedOutAttempts(t *testing.T) {
+	impl := newGated()
+	client := dial(t, impl, WithEchoMaxInFlight(1, false), WithEchoClientTimeout(20*time.Millisecond))
+
+	if _, err := client.Echo("first"); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Echo returned %v, want a timeout", err)
+	}
+	// The attempt timed out, but its response has yet to arrive.
+	if _, err := client.Echo("second"); err != ErrEchoTooManyCalls {
+		t.Errorf("Echo while the late response is due returned %v, want %v", err, ErrEchoTooManyCalls)
+	}
+	close(impl.release)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		_, err := client.Echo("third")
+		if err == nil {
+			break
+		}
+		if err != ErrEchoTooManyCalls || time.Now().After(deadline) {
+			t.Fatalf("Echo once the late response arrived returned %v", err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package echo
+
+import (
+	"errors"
+	"net/rpc"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flaky is an Echo failing its first failures calls.
+type flaky struct {
+	failures int32
+}
+
+func (f *flaky) Echo(message string) (string, error) {
+	if atomic.AddInt32(&f.failures, -1) >= 0 {
+		return "", errors.New("flaked")
+	}
+	return message, nil
+}
+
+func (f *flaky) Slow(message string) (string, error) { return f.Echo(message) }
+
+func TestClientInterceptors(t *testing.T) {
+	var calls []string
+	intercept := func(name string) EchoClientOption {
+		return WithEchoClientInterceptor(func(method string, request interface{}, handler func() error) error {
+			req, ok := request.(*EchoEchoRequest)
+			if !ok || method != "Echo" || req.Message != "hi" {
+				t.Errorf("%s intercepted %s(%#v)", name, method, request)
+			}
+			calls = append(calls, name+">")
+			err := handler()
+			calls = append(calls, "<"+name)
+			return err
+		})
+	}
+	retry := WithEchoRetryPolicy(func(string, int, error) (time.Duration, bool) { return 0, true })
+	client := dial(t, &flaky{failures: 2}, intercept("outer"), intercept("inner"), retry)
+
+	if reply, err := client.Echo("hi"); err != nil || reply != "hi" {
+		t.Fatalf("Echo = %q, %v, want hi", reply, err)
+	}
+	// Retries happen within the interceptors.
+	if want := []string{"outer>", "inner>", "<inner", "<outer"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("interceptors were called as %q, want %q", calls, want)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	impl := newGated()
+	defer close(impl.release)
+	client := dial(t, impl, WithEchoClientTimeout(20*time.Millisecond))
+
+	reply, err := client.Echo("late")
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Echo returned %v, want a timeout", err)
+	}
+	if reply != "" {
+		t.Errorf("Echo stored the late reply %q", reply)
+	}
+
+	// Slow has a default deadline of its own, and WithTimeout overrides both.
+	start := time.Now()
+	if _, err := client.Slow("late"); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Slow returned %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Slow timed out after %s, before its default deadline", elapsed)
+	}
+	if _, err := client.WithTimeout(10 * time.Millisecond).Slow("late"); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Slow with a timeout returned %v, want a timeout", err)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var attempts []int
+	policy := func(method string, attempt int, err error) (time.Duration, bool) {
+		if _, ok := err.(rpc.ServerError); !ok || method != "Echo" {
+			t.Errorf("policy was given %s and %#v", method, err)
+		}
+		attempts = append(attempts, attempt)
+		return time.Millisecond, attempt < 3
+	}
+
+	client := dial(t, &flaky{failures: 2}, WithEchoRetryPolicy(policy))
+	if reply, err := client.Echo("hi"); err != nil || reply != "hi" {
+		t.Errorf("Echo = %q, %v, want hi", reply, err)
+	}
+	if want := []int{1, 2}; !reflect.DeepEqual(attempts, want) {
+		t.Errorf("policy was asked about attempts %v, want %v", attempts, want)
+	}
+
+	attempts = nil
+	client = dial(t, &flaky{failures: 3}, WithEchoRetryPolicy(policy))
+	if _, err := client.Echo("hi"); err == nil || err.Error() != "flaked" {
+		t.Errorf("Echo once the policy gave up returned %v, want flaked", err)
+	}
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(attempts, want) {
+		t.Errorf("policy was asked about attempts %v, want %v", attempts, want)
+	}
+}
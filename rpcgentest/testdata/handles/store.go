@@ -0,0 +1,16 @@
+package store
+
+// Store holds buckets.
+type Store interface {
+	OpenBucket(name string) (b Bucket, err error)
+	Count() (n int, err error)
+}
+
+// Bucket is a bucket of the store, served through handles.
+//
+//rpcgen:handle
+type Bucket interface {
+	Get(key string) (value string, err error)
+	Put(key, value string) (err error)
+	Sub(name string) (n int, sub Bucket, err error)
+}
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type store struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func newStore() *store { return &store{buckets: map[string]*bucket{}} }
+
+func (s *store) OpenBucket(name string) (Bucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[name]
+	if !ok {
+		b = newBucket()
+		s.buckets[name] = b
+	}
+	return b, nil
+}
+
+func (s *store) Count() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets), nil
+}
+
+type bucket struct {
+	mu     sync.Mutex
+	values map[string]string
+	subs   map[string]*bucket
+}
+
+func newBucket() *bucket { return &bucket{values: map[string]string{}, subs: map[string]*bucket{}} }
+
+func (b *bucket) Get(key string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	value, ok := b.values[key]
+	if !ok {
+		return "", fmt.Errorf("no key %s", key)
+	}
+	return value, nil
+}
+
+func (b *bucket) Put(key, value string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.values[key] = value
+	return nil
+}
+
+func (b *bucket) Sub(name string) (int, Bucket, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub, ok := b.subs[name]
+	if !ok {
+		sub = newBucket()
+		b.subs[name] = sub
+	}
+	return len(b.subs), sub, nil
+}
+
+func handleCount() int {
+	_BucketHandleTables.Lock()
+	defer _BucketHandleTables.Unlock()
+	return len(_BucketHandleTables.tables)
+}
+
+func TestHandles(t *testing.T) {
+	server, conn := net.Pipe()
+	done := make(chan error)
+	go func() { done <- ServeStoreConn(server, newStore()) }()
+	client := NewStoreClientConn(conn)
+
+	b, err := client.OpenBucket("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := b.Get("k"); err != nil || v != "v" {
+		t.Errorf("Get(k) = %q, %v, want v", v, err)
+	}
+	n, sub, err := b.Sub("x")
+	if err != nil || n != 1 {
+		t.Fatalf("Sub(x) = %d, %v, want 1", n, err)
+	}
+	if err := sub.Put("k", "w"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := sub.Get("k"); err != nil || v != "w" {
+		t.Errorf("sub Get(k) = %q, %v, want w", v, err)
+	}
+	if n, err := client.Count(); err != nil || n != 1 {
+		t.Errorf("Count() = %d, %v, want 1", n, err)
+	}
+
+	if err := b.(*BucketClient).Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Get("k"); err == nil || !strings.Contains(err.Error(), "unknown handle") {
+		t.Errorf("Get after Release returned %v, want unknown handle", err)
+	}
+	if v, err := sub.Get("k"); err != nil || v != "w" {
+		t.Errorf("sub Get(k) after releasing its parent = %q, %v, want w", v, err)
+	}
+
+	if handleCount() == 0 {
+		t.Error("no handle table while the connection is open")
+	}
+	client.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := handleCount(); n != 0 {
+		t.Errorf("%d handle tables left once the connection is closed", n)
+	}
+}
+
+func TestHandlesPerConnection(t *testing.T) {
+	server := rpc.NewServer()
+	if err := RegisterStoreService(server, newStore()); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterBucketService(server, newBucket()); err != nil {
+		t.Fatal(err)
+	}
+	dial := func() *rpc.Client {
+		s, c := net.Pipe()
+		go server.ServeCodec(NewStoreHandleCodec(jsonrpc.NewServerCodec(s)))
+		return jsonrpc.NewClient(c)
+	}
+	rpc1, rpc2 := dial(), dial()
+	defer rpc1.Close()
+	defer rpc2.Close()
+
+	b, err := NewStoreClient(rpc1).OpenBucket("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	stolen := _newBucketClientHandle(rpc2, b.(*BucketClient).handle)
+	if _, err := stolen.Get("k"); err == nil || !strings.Contains(err.Error(), "unknown handle") {
+		t.Errorf("Get through the handle of another connection returned %v, want unknown handle", err)
+	}
+
+	direct := NewBucketClient(rpc2)
+	if err := direct.Put("k", "direct"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := b.Get("k"); err != nil || v != "v" {
+		t.Errorf("Get(k) through the handle = %q, %v, want v", v, err)
+	}
+	if v, err := direct.Get("k"); err != nil || v != "direct" {
+		t.Errorf("Get(k) on the registered bucket = %q, %v, want direct", v, err)
+	}
+}
+
+func TestHandlesWithoutCodec(t *testing.T) {
+	server := rpc.NewServer()
+	if err := RegisterStoreService(server, newStore()); err != nil {
+		t.Fatal(err)
+	}
+	s, c := net.Pipe()
+	go server.ServeConn(s)
+	client := NewStoreClientConn(c)
+	defer client.Close()
+	if _, err := client.OpenBucket("a"); err == nil || !strings.Contains(err.Error(), "NewStoreHandleCodec") {
+		t.Errorf("OpenBucket without a handle codec returned %v, want an error naming NewStoreHandleCodec", err)
+	}
+	if n, err := client.Count(); err != nil || n != 0 {
+		t.Errorf("Count() = %d, %v, want 0", n, err)
+	}
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memConn is one end of an in-memory connection.
+type memConn struct {
+	in, out chan []byte
+	done    chan struct{}
+	once    *sync.Once
+}
+
+func (c *memConn) ReadFrame() ([]byte, error) {
+	select {
+	case frame := <-c.in:
+		return frame, nil
+	case <-c.done:
+		return nil, io.EOF
+	}
+}
+
+func (c *memConn) WriteFrame(frame []byte) error {
+	select {
+	case c.out <- frame:
+		return nil
+	case <-c.done:
+		return io.ErrClosedPipe
+	}
+}
+
+func (c *memConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return nil
+}
+
+// memTransport is an in-memory transport, which stops accepting connections
+// once closed.
+type memTransport struct {
+	conns  chan StoreConn
+	closed chan struct{}
+}
+
+var errTransportClosed = errors.New("transport closed")
+
+func (t *memTransport) Dial() (StoreConn, error) {
+	a, b := make(chan []byte, 16), make(chan []byte, 16)
+	done, once := make(chan struct{}), &sync.Once{}
+	t.conns <- &memConn{in: a, out: b, done: done, once: once}
+	return &memConn{in: b, out: a, done: done, once: once}, nil
+}
+
+func (t *memTransport) Accept() (StoreConn, error) {
+	select {
+	case conn := <-t.conns:
+		return conn, nil
+	case <-t.closed:
+		return nil, errTransportClosed
+	}
+}
+
+func TestHandlesTransport(t *testing.T) {
+	transport := &memTransport{conns: make(chan StoreConn), closed: make(chan struct{})}
+	served := make(chan error)
+	go func() { served <- ServeStoreTransport(transport, newStore()) }()
+
+	client, err := DialStoreClientTransport(transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := client.OpenBucket("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := b.Get("k"); err != nil || v != "v" {
+		t.Errorf("Get(k) = %q, %v, want v", v, err)
+	}
+	client.Close()
+	for deadline := time.Now().Add(time.Second); handleCount() != 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d handle tables left once the connection is closed", handleCount())
+		}
+	}
+
+	close(transport.closed)
+	if err := <-served; err != errTransportClosed {
+		t.Errorf("ServeStoreTransport returned %v, want the error of Accept", err)
+	}
+}
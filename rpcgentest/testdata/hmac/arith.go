@@ -0,0 +1,7 @@
+package arith
+
+// Arith does arithmetic.
+type Arith interface {
+	Add(a, b int) (sum int, err error)
+	Div(a, b int) (quotient, remainder int, err error)
+}
@@ -0,0 +1,139 @@
+package arith
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"io"
+	"net"
+	"net/rpc"
+	"strings"
+	"testing"
+	"time"
+)
+
+var key = []byte("0123456789abcdef0123456789abcdef")
+
+type arith struct{}
+
+func (arith) Add(a, b int) (int, error) { return a + b, nil }
+
+func (arith) Div(a, b int) (int, int, error) { return a / b, a % b, nil }
+
+// recorder keeps a copy of the bytes written on a connection.
+type recorder struct {
+	io.ReadWriteCloser
+	written bytes.Buffer
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.written.Write(p)
+	return r.ReadWriteCloser.Write(p)
+}
+
+func serve(t *testing.T) net.Conn {
+	server, conn := net.Pipe()
+	go ServeArithConnHMAC(server, key, arith{})
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// send sends the signed request for Add(1, 2) with seq, signed at at with
+// key, and whose body tamper changes after signing, and returns the error of
+// the response.
+func send(t *testing.T, conn net.Conn, key []byte, seq uint64, at time.Time, tamper func([]byte) []byte) string {
+	var body bytes.Buffer
+	if err := gob.NewEncoder(&body).Encode(&ArithAddRequest{A: 1, B: 2}); err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	signed := &ArithSignedRequest{body.Bytes(), at.UnixNano(), nonce, ArithRequestMAC(key, ArithAddMethod, body.Bytes(), at.UnixNano(), nonce)}
+	signed.Body = tamper(signed.Body)
+	go func() {
+		enc := gob.NewEncoder(conn)
+		enc.Encode(&rpc.Request{ServiceMethod: ArithAddMethod, Seq: seq})
+		enc.Encode(signed)
+	}()
+	var response rpc.Response
+	if err := gob.NewDecoder(conn).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return response.Error
+}
+
+func keep(b []byte) []byte { return b }
+
+func TestHMACRoundTrip(t *testing.T) {
+	client := NewArithClientConnHMAC(serve(t), key)
+	for i := 0; i < 3; i++ {
+		if sum, err := client.Add(i, 3); err != nil || sum != i+3 {
+			t.Errorf("Add(%d, 3) = %d, %v, want %d", i, sum, err, i+3)
+		}
+	}
+}
+
+func TestHMACWrongKey(t *testing.T) {
+	client := NewArithClientConnHMAC(serve(t), []byte("another key"))
+	if _, err := client.Add(1, 2); err == nil {
+		t.Error("Add with the wrong key succeeded")
+	}
+	if got := send(t, serve(t), []byte("another key"), 1, time.Now(), keep); got != "rpc: invalid request signature" {
+		t.Errorf("request signed with the wrong key failed with %q", got)
+	}
+}
+
+func TestHMACReplayedNonce(t *testing.T) {
+	conn := &recorder{ReadWriteCloser: serve(t)}
+	if _, err := NewArithClientConnHMAC(conn, key).Add(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	replay := serve(t)
+	go replay.Write(conn.written.Bytes())
+	var response rpc.Response
+	if err := gob.NewDecoder(replay).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Error != "rpc: replayed request" {
+		t.Errorf("replayed request failed with %q", response.Error)
+	}
+}
+
+func TestHMACExpired(t *testing.T) {
+	if got := send(t, serve(t), key, 1, time.Now().Add(-2*ArithHMACWindow), keep); !strings.Contains(got, "away from the time of the service") {
+		t.Errorf("request signed too long ago failed with %q", got)
+	}
+}
+
+func TestHMACTamperedRequest(t *testing.T) {
+	tamper := func(b []byte) []byte {
+		b = append([]byte(nil), b...)
+		b[len(b)-1]++
+		return b
+	}
+	if got := send(t, serve(t), key, 1, time.Now(), tamper); got != "rpc: invalid request signature" {
+		t.Errorf("tampered request failed with %q", got)
+	}
+}
+
+func TestHMACTamperedResponse(t *testing.T) {
+	server, conn := net.Pipe()
+	defer server.Close()
+	client := NewArithClientConnHMAC(conn, key)
+	go func() {
+		dec, enc := gob.NewDecoder(server), gob.NewEncoder(server)
+		var request rpc.Request
+		var signed ArithSignedRequest
+		if dec.Decode(&request) != nil || dec.Decode(&signed) != nil {
+			return
+		}
+		var body, forged bytes.Buffer
+		gob.NewEncoder(&body).Encode(&ArithAddResponse{Sum: 3})
+		gob.NewEncoder(&forged).Encode(&ArithAddResponse{Sum: 42})
+		enc.Encode(&rpc.Response{ServiceMethod: request.ServiceMethod, Seq: request.Seq})
+		enc.Encode(&ArithSignedResponse{forged.Bytes(), ArithResponseMAC(key, request.ServiceMethod, request.Seq, "", body.Bytes(), signed.Nonce)})
+	}()
+	if sum, err := client.Add(1, 2); err == nil || !strings.Contains(err.Error(), "invalid response signature") {
+		t.Errorf("Add with a tampered response returned %d, %v, want an invalid response signature", sum, err)
+	}
+}
@@ -0,0 +1,67 @@
+package arith
+
+import (
+	"encoding/gob"
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+)
+
+func TestMemoryNonceStore(t *testing.T) {
+	store := NewArithMemoryNonceStore()
+	now := time.Now()
+	if !store.Add([]byte("a"), now.Add(time.Hour)) {
+		t.Error("new nonce rejected")
+	}
+	if store.Add([]byte("a"), now.Add(time.Hour)) {
+		t.Error("nonce added twice accepted")
+	}
+	if !store.Add([]byte("b"), now.Add(-time.Second)) {
+		t.Error("new nonce rejected")
+	}
+	if !store.Add([]byte("b"), now.Add(time.Hour)) {
+		t.Error("expired nonce rejected")
+	}
+}
+
+// countingStore is a shared nonce store counting the nonces it is given.
+type countingStore struct {
+	ArithNonceStore
+	added int
+}
+
+func (s *countingStore) Add(nonce []byte, expires time.Time) bool {
+	s.added++
+	return s.ArithNonceStore.Add(nonce, expires)
+}
+
+func TestSharedNonceStore(t *testing.T) {
+	store := &countingStore{ArithNonceStore: NewArithMemoryNonceStore()}
+	server := rpc.NewServer()
+	if err := RegisterArithService(server, arith{}); err != nil {
+		t.Fatal(err)
+	}
+	dial := func() net.Conn {
+		s, c := net.Pipe()
+		go server.ServeCodec(NewArithServerCodecHMAC(s, key, store))
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+	conn := &recorder{ReadWriteCloser: dial()}
+	if _, err := NewArithClientConnHMAC(conn, key).Add(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	replay := dial()
+	go replay.Write(conn.written.Bytes())
+	var response rpc.Response
+	if err := gob.NewDecoder(replay).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Error != "rpc: replayed request" {
+		t.Errorf("request replayed on another connection failed with %q", response.Error)
+	}
+	if store.added != 2 {
+		t.Errorf("the store was given %d nonces, want 2", store.added)
+	}
+}
@@ -0,0 +1,8 @@
+package build
+
+// Builder builds targets.
+type Builder interface {
+	// Build builds target and returns the name of its artifact.
+	//rpcgen:job
+	Build(target string) (artifact string, err error)
+}
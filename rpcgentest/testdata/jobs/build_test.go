@@ -0,0 +1,117 @@
+package build
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// builder builds targets once release is closed.
+type builder struct{ release chan struct{} }
+
+func (b builder) Build(target string) (string, error) {
+	<-b.release
+	if target == "" {
+		return "", errors.New("no target")
+	}
+	return target + ".bin", nil
+}
+
+func serve(t *testing.T) (*BuilderClient, chan struct{}) {
+	t.Helper()
+	release := make(chan struct{})
+	server, conn := net.Pipe()
+	go ServeBuilderConn(server, builder{release})
+	client := NewBuilderClientConn(conn)
+	t.Cleanup(func() { client.Close() })
+	return client, release
+}
+
+// wait polls job until it is done.
+func wait(t *testing.T, client *BuilderClient, job BuilderJob) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		status, err := client.BuildStatus(job)
+		if err != nil {
+			t.Fatalf("BuildStatus failed: %v", err)
+		}
+		if status.Done {
+			return
+		}
+	}
+	t.Fatal("the job never finished")
+}
+
+func TestJobs(t *testing.T) {
+	client, release := serve(t)
+	job, err := client.StartBuild("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing, err := client.StartBuild("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := client.BuildStatus(job); err != nil || status.Done {
+		t.Errorf("BuildStatus of a running job = %+v, %v, want not done", status, err)
+	}
+	if _, err := client.BuildResult(job); err == nil || !strings.Contains(err.Error(), "still running") {
+		t.Errorf("BuildResult of a running job returned %v, want an error", err)
+	}
+
+	close(release)
+	wait(t, client, job)
+	if artifact, err := client.BuildResult(job); err != nil || artifact != "app.bin" {
+		t.Errorf("BuildResult = %q, %v, want app.bin", artifact, err)
+	}
+	if _, err := client.BuildResult(job); err == nil || !strings.Contains(err.Error(), "no job") {
+		t.Errorf("BuildResult of a collected job returned %v, want an error", err)
+	}
+	wait(t, client, failing)
+	if _, err := client.BuildResult(failing); err == nil || !strings.Contains(err.Error(), "no target") {
+		t.Errorf("BuildResult of a failed job returned %v, want its error", err)
+	}
+}
+
+func TestJobsLimit(t *testing.T) {
+	client, release := serve(t)
+	defer close(release)
+	first, err := client.StartBuild("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.StartBuild("b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.StartBuild("c"); err == nil || !strings.Contains(err.Error(), "2 jobs") {
+		t.Errorf("StartBuild beyond the limit returned %v, want an error", err)
+	}
+	if _, err := client.CancelBuild(first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.StartBuild("c"); err != nil {
+		t.Errorf("StartBuild once a job was canceled failed: %v", err)
+	}
+}
+
+func TestJobsExpire(t *testing.T) {
+	client, release := serve(t)
+	close(release)
+	job, err := client.StartBuild("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, client, job)
+	time.Sleep(300 * time.Millisecond)
+	if _, err := client.BuildStatus(job); err == nil || !strings.Contains(err.Error(), "no job") {
+		t.Errorf("BuildStatus of an expired job returned %v, want an error", err)
+	}
+	// Expired jobs leave room for others.
+	for _, target := range []string{"a", "b"} {
+		if _, err := client.StartBuild(target); err != nil {
+			t.Errorf("StartBuild(%q) failed: %v", target, err)
+		}
+	}
+}
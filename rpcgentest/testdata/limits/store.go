@@ -0,0 +1,12 @@
+package store
+
+// Store stores documents.
+type Store interface {
+	// Upload stores data under name, and returns its size.
+	//rpcgen:maxlen tags 4
+	Upload(
+		name string, //rpcgen:maxlen=8
+		data []byte, //rpcgen:max=1KB
+		tags []string,
+	) (size int, err error)
+}
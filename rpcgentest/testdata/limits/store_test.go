@@ -0,0 +1,49 @@
+package store
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+type store struct{ calls int }
+
+func (s *store) Upload(name string, data []byte, tags []string) (int, error) {
+	s.calls++
+	return len(data), nil
+}
+
+func TestLimits(t *testing.T) {
+	impl := &store{}
+	server, conn := net.Pipe()
+	go ServeStoreConn(server, impl)
+	client := NewStoreClientConn(conn)
+	defer client.Close()
+
+	if size, err := client.Upload("doc", make([]byte, 1024), []string{"a", "b", "c", "d"}); err != nil || size != 1024 {
+		t.Errorf("Upload within the limits = %d, %v, want 1024", size, err)
+	}
+	tests := []struct {
+		name, param string
+		data        []byte
+		tags        []string
+	}{
+		{"ünïcödé", "", make([]byte, 1024), nil},
+		{"document", "", nil, nil},
+		{"doc", "data", make([]byte, 1025), nil},
+		{"documents", "name", nil, nil},
+		{"doc", "tags", nil, []string{"a", "b", "c", "d", "e"}},
+	}
+	for _, test := range tests {
+		_, err := client.Upload(test.name, test.data, test.tags)
+		switch {
+		case test.param == "" && err != nil:
+			t.Errorf("Upload(%q, %d bytes, %d tags) failed: %v", test.name, len(test.data), len(test.tags), err)
+		case test.param != "" && (err == nil || !strings.Contains(err.Error(), test.param)):
+			t.Errorf("Upload(%q, %d bytes, %d tags) returned %v, want an error about %s", test.name, len(test.data), len(test.tags), err, test.param)
+		}
+	}
+	if impl.calls != 3 {
+		t.Errorf("the implementation was called %d times, want 3", impl.calls)
+	}
+}
@@ -0,0 +1,119 @@
+package arith
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+var key = []byte("0123456789abcdef0123456789abcdef")
+
+type arith struct{}
+
+func (arith) Add(a, b int) (int, error) { return a + b, nil }
+
+func (arith) Div(a, b int) (int, int, error) { return a / b, a % b, nil }
+
+func TestNaClRoundTrip(t *testing.T) {
+	server, conn := net.Pipe()
+	go ServeArithConnNaCl(server, key, arith{})
+	client, err := NewArithClientConnNaCl(conn, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for i := 0; i < 3; i++ {
+		if sum, err := client.Add(i, 3); err != nil || sum != i+3 {
+			t.Errorf("Add(%d, 3) = %d, %v, want %d", i, sum, err, i+3)
+		}
+	}
+}
+
+func TestNaClBadKey(t *testing.T) {
+	server, conn := net.Pipe()
+	go ServeArithConnNaCl(server, key, arith{})
+	client, err := NewArithClientConnNaCl(conn, []byte("another key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Add(1, 2); err == nil {
+		t.Error("Add with another key succeeded")
+	}
+}
+
+// pair returns the two ends of an encrypted pipe, the service end of which
+// reads from raw, so that tests can write frames of their own on it.
+func pair(t *testing.T, clientKey []byte) (client *_ArithNaClConn, service *_ArithNaClConn, raw net.Conn) {
+	s, c := net.Pipe()
+	t.Cleanup(func() { s.Close(); c.Close() })
+	done := make(chan error)
+	go func() {
+		var err error
+		service, err = _newArithNaClConn(s, key, false)
+		done <- err
+	}()
+	client, err := _newArithNaClConn(c, clientKey, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	return client, service, c
+}
+
+func TestNaClLargeWrite(t *testing.T) {
+	client, service, _ := pair(t, key)
+	message := bytes.Repeat([]byte("0123456789"), 5000)
+	go client.Write(message)
+	got := make([]byte, len(message))
+	if _, err := io.ReadFull(service, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, message) {
+		t.Error("message split across frames arrived changed")
+	}
+}
+
+func TestNaClBadFrames(t *testing.T) {
+	frame := func(size uint32, body []byte) []byte {
+		b := make([]byte, 4, 4+len(body))
+		binary.BigEndian.PutUint32(b, size)
+		return append(b, body...)
+	}
+	tests := []struct {
+		name  string
+		frame []byte
+		err   string
+	}{
+		{"truncated", frame(100, make([]byte, 10)), "unexpected EOF"},
+		{"oversized", frame(_ArithMaxNaClFrame+secretbox.Overhead+1, nil), "too large"},
+		{"forged", frame(40, make([]byte, 40)), "failed to open"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, service, raw := pair(t, key)
+			go func() {
+				raw.Write(test.frame)
+				raw.Close()
+			}()
+			if _, err := service.Read(make([]byte, 10)); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("reading the frame failed with %v, want %s", err, test.err)
+			}
+		})
+	}
+}
+
+func TestNaClFrameOfAnotherKey(t *testing.T) {
+	client, service, _ := pair(t, []byte("another key"))
+	go client.Write([]byte("hello"))
+	if _, err := service.Read(make([]byte, 10)); err == nil || !strings.Contains(err.Error(), "failed to open") {
+		t.Errorf("reading a frame sealed with another key failed with %v", err)
+	}
+}
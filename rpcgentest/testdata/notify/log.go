@@ -0,0 +1,10 @@
+package log
+
+// Log keeps lines.
+type Log interface {
+	// Write logs line.
+	//rpcgen:notify
+	Write(line string) (err error)
+	// Lines returns the number of lines logged.
+	Lines() (n int, err error)
+}
@@ -0,0 +1,82 @@
+package log
+
+import (
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lines is a Log whose writes wait for release to be closed.
+type lines struct {
+	release chan struct{}
+	mu      sync.Mutex
+	n       int
+}
+
+func (l *lines) Write(line string) error {
+	<-l.release
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.n++
+	return nil
+}
+
+func (l *lines) Lines() (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.n, nil
+}
+
+// replies is a server codec recording the methods it replies to.
+type replies struct {
+	rpc.ServerCodec
+	methods chan string
+}
+
+func (c *replies) WriteResponse(response *rpc.Response, body interface{}) error {
+	c.methods <- response.ServiceMethod
+	return c.ServerCodec.WriteResponse(response, body)
+}
+
+func TestNotify(t *testing.T) {
+	impl := &lines{release: make(chan struct{})}
+	server := rpc.NewServer()
+	if err := RegisterLogService(server, impl); err != nil {
+		t.Fatal(err)
+	}
+	serverConn, conn := net.Pipe()
+	codec := &replies{jsonrpc.NewServerCodec(serverConn), make(chan string, 4)}
+	go server.ServeCodec(codec)
+	client := NewLogClient(jsonrpc.NewClient(conn))
+	defer client.Close()
+
+	// The notification returns while the implementation still waits.
+	done := make(chan error, 1)
+	go func() { done <- client.Write("hello") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write waited for the implementation")
+	}
+
+	// The server still replies once the implementation returns, and the
+	// client drops the reply rather than mistake it for another.
+	close(impl.release)
+	select {
+	case method := <-codec.methods:
+		if method != "Log.Write" {
+			t.Errorf("the server replied to %s, want Log.Write", method)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server never replied to the notification")
+	}
+	if n, err := client.Lines(); err != nil || n != 1 {
+		t.Errorf("Lines() = %d, %v, want 1", n, err)
+	}
+}
@@ -0,0 +1,14 @@
+package jobs
+
+// Jobs runs jobs.
+type Jobs interface {
+	// Run runs the job called name.
+	Run(name string) (err error)
+	// Health reports whether the service is up.
+	//rpcgen:priority=high
+	//rpcgen:timeout=50ms
+	Health() (ok bool, err error)
+	// Batch runs the batch job called name.
+	//rpcgen:priority=low
+	Batch(name string) (err error)
+}
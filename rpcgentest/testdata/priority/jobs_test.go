@@ -0,0 +1,98 @@
+package jobs
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blocking is an implementation whose calls other than Health block until
+// release is closed, after signalling started.
+type blocking struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlocking() *blocking {
+	return &blocking{started: make(chan struct{}, 8), release: make(chan struct{})}
+}
+
+func (b *blocking) block() error {
+	b.started <- struct{}{}
+	<-b.release
+	return nil
+}
+
+func (b *blocking) Run(name string) error { return b.block() }
+
+func (b *blocking) Health() (bool, error) { return true, nil }
+
+func (b *blocking) Batch(name string) error { return b.block() }
+
+func (b *blocking) Push(item string) error { return b.block() }
+
+func TestPriorityWaitTimesOut(t *testing.T) {
+	impl := newBlocking()
+	server, conn := net.Pipe()
+	go ServeJobsConn(server, impl, WithJobsMaxConcurrency(1))
+	client := NewJobsClientConn(conn)
+	defer client.Close()
+
+	running := make(chan error, 1)
+	go func() { running <- client.Run("long") }()
+	<-impl.started
+
+	start := time.Now()
+	if _, err := client.Health(); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Health waiting for a slot returned %v, want a timeout", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Health waited %s for a slot, want its 50ms deadline", d)
+	}
+
+	// The call that timed out left the queue, so a low-priority call waits
+	// rather than being shed.
+	batch := make(chan error, 1)
+	go func() { batch <- client.Batch("nightly") }()
+	time.Sleep(20 * time.Millisecond)
+	close(impl.release)
+	if err := <-running; err != nil {
+		t.Errorf("Run failed: %v", err)
+	}
+	if err := <-batch; err != nil {
+		t.Errorf("Batch failed: %v", err)
+	}
+	if ok, err := client.Health(); err != nil || !ok {
+		t.Errorf("Health = %v, %v, want true", ok, err)
+	}
+}
+
+func TestWaitTimesOut(t *testing.T) {
+	impl := newBlocking()
+	defer close(impl.release)
+	server, conn := net.Pipe()
+	go ServeQueueConn(server, impl, WithQueueMaxConcurrency(1), WithQueueTimeout(50*time.Millisecond))
+	client := NewQueueClientConn(conn)
+	defer client.Close()
+
+	running := make(chan error, 1)
+	go func() { running <- client.Push("first") }()
+	<-impl.started
+
+	start := time.Now()
+	if err := client.Push("second"); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Push waiting for a slot returned %v, want a timeout", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Push waited %s for a slot, want the 50ms timeout", d)
+	}
+	select {
+	case <-impl.started:
+		t.Error("the call that timed out waiting for a slot ran")
+	default:
+	}
+	if err := <-running; err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("the running Push returned %v, want a timeout", err)
+	}
+}
@@ -0,0 +1,7 @@
+package jobs
+
+// Queue queues items.
+type Queue interface {
+	// Push queues item.
+	Push(item string) (err error)
+}
@@ -0,0 +1,34 @@
+package arith
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+type arith struct{}
+
+func (arith) Add(a, b int) (int, error) { return a + b, nil }
+
+func (arith) Div(a, b int) (int, int, error) {
+	if b == 0 {
+		return 0, 0, errors.New("division by zero")
+	}
+	return a / b, a % b, nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	server, conn := net.Pipe()
+	go ServeArithConn(server, arith{})
+	client := NewArithClientConn(conn)
+	defer client.Close()
+	if sum, err := client.Add(2, 3); err != nil || sum != 5 {
+		t.Errorf("Add(2, 3) = %d, %v, want 5", sum, err)
+	}
+	if q, r, err := client.Div(7, 2); err != nil || q != 3 || r != 1 {
+		t.Errorf("Div(7, 2) = %d, %d, %v, want 3, 1", q, r, err)
+	}
+	if _, _, err := client.Div(1, 0); err == nil || err.Error() != "division by zero" {
+		t.Errorf("Div(1, 0) returned %v, want division by zero", err)
+	}
+}
@@ -0,0 +1,90 @@
+package arith
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type arith struct{}
+
+func (arith) Add(a, b int) (int, error) { return a + b, nil }
+
+func (arith) Div(a, b int) (int, int, error) { return a / b, a % b, nil }
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listener
+}
+
+// run serves arith on listener with opts until the test ends, and returns a
+// channel closed once RunArithServer returns, and its error.
+func run(t *testing.T, listener net.Listener, opts ...ArithServiceOption) (<-chan struct{}, *error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	var err error
+	go func() {
+		err = RunArithServer(ctx, listener, arith{}, opts...)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return stopped, &err
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "too many open files" }
+func (temporaryError) Temporary() bool { return true }
+func (temporaryError) Timeout() bool   { return false }
+
+// failingListener fails Accept with err the first failures times.
+type failingListener struct {
+	net.Listener
+	err      error
+	failures int32
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	if atomic.AddInt32(&l.failures, -1) >= 0 {
+		return nil, l.err
+	}
+	return l.Listener.Accept()
+}
+
+func TestRunnerRetriesTemporaryErrors(t *testing.T) {
+	listener := &failingListener{Listener: listen(t), err: temporaryError{}, failures: 3}
+	run(t, listener)
+	client, err := DialArithClient(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if sum, err := client.Add(2, 3); err != nil || sum != 5 {
+		t.Errorf("Add(2, 3) = %d, %v, want 5", sum, err)
+	}
+}
+
+func TestRunnerFailsOnOtherErrors(t *testing.T) {
+	broken := errors.New("listener broken")
+	listener := &failingListener{Listener: listen(t), err: broken, failures: 1}
+	defer listener.Close()
+	stopped, err := run(t, listener)
+	select {
+	case <-stopped:
+		if *err != broken {
+			t.Errorf("RunArithServer returned %v, want %v", *err, broken)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunArithServer kept running after Accept failed")
+	}
+}
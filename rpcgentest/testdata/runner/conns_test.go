@@ -0,0 +1,120 @@
+package arith
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hooks records the connections the runner reports.
+type hooks struct {
+	mu           sync.Mutex
+	connected    []ArithConnInfo
+	disconnected chan ArithConnInfo
+}
+
+func newHooks() *hooks {
+	return &hooks{disconnected: make(chan ArithConnInfo, 8)}
+}
+
+func (h *hooks) options() []ArithServiceOption {
+	return []ArithServiceOption{
+		WithArithOnConnect(func(info ArithConnInfo) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			h.connected = append(h.connected, info)
+		}),
+		WithArithOnDisconnect(func(info ArithConnInfo) { h.disconnected <- info }),
+	}
+}
+
+func TestMaxConnections(t *testing.T) {
+	h := newHooks()
+	listener := listen(t)
+	run(t, listener, append(h.options(), WithArithMaxConnections(1))...)
+	addr := listener.Addr().String()
+
+	first, err := DialArithClient(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum, err := first.Add(2, 3); err != nil || sum != 5 {
+		t.Fatalf("Add(2, 3) = %d, %v, want 5", sum, err)
+	}
+
+	// The runner accepts the connection beyond the limit, then closes it.
+	second, err := DialArithClient(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Add(2, 3); !errors.Is(err, ErrArithConnectionLost) {
+		t.Errorf("Add(2, 3) beyond the limit returned %v, want %v", err, ErrArithConnectionLost)
+	}
+	second.Close()
+
+	first.Close()
+	select {
+	case info := <-h.disconnected:
+		if info.ID != 1 {
+			t.Errorf("connection %d disconnected, want 1", info.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first connection never disconnected")
+	}
+	third, err := DialArithClient(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	if sum, err := third.Add(2, 3); err != nil || sum != 5 {
+		t.Errorf("Add(2, 3) once below the limit = %d, %v, want 5", sum, err)
+	}
+
+	// Rejected connections are neither counted nor reported.
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.connected) != 2 || h.connected[0].ID != 1 || h.connected[1].ID != 2 {
+		t.Errorf("the runner reported connections %+v, want 1 and 2", h.connected)
+	}
+	for _, info := range h.connected {
+		if info.LocalAddr.String() != addr || info.RemoteAddr == nil {
+			t.Errorf("connection %d has addresses %v and %v, want the local one to be %s", info.ID, info.RemoteAddr, info.LocalAddr, addr)
+		}
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	h := newHooks()
+	listener := listen(t)
+	run(t, listener, append(h.options(), WithArithIdleTimeout(100*time.Millisecond))...)
+
+	busy, err := DialArithClient(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	idle, err := DialArithClient(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	if _, err := idle.Add(1, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Calls keep a connection from being idle.
+	for deadline := time.Now().Add(300 * time.Millisecond); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if sum, err := busy.Add(2, 3); err != nil || sum != 5 {
+			t.Fatalf("Add(2, 3) on a busy connection = %d, %v, want 5", sum, err)
+		}
+	}
+	select {
+	case <-h.disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the idle connection was never closed")
+	}
+	if _, err := idle.Add(2, 3); !errors.Is(err, ErrArithConnectionLost) {
+		t.Errorf("Add(2, 3) on an idle connection returned %v, want %v", err, ErrArithConnectionLost)
+	}
+}
@@ -0,0 +1,99 @@
+package arith
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use, for loggers.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestKeepaliveKeepsIdleConnections(t *testing.T) {
+	var logged syncBuffer
+	listener := listen(t)
+	run(t, listener, WithArithIdleTimeout(50*time.Millisecond), WithArithLogger(log.New(&logged, "", 0)))
+
+	pinging, err := DialArithClient(listener.Addr().String(), WithArithKeepalive(10*time.Millisecond, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pinging.Close()
+	idle, err := DialArithClient(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+
+	time.Sleep(200 * time.Millisecond)
+	if sum, err := pinging.Add(2, 3); err != nil || sum != 5 {
+		t.Errorf("Add(2, 3) on a connection kept alive = %d, %v, want 5", sum, err)
+	}
+	if _, err := idle.Add(2, 3); !errors.Is(err, ErrArithConnectionLost) {
+		t.Errorf("Add(2, 3) on an idle connection returned %v, want %v", err, ErrArithConnectionLost)
+	}
+	if !strings.Contains(logged.String(), "connection lost") {
+		t.Errorf("the server logged %q, want the idle connection lost", logged.String())
+	}
+}
+
+func TestKeepaliveDetectsDroppedConnections(t *testing.T) {
+	// The server reads the requests but never responds, as if the
+	// responses were dropped on the way.
+	server, conn := net.Pipe()
+	go io.Copy(io.Discard, server)
+	defer server.Close()
+	client := NewArithClientConn(conn, WithArithKeepalive(10*time.Millisecond, 20*time.Millisecond))
+	defer client.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Add(2, 3)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrArithConnectionLost) {
+			t.Errorf("Add(2, 3) returned %v, want %v", err, ErrArithConnectionLost)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Add(2, 3) hung on a dropped connection")
+	}
+	if _, err := client.Add(2, 3); !errors.Is(err, ErrArithConnectionLost) {
+		t.Errorf("Add(2, 3) once the connection was lost returned %v, want %v", err, ErrArithConnectionLost)
+	}
+}
+
+func TestConnectionClosedIsNotLost(t *testing.T) {
+	server, conn := net.Pipe()
+	go ServeArithConn(server, arith{})
+	client := NewArithClientConn(conn, WithArithKeepalive(10*time.Millisecond, 0))
+	if sum, err := client.Add(2, 3); err != nil || sum != 5 {
+		t.Errorf("Add(2, 3) = %d, %v, want 5", sum, err)
+	}
+	client.Close()
+	if _, err := client.Add(2, 3); err == nil || errors.Is(err, ErrArithConnectionLost) {
+		t.Errorf("Add(2, 3) once closed returned %v, want an error other than %v", err, ErrArithConnectionLost)
+	}
+}
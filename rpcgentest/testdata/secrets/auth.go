@@ -0,0 +1,8 @@
+package auth
+
+// Auth logs users in.
+type Auth interface {
+	//rpcgen:secret password, token
+	Login(user, password string) (token string, err error)
+	Echo(message string) (reply string, err error)
+}
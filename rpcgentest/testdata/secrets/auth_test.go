@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	password = "hunter2"
+	token    = "tok-s3cret"
+)
+
+type auth struct{}
+
+func (auth) Login(user, password string) (string, error) { return token, nil }
+
+func (auth) Echo(message string) (string, error) { return message, nil }
+
+func TestSecretString(t *testing.T) {
+	request := AuthLoginRequest{User: "alice", Password: password}.String()
+	if strings.Contains(request, password) || !strings.Contains(request, "[REDACTED]") || !strings.Contains(request, "alice") {
+		t.Errorf("request prints as %s, want the password redacted", request)
+	}
+	response := AuthLoginResponse{Token: token}.String()
+	if strings.Contains(response, token) || !strings.Contains(response, "[REDACTED]") {
+		t.Errorf("response prints as %s, want the token redacted", response)
+	}
+}
+
+func TestSecretInterceptor(t *testing.T) {
+	var mu sync.Mutex
+	var logged bytes.Buffer
+	logger := func(method string, request, response interface{}, handler func() error) error {
+		err := handler()
+		mu.Lock()
+		fmt.Fprintf(&logged, "%s %v %v\n", method, request, response)
+		mu.Unlock()
+		return err
+	}
+	server, conn := net.Pipe()
+	go ServeAuthConn(server, auth{}, WithAuthInterceptor(logger))
+	client := NewAuthClientConn(conn)
+	defer client.Close()
+	if got, err := client.Login("alice", password); err != nil || got != token {
+		t.Fatalf("Login() = %q, %v, want %q", got, err, token)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if s := logged.String(); strings.Contains(s, password) || strings.Contains(s, token) || !strings.Contains(s, "alice") {
+		t.Errorf("the interceptor logged %q, want the password and token redacted", s)
+	}
+}
+
+func TestSecretWireDump(t *testing.T) {
+	server, conn := net.Pipe()
+	go ServeAuthConn(server, auth{})
+	client := NewAuthClientConn(conn)
+	defer client.Close()
+	var dump bytes.Buffer
+	client.SetWireDump(&dump)
+
+	if _, err := client.Echo("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if s := dump.String(); !strings.Contains(s, "00000000  ") {
+		t.Errorf("Echo dumped %q, want a hex dump of its bytes", s)
+	}
+
+	dump.Reset()
+	if _, err := client.Login("alice", password); err != nil {
+		t.Fatal(err)
+	}
+	s := dump.String()
+	if strings.Contains(s, "00000000  ") || !strings.Contains(s, "hidden") {
+		t.Errorf("Login dumped %q, want its bytes hidden", s)
+	}
+	if !strings.Contains(s, "Auth.Login took") {
+		t.Errorf("Login dumped %q, want the call dumped", s)
+	}
+}
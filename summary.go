@@ -0,0 +1,162 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// summary is the outcome of a generate run, printed by --summary for build
+// pipelines to check that every expected service was generated.
+type summary struct {
+	Interfaces []*interfaceSummary `json:"interfaces"`
+	// Combined are the combined clients written.
+	Combined []*combinedSummary `json:"combined,omitempty"`
+	// Methods, Files and Failed total the methods of the interfaces
+	// generated, the files written, and the interfaces and combined clients
+	// that failed.
+	Methods int `json:"methods"`
+	Files   int `json:"files"`
+	Failed  int `json:"failed"`
+}
+
+// interfaceSummary is the outcome of generating the stubs of an interface.
+type interfaceSummary struct {
+	Source    string `json:"source"`
+	Interface string `json:"interface"`
+	// Service and Methods are those of the stubs generated, if they were.
+	Service string   `json:"service,omitempty"`
+	Methods []string `json:"methods"`
+	Files   []string `json:"files"`
+	// Errors are the problems that prevented generating or writing the
+	// stubs, if any.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// combinedSummary is the outcome of generating a combined client.
+type combinedSummary struct {
+	Name    string   `json:"name"`
+	Clients []string `json:"clients"`
+	File    string   `json:"file,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// add records the outcome of the target opts, which generated the model gen
+// and wrote files unless err is set.
+func (s *summary) add(opts *Options, gen *RPCGen, files []*File, err error) {
+	i := &interfaceSummary{Source: opts.Source, Interface: opts.Type, Methods: []string{}, Files: []string{}}
+	if gen != nil {
+		i.Service = gen.Service
+		for _, m := range gen.Methods {
+			i.Methods = append(i.Methods, m.Name)
+		}
+	}
+	if err != nil {
+		i.Errors = errorMessages(err)
+		s.Failed++
+	} else {
+		i.Files = writtenPaths(files)
+		s.Methods += len(i.Methods)
+		s.Files += len(i.Files)
+	}
+	s.Interfaces = append(s.Interfaces, i)
+}
+
+// addCombined records the outcome of the combined client c, written unless
+// err is set.
+func (s *summary) addCombined(c *combined, err error) {
+	cs := &combinedSummary{Name: c.Name, Clients: []string{}}
+	for _, client := range c.Clients {
+		cs.Clients = append(cs.Clients, client.Type)
+	}
+	if err != nil {
+		cs.Errors = errorMessages(err)
+		s.Failed++
+	} else if paths := writtenPaths([]*File{c.file}); len(paths) > 0 {
+		cs.File = paths[0]
+		s.Files++
+	}
+	s.Combined = append(s.Combined, cs)
+}
+
+// writtenPaths returns the paths files are written to, leaving out stdout.
+func writtenPaths(files []*File) []string {
+	paths := []string{}
+	for _, file := range files {
+		if file.Path != stdio {
+			paths = append(paths, file.Path)
+		}
+	}
+	return paths
+}
+
+// errorMessages returns the message of err, or of each of its diagnostics
+// if it has several.
+func errorMessages(err error) []string {
+	list, ok := err.(Diagnostics)
+	if !ok {
+		return []string{err.Error()}
+	}
+	var msgs []string
+	for _, err := range list {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+// print writes the summary to w, as JSON if asJSON is set and otherwise as a
+// line per interface and combined client followed by the totals, leaving the
+// messages of the problems, which are reported apart, to the JSON.
+func (s *summary) print(w io.Writer, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+	for _, i := range s.Interfaces {
+		if len(i.Errors) > 0 {
+			fmt.Fprintf(w, "%s: %s: failed with %s\n", i.Source, i.Interface, plural(len(i.Errors), "problem"))
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s: service %s, %s, wrote %s\n", i.Source, i.Interface, i.Service, plural(len(i.Methods), "method"), listOrNone(i.Files))
+	}
+	for _, c := range s.Combined {
+		if len(c.Errors) > 0 {
+			fmt.Fprintf(w, "combined client %s: failed with %s\n", c.Name, plural(len(c.Errors), "problem"))
+			continue
+		}
+		fmt.Fprintf(w, "combined client %s of %s: wrote %s\n", c.Name, strings.Join(c.Clients, ", "), listOrNone([]string{c.File}))
+	}
+	_, err := fmt.Fprintf(w, "%s, %s, %s written, %d failed\n", plural(len(s.Interfaces), "interface"), plural(s.Methods, "method"), plural(s.Files, "file"), s.Failed)
+	return err
+}
+
+// listOrNone returns items separated by commas, or "nothing" if there are
+// none.
+func listOrNone(items []string) string {
+	var out []string
+	for _, item := range items {
+		if item != "" {
+			out = append(out, item)
+		}
+	}
+	if len(out) == 0 {
+		return "nothing"
+	}
+	return strings.Join(out, ", ")
+}
@@ -0,0 +1,3019 @@
+// Copyright 2012 Alec Thomas
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/alecthomas/template"
+)
+
+// rpcTemplate is the built-in template. The top-level "rpc" template only
+// assembles the named sections below, each of which can be overridden on its
+// own with a file in the template directory.
+var rpcTemplate = `{{template "header" .}}
+{{if .Types}}{{template "types" .}}{{template "names" .}}{{if .Enums}}{{template "enums" .}}{{end}}{{if .Handshake}}{{template "fingerprint" .}}{{end}}{{if .HasJobs}}{{template "job-types" .}}{{end}}{{if .BinaryCodec}}{{template "codec" .}}{{end}}{{if .Msgp}}{{template "msgp" .}}{{end}}{{if .Easyjson}}{{template "easyjson" .}}{{end}}{{if or .Stringer .HasSecrets}}{{template "stringers" .}}{{end}}{{if .HMAC}}{{template "hmac" .}}{{end}}{{if .NaCl}}{{template "nacl" .}}{{end}}{{if .Transport}}{{template "transport" .}}{{end}}{{end}}
+{{if .Server}}{{template "service" .}}{{template "service-constructors" .}}{{if .ServerOptions}}{{template "service-options" .}}{{end}}{{if .HMAC}}{{template "service-hmac" .}}{{end}}{{if .NaCl}}{{template "service-nacl" .}}{{end}}{{if .Transport}}{{template "service-transport" .}}{{end}}{{if .Runner}}{{template "service-runner" .}}{{end}}{{if .Expvar}}{{template "service-stats" .}}{{end}}{{template "service-methods" .}}{{if .Handle}}{{template "service-handles" .}}{{end}}{{if .Handshake}}{{template "service-handshake" .}}{{end}}{{if .HasJobs}}{{template "service-jobs" .}}{{end}}{{if .Dispatch}}{{template "service-dispatch" .}}{{end}}{{if .Health}}{{template "service-health" .}}{{end}}{{if .Faults}}{{template "service-faults" .}}{{end}}{{end}}
+{{if .Client}}{{template "client" .}}{{template "client-constructors" .}}{{if .ClientOptions}}{{template "client-options" .}}{{end}}{{if .SSH}}{{template "client-ssh" .}}{{end}}{{if .HMAC}}{{template "client-hmac" .}}{{end}}{{if .NaCl}}{{template "client-nacl" .}}{{end}}{{if .Transport}}{{template "client-transport" .}}{{end}}{{if .WireDump}}{{template "client-wire-dump" .}}{{end}}{{template "client-methods" .}}{{if .Handle}}{{template "client-handles" .}}{{end}}{{if .Handshake}}{{template "client-handshake" .}}{{end}}{{if .HasJobs}}{{template "client-jobs" .}}{{end}}{{end}}
+{{if .Benchmarks}}{{template "benchmarks" .}}{{end}}
+
+{{define "header"}}{{if .Header}}{{.Header}}
+
+{{end}}{{if .BuildTags}}//go:build {{.BuildTags}}
+
+{{end}}// Code generated by go-rpcgen. DO NOT EDIT.
+// Version: {{.Version}}
+// Source hash: {{.SourceHash}}{{if .SideFiles}}
+// Side files:{{range .SideFiles}} {{.}}{{end}}{{end}}
+
+package {{.Package}}
+{{if .Imports}}
+import (
+{{range $key, $value := .Imports}}  {{$value}} "{{$key}}"
+{{end}})
+{{end}}{{end}}
+
+{{define "types"}}{{$type := .Type}}{{range .Methods}}
+// {{$type}}{{.Name}}Request is a helper structure for {{.Name}} method.{{if $.Easyjson}}
+//easyjson:json{{end}}
+type {{$type}}{{.Name}}Request struct {
+	{{structfields $.JSONNaming .Validations .OmitEmpty .Parameters}}{{if $.Handle}}
+	Handle uint64{{if ne $.JSONNaming "asis"}} {{"\x60"}}json:"handle"{{"\x60"}}{{end}}{{end}}{{if .Dedup}}
+	IdempotencyKey string{{if ne $.JSONNaming "asis"}} {{"\x60"}}json:"{{if eq $.JSONNaming "snake"}}idempotency_key{{else}}idempotencyKey{{end}}"{{"\x60"}}{{end}}{{end}}
+}
+
+// {{$type}}{{.Name}}Response is a helper structure for {{.Name}} method.{{if $.Easyjson}}
+//easyjson:json{{end}}
+type {{$type}}{{.Name}}Response struct {
+	{{structfields $.JSONNaming nil .OmitEmpty .Results}}
+}
+{{if or $.Handle .HasHandles}}
+// setConn records conn as the connection the request came on.
+func (r *{{$type}}{{.Name}}Request) setConn(conn interface{}) { _{{$type}}SetConn(r, conn) }
+{{end}}{{end}}{{if .Handle}}
+// {{$type}}ReleaseHandleRequest is a helper structure for releasing the
+// object of a handle.
+type {{$type}}ReleaseHandleRequest struct {
+	Handle uint64{{if ne $.JSONNaming "asis"}} {{"\x60"}}json:"handle"{{"\x60"}}{{end}}
+}
+
+// setConn records conn as the connection the request came on.
+func (r *{{$type}}ReleaseHandleRequest) setConn(conn interface{}) { _{{$type}}SetConn(r, conn) }
+{{end}}{{if or .Handle .HandleTypes}}
+// _{{$type}}RequestConns are the connections the requests using or returning
+// handles came on, by request, from when the handle codec of the connection
+// reads them until it writes their response.
+var _{{$type}}RequestConns sync.Map
+
+// _{{$type}}SetConn records conn as the connection request came on, or
+// forgets it if conn is nil.
+func _{{$type}}SetConn(request, conn interface{}) {
+	if conn == nil {
+		_{{$type}}RequestConns.Delete(request)
+	} else {
+		_{{$type}}RequestConns.Store(request, conn)
+	}
+}
+
+// _{{$type}}Conn returns the connection request came on, or nil if no handle
+// codec read it.
+func _{{$type}}Conn(request interface{}) interface{} {
+	conn, _ := _{{$type}}RequestConns.Load(request)
+	return conn
+}
+{{end}}{{end}}
+
+{{define "enums"}}{{$type := .Type}}{{range .Enums}}
+// {{$type}}{{.Name}}Values are the values of {{.Name}} the {{$type}} service
+// accepts.
+var {{$type}}{{.Name}}Values = []{{.Type}}{{"{"}}{{range $i, $c := .Constants}}{{if $i}}, {{end}}{{$c.Name}}{{end}}}
+
+// _{{$type}}Valid{{.Name}} reports whether v is one of {{$type}}{{.Name}}Values{{if not .NonZero}},
+// or the zero value{{end}}.
+func _{{$type}}Valid{{.Name}}(v {{.Type}}) bool {
+{{if not .NonZero}}	var zero {{.Type}}
+	if v == zero {
+		return true
+	}
+{{end}}	for _, value := range {{$type}}{{.Name}}Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+{{end}}{{end}}
+
+{{define "names"}}{{$type := .Type}}
+const (
+	// {{.Type}}ServiceName is the name the {{.Type}} service is registered under.
+	{{.Type}}ServiceName = "{{.Service}}"{{if .Handle}}
+	// {{.Type}}HandleServiceName is the name the service calling {{.Type}}
+	// objects through their handles is registered under.
+	{{.Type}}HandleServiceName = "{{.Service}}Handle"{{end}}{{range .Methods}}
+	// {{$type}}{{.Name}}Method is the name clients call {{.Name}} with.
+	{{$type}}{{.Name}}Method = "{{$.Service}}.{{.Name}}"{{end}}
+)
+
+// {{.Type}}MethodNames are the names clients call the methods of the {{.Type}}
+// service with, in the order of the interface.
+var {{.Type}}MethodNames = []string{{"{"}}{{range $i, $m := .Methods}}{{if $i}}, {{end}}{{$type}}{{$m.Name}}Method{{end}}{{"}"}}
+{{if .HasScopes}}
+// {{.Type}}MethodScopes are the scopes callers need for the methods of the
+// {{.Type}} service that require any, by method name without the service name.
+var {{.Type}}MethodScopes = map[string][]string{{"{"}}{{range .Methods}}{{if .Scopes}}
+	"{{.Name}}": {{"{"}}{{range $i, $s := .Scopes}}{{if $i}}, {{end}}{{printf "%q" $s}}{{end}}{{"}"}},{{end}}{{end}}
+}
+{{end}}{{if .HasTimeouts}}
+// {{.Type}}MethodTimeouts are the default deadlines of the calls of the
+// methods of the {{.Type}} service that have any, by method name without the
+// service name.
+var {{.Type}}MethodTimeouts = map[string]time.Duration{{"{"}}{{range .Methods}}{{if .Timeout}}
+	"{{.Name}}": {{.Timeout | goduration}},{{end}}{{end}}
+}
+{{end}}{{if .HasPriorities}}
+// {{.Type}}MethodPriorities are the priorities of the methods of the
+// {{.Type}} service that have any, "high" or "low", by method name without
+// the service name.
+var {{.Type}}MethodPriorities = map[string]string{{"{"}}{{range .Methods}}{{if .Priority}}
+	"{{.Name}}": {{printf "%q" .Priority}},{{end}}{{end}}
+}
+{{end}}{{end}}
+
+{{define "job-types"}}
+// {{.Type}}Job identifies a job run by {{.Type}}Service.
+type {{.Type}}Job struct {
+	ID uint64
+}
+
+// {{.Type}}JobStatus is the state of a job.
+type {{.Type}}JobStatus struct {
+	Done bool
+}
+{{end}}
+
+{{define "fingerprint"}}
+// {{.Type}}Fingerprint identifies the interface the stubs were generated
+// from. The client and the service compare theirs in Handshake.
+const {{.Type}}Fingerprint = "{{.SourceHash}}"
+{{end}}
+
+{{define "codec"}}{{$type := .Type}}{{range .Methods}}{{if binarycodec .Parameters}}
+// MarshalBinary encodes the request without reflection, for encoding/gob.
+func (r *{{$type}}{{.Name}}Request) MarshalBinary() ([]byte, error) {
+	var b []byte
+	{{marshalbinary "r." .Parameters}}{{if $.Handle}}
+	b = binary.AppendUvarint(b, r.Handle){{end}}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a request encoded by MarshalBinary.
+func (r *{{$type}}{{.Name}}Request) UnmarshalBinary(data []byte) error {
+	{{unmarshalbinary "r." .Parameters}}{{if $.Handle}}
+	if x, n := binary.Uvarint(data); n > 0 {
+		r.Handle = x
+	} else {
+		return io.ErrUnexpectedEOF
+	}{{end}}
+	return nil
+}
+{{end}}{{if binarycodec .Results}}
+// MarshalBinary encodes the response without reflection, for encoding/gob.
+func (r *{{$type}}{{.Name}}Response) MarshalBinary() ([]byte, error) {
+	var b []byte
+	{{marshalbinary "r." .Results}}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a response encoded by MarshalBinary.
+func (r *{{$type}}{{.Name}}Response) UnmarshalBinary(data []byte) error {
+	{{unmarshalbinary "r." .Results}}
+	return nil
+}
+{{end}}{{end}}{{end}}
+
+{{define "stringers"}}{{$type := .Type}}{{range .Methods}}{{if or $.Stringer .Secret}}
+// String prints the fields of the request, for debugging.{{if .Redacted}} The
+// values of redacted fields are hidden.{{end}}
+func (r {{$type}}{{.Name}}Request) String() string {
+	{{stringer (print $type .Name "Request") . .Parameters}}
+}
+
+// String prints the fields of the response, for debugging.{{if .Redacted}} The
+// values of redacted fields are hidden.{{end}}
+func (r {{$type}}{{.Name}}Response) String() string {
+	{{stringer (print $type .Name "Response") . .Results}}
+}
+{{end}}{{end}}{{end}}
+
+{{define "hmac"}}
+// {{.Type}}SignedRequest is what clients from Dial{{.Type}}ClientHMAC and
+// New{{.Type}}ClientConnHMAC send instead of a request: the request encoded
+// with gob, the time it was signed at, a random nonce telling it apart from
+// any other request, and the HMAC-SHA256 of these and of the method.
+type {{.Type}}SignedRequest struct {
+	Body  []byte
+	Time  int64 // Unix time in nanoseconds
+	Nonce []byte
+	MAC   []byte
+}
+
+// {{.Type}}RequestMAC returns the HMAC-SHA256 with key of a request for
+// method, encoded as body and signed at t with nonce.
+func {{.Type}}RequestMAC(key []byte, method string, body []byte, t int64, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%d\n%x\n", method, t, nonce)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// {{.Type}}SignedResponse is what Serve{{.Type}}ConnHMAC sends instead of a
+// response: the response encoded with gob, and the HMAC-SHA256 of it, of the
+// header sent before it and of the nonce of the request it answers.
+type {{.Type}}SignedResponse struct {
+	Body []byte
+	MAC  []byte
+}
+
+// {{.Type}}ResponseMAC returns the HMAC-SHA256 with key of a response for
+// method, whose header has seq and errMsg, encoded as body and answering the
+// request with nonce.
+func {{.Type}}ResponseMAC(key []byte, method string, seq uint64, errMsg string, body, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "response\n%s\n%d\n%q\n%x\n", method, seq, errMsg, nonce)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+{{end}}
+
+{{define "nacl"}}
+// _{{.Type}}NaClConn encrypts and authenticates the traffic on a connection
+// with secretbox, under keys agreed on by an ephemeral Curve25519 exchange
+// and bound to a pre-shared key. Each frame is the length of a sealed
+// message, as a 32-bit big endian integer, followed by the message.
+type _{{.Type}}NaClConn struct {
+	conn                  io.ReadWriteCloser
+	readKey, writeKey     [32]byte
+	readNonce, writeNonce uint64
+	pending               []byte
+}
+
+// _{{.Type}}MaxNaClFrame is the largest message of a frame.
+const _{{.Type}}MaxNaClFrame = 16 << 10
+
+// _new{{.Type}}NaClConn performs the key exchange on conn as the client, if
+// client is set, or as the service. The peer must use the same key.
+func _new{{.Type}}NaClConn(conn io.ReadWriteCloser, key []byte, client bool) (*_{{.Type}}NaClConn, error) {
+	public, private, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	// The client speaks first, so that unbuffered connections such as
+	// net.Pipe don't deadlock.
+	var peer [32]byte
+	send := func() error { _, err := conn.Write(public[:]); return err }
+	receive := func() error { _, err := io.ReadFull(conn, peer[:]); return err }
+	steps := []func() error{receive, send}
+	if client {
+		steps = []func() error{send, receive}
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return nil, err
+		}
+	}
+	var shared [32]byte
+	box.Precompute(&shared, &peer, private)
+	clientPublic, servicePublic := public, &peer
+	if !client {
+		clientPublic, servicePublic = &peer, public
+	}
+	// Without the pre-shared key, a peer or a man in the middle can't
+	// derive the keys, and the first frame fails to open.
+	derive := func(key []byte, direction string) (k [32]byte) {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(shared[:])
+		mac.Write(clientPublic[:])
+		mac.Write(servicePublic[:])
+		mac.Write([]byte(direction))
+		copy(k[:], mac.Sum(nil))
+		return k
+	}
+	c := &_{{.Type}}NaClConn{conn: conn, readKey: derive(key, "service"), writeKey: derive(key, "client")}
+	if !client {
+		c.readKey, c.writeKey = c.writeKey, c.readKey
+	}
+	return c, nil
+}
+
+func _{{.Type}}NaClNonce(n uint64) *[24]byte {
+	var nonce [24]byte
+	binary.BigEndian.PutUint64(nonce[:], n)
+	return &nonce
+}
+
+func (c *_{{.Type}}NaClConn) Read(p []byte) (int, error) {
+	if len(c.pending) == 0 {
+		var size [4]byte
+		if _, err := io.ReadFull(c.conn, size[:]); err != nil {
+			return 0, err
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n > _{{.Type}}MaxNaClFrame+secretbox.Overhead {
+			return 0, fmt.Errorf("rpc: encrypted frame of %d bytes is too large", n)
+		}
+		sealed := make([]byte, n)
+		if _, err := io.ReadFull(c.conn, sealed); err != nil {
+			return 0, err
+		}
+		message, ok := secretbox.Open(nil, sealed, _{{.Type}}NaClNonce(c.readNonce), &c.readKey)
+		if !ok {
+			return 0, errors.New("rpc: encrypted frame failed to open, the peer may use another key")
+		}
+		c.readNonce++
+		c.pending = message
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *_{{.Type}}NaClConn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		message := p
+		if len(message) > _{{.Type}}MaxNaClFrame {
+			message = message[:_{{.Type}}MaxNaClFrame]
+		}
+		frame := make([]byte, 4, 4+len(message)+secretbox.Overhead)
+		binary.BigEndian.PutUint32(frame, uint32(len(message)+secretbox.Overhead))
+		frame = secretbox.Seal(frame, message, _{{.Type}}NaClNonce(c.writeNonce), &c.writeKey)
+		c.writeNonce++
+		if _, err := c.conn.Write(frame); err != nil {
+			return written, err
+		}
+		written += len(message)
+		p = p[len(message):]
+	}
+	return written, nil
+}
+
+func (c *_{{.Type}}NaClConn) Close() error {
+	return c.conn.Close()
+}
+{{end}}
+
+{{define "transport"}}
+// {{.Type}}Transport carries the connections between {{.Type}}Client and
+// {{.Type}}Service over links other than TCP, such as in-memory buses or
+// proprietary links.
+type {{.Type}}Transport interface {
+	// Dial opens a connection to the service.
+	Dial() ({{.Type}}Conn, error)
+	// Accept waits for the next connection to the service. The service
+	// stops serving the transport once it fails.
+	Accept() ({{.Type}}Conn, error)
+}
+
+// {{.Type}}Conn is a connection of a {{.Type}}Transport, exchanging frames of
+// the byte stream of the codec. A frame written on one end is read whole and
+// in order on the other, and the connection owns the frames written to it.
+type {{.Type}}Conn interface {
+	ReadFrame() ([]byte, error)
+	WriteFrame(frame []byte) error
+	Close() error
+}
+
+// _{{.Type}}FrameConn is the byte stream of the frames of a {{.Type}}Conn.
+type _{{.Type}}FrameConn struct {
+	conn    {{.Type}}Conn
+	pending []byte
+}
+
+func (c *_{{.Type}}FrameConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		frame, err := c.conn.ReadFrame()
+		if err != nil {
+			return 0, err
+		}
+		c.pending = frame
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *_{{.Type}}FrameConn) Write(p []byte) (int, error) {
+	// The codec reuses its buffers, so the frame is a copy.
+	if err := c.conn.WriteFrame(append([]byte(nil), p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *_{{.Type}}FrameConn) Close() error {
+	return c.conn.Close()
+}
+{{end}}
+
+{{define "msgp"}}
+//go:generate msgp -file=$GOFILE -tests=false
+{{if or .Server .Client}}
+//msgp:ignore{{if .Server}} {{.Type}}Service{{end}}{{if .Client}} {{.Type}}Client{{end}}
+{{end}}{{end}}
+
+{{define "easyjson"}}
+//go:generate easyjson $GOFILE
+{{end}}
+
+{{define "benchmarks"}}{{$type := .Type}}{{range .Methods}}
+func Benchmark{{$type}}{{.Name}}Request(b *testing.B) {
+	_{{$type}}BenchmarkCodecs(b, &{{$type}}{{.Name}}Request{})
+}
+
+func Benchmark{{$type}}{{.Name}}Response(b *testing.B) {
+	_{{$type}}BenchmarkCodecs(b, &{{$type}}{{.Name}}Response{})
+}
+{{end}}
+// _{{$type}}BenchmarkCodecs encodes a random value of the structure v points
+// to with gob and JSON, and with the binary and msgpack encodings when the
+// structure implements them.
+func _{{$type}}BenchmarkCodecs(b *testing.B, v interface{}) {
+	func() {
+		// Fields quick can't fill, such as unexported ones, leave v zero.
+		defer func() { recover() }()
+		if value, ok := quick.Value(reflect.TypeOf(v).Elem(), rand.New(rand.NewSource(1))); ok {
+			reflect.ValueOf(v).Elem().Set(value)
+		}
+	}()
+	b.Run("gob", func(b *testing.B) {
+		var buf bytes.Buffer
+		enc := gob.NewEncoder(&buf)
+		// Type definitions are only sent with the first value on a connection.
+		if err := enc.Encode(v); err != nil {
+			b.Fatal(err)
+		}
+		_{{$type}}BenchmarkEncode(b, func() ([]byte, error) {
+			buf.Reset()
+			err := enc.Encode(v)
+			return buf.Bytes(), err
+		})
+	})
+	b.Run("json", func(b *testing.B) {
+		_{{$type}}BenchmarkEncode(b, func() ([]byte, error) { return json.Marshal(v) })
+	})
+	if m, ok := v.(encoding.BinaryMarshaler); ok {
+		b.Run("binary", func(b *testing.B) {
+			_{{$type}}BenchmarkEncode(b, m.MarshalBinary)
+		})
+	}
+	if m, ok := v.(interface{ MarshalMsg([]byte) ([]byte, error) }); ok {
+		b.Run("msgp", func(b *testing.B) {
+			var buf []byte
+			_{{$type}}BenchmarkEncode(b, func() ([]byte, error) {
+				var err error
+				buf, err = m.MarshalMsg(buf[:0])
+				return buf, err
+			})
+		})
+	}
+}
+
+// _{{$type}}BenchmarkEncode runs encode b.N times and reports the size of its
+// output.
+func _{{$type}}BenchmarkEncode(b *testing.B, encode func() ([]byte, error)) {
+	out, err := encode()
+	if err != nil {
+		b.Fatal(err)
+	}
+	size := len(out)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := encode(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(size), "B/msg")
+}
+{{end}}
+
+{{define "service"}}
+// {{.Type}}Service is generated service for {{.Type}} interface.
+type {{.Type}}Service struct {
+	impl {{.Interface}}{{if .HasJobs}}
+	jobs *_{{.Type}}Jobs{{end}}{{if .ServerOptions}}
+	options _{{.Type}}ServiceOptions{{end}}
+}
+{{end}}
+
+{{define "service-constructors"}}
+// New{{.Type}}Service creates a new {{.Type}}Service instance.
+func New{{.Type}}Service(impl {{.Interface}}{{if .ServerOptions}}, opts ...{{.Type}}ServiceOption{{end}}) *{{.Type}}Service {
+{{if .ServerOptions}}	s := &{{.Type}}Service{impl: impl{{if .HasJobs}}, jobs: &_{{.Type}}Jobs{jobs: map[uint64]*_{{.Type}}Job{}}{{end}}}
+	for _, opt := range opts {
+		opt(&s.options)
+	}
+	return s
+{{else}}	return &{{.Type}}Service{impl{{if .HasJobs}}, &_{{.Type}}Jobs{jobs: map[uint64]*_{{.Type}}Job{}}{{end}}}
+{{end}}}
+
+// Register{{.Type}}Service registers impl in server.{{if .HandleTypes}} It also
+// registers the services calling the objects methods of impl return through
+// their handles, which server only serves on connections served with a codec
+// from New{{.Type}}HandleCodec.{{end}}
+func Register{{.Type}}Service(server *rpc.Server, impl {{.Interface}}{{if .ServerOptions}}, opts ...{{.Type}}ServiceOption{{end}}) error {
+{{if .HandleTypes}}	if err := server.RegisterName("{{.Service}}", New{{.Type}}Service(impl{{if .ServerOptions}}, opts...{{end}})); err != nil {
+		return err
+	}{{range .HandleTypes}}
+	// Services returning the same objects share their handle service.
+	if err := Register{{.}}HandleService(server); err != nil && !strings.HasPrefix(err.Error(), "rpc: service already defined") {
+		return err
+	}{{end}}
+	return nil
+{{else}}	return server.RegisterName("{{.Service}}", New{{.Type}}Service(impl{{if .ServerOptions}}, opts...{{end}}))
+{{end}}}
+
+// Serve{{.Type}}Conn serves impl on conn, which can be any byte stream, until
+// the client hangs up.{{if .HandleTypes}} It also serves the objects methods of
+// impl return through handles, and forgets them once the client hangs up.{{end}}
+func Serve{{.Type}}Conn(conn io.ReadWriteCloser, impl {{.Interface}}{{if .ServerOptions}}, opts ...{{.Type}}ServiceOption{{end}}) error {
+	server := rpc.NewServer()
+	if err := Register{{.Type}}Service(server, impl{{if .ServerOptions}}, opts...{{end}}); err != nil {
+		return err
+	}
+	server.{{if .HandleTypes}}ServeCodec(New{{.Type}}HandleCodec(_new{{.Type}}GobCodec(conn))){{else}}ServeConn(conn){{end}}
+	return nil
+}
+{{if .HandleTypes}}
+// New{{.Type}}HandleCodec wraps codec so that the server serving it serves the
+// objects methods of {{.Type}}Service return through handles valid on its
+// connection only, and forgets them once the connection is closed.
+func New{{.Type}}HandleCodec(codec rpc.ServerCodec) rpc.ServerCodec {
+	return &_{{.Type}}HandleCodec{ServerCodec: codec, pending: map[uint64]interface{ setConn(interface{}) }{}}
+}
+
+// _{{.Type}}HandleCodec records the codec as the connection of the requests
+// using or returning handles, until it writes their response.
+type _{{.Type}}HandleCodec struct {
+	rpc.ServerCodec
+	seq     uint64
+	mu      sync.Mutex
+	pending map[uint64]interface{ setConn(interface{}) }
+}
+
+func (c *_{{.Type}}HandleCodec) ReadRequestHeader(r *rpc.Request) error {
+	err := c.ServerCodec.ReadRequestHeader(r)
+	c.seq = r.Seq
+	return err
+}
+
+func (c *_{{.Type}}HandleCodec) ReadRequestBody(body interface{}) error {
+	if err := c.ServerCodec.ReadRequestBody(body); err != nil {
+		return err
+	}
+	if request, ok := body.(interface{ setConn(interface{}) }); ok {
+		request.setConn(c)
+		c.mu.Lock()
+		c.pending[c.seq] = request
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+func (c *_{{.Type}}HandleCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.mu.Lock()
+	if request, ok := c.pending[r.Seq]; ok {
+		delete(c.pending, r.Seq)
+		request.setConn(nil)
+	}
+	c.mu.Unlock()
+	return c.ServerCodec.WriteResponse(r, body)
+}
+
+func (c *_{{.Type}}HandleCodec) Close() error {
+	err := c.ServerCodec.Close()
+	c.mu.Lock()
+	for seq, request := range c.pending {
+		delete(c.pending, seq)
+		request.setConn(nil)
+	}
+	c.mu.Unlock(){{range .HandleTypes}}
+	_{{.}}DropHandles(c){{end}}
+	return err
+}
+
+// _new{{.Type}}GobCodec returns the gob codec rpc.Server.ServeConn serves conn
+// with, which net/rpc doesn't export.
+func _new{{.Type}}GobCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	buf := bufio.NewWriter(conn)
+	return &_{{.Type}}GobCodec{conn: conn, buf: buf, dec: gob.NewDecoder(conn), enc: gob.NewEncoder(buf)}
+}
+
+// _{{.Type}}GobCodec is the gob codec of net/rpc.
+type _{{.Type}}GobCodec struct {
+	conn io.ReadWriteCloser
+	buf  *bufio.Writer
+	dec  *gob.Decoder
+	enc  *gob.Encoder
+}
+
+func (c *_{{.Type}}GobCodec) ReadRequestHeader(r *rpc.Request) error {
+	return c.dec.Decode(r)
+}
+
+func (c *_{{.Type}}GobCodec) ReadRequestBody(body interface{}) error {
+	return c.dec.Decode(body)
+}
+
+func (c *_{{.Type}}GobCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	if err := c.enc.Encode(r); err != nil {
+		c.conn.Close()
+		return err
+	}
+	if err := c.enc.Encode(body); err != nil {
+		c.conn.Close()
+		return err
+	}
+	return c.buf.Flush()
+}
+
+func (c *_{{.Type}}GobCodec) Close() error {
+	return c.conn.Close()
+}
+{{end}}{{end}}
+
+{{define "service-methods"}}{{$type := .Type}}{{range .Methods}}{{if and $.LogDeprecated .Deprecated}}
+// _{{$type}}{{.Name}}Deprecated logs the first call of deprecated {{.Name}}.
+var _{{$type}}{{.Name}}Deprecated sync.Once
+{{end}}
+// {{.Name}} is RPC implementation of {{.Name}} calling it.{{if .Notify}}
+// It is a notification: net/rpc still sends the reply, which the client drops.{{end}}
+func (s *{{$type}}Service) {{.Name}}(request *{{$type}}{{.Name}}Request, response *{{$type}}{{.Name}}Response) (err error) {{"{"}}{{if $.Expvar}}
+	defer func(start time.Time) { _{{$type}}Stats["{{.Name}}"].observe(start, err) }(time.Now()){{end}}{{if and $.LogDeprecated .Deprecated}}
+	_{{$type}}{{.Name}}Deprecated.Do(func() {
+		log.Printf("rpc: deprecated method %s called: %s", "{{$.Service}}.{{.Name}}", {{printf "%q" .Deprecated}})
+	}){{end}}{{if .HasHandles}}
+	_conn := _{{$type}}Conn(request)
+	if _conn == nil {
+		return errors.New("{{$.Service}}.{{.Name}}: handles are only served on connections served with New{{$type}}HandleCodec")
+	}{{end}}{{if $.ServerOptions}}
+	return s.options.call("{{.Name}}", request, response, func() (store func(), err error) {{"{"}}{{if .HasChecks}}
+		if err = s._check{{.Name}}(request); err != nil {
+			return nil, err
+		}{{end}}
+		var _response {{$type}}{{.Name}}Response{{if .Dedup}}
+		_call := func() (interface{}, error) {
+		var _response {{$type}}{{.Name}}Response{{end}}{{if $.PprofLabels}}
+		pprof.Do(context.Background(), pprof.Labels("rpc.service", "{{$.Service}}", "rpc.method", "{{.Name}}"), func(context.Context) {
+			{{.Results | publicrefswithprefix "_response."}}{{if .Results}}, {{end}}err = s.{{if .HasConversions}}_{{else}}impl.{{end}}{{.Name}}({{if .HasHandles}}_conn{{if .Parameters}}, {{end}}{{end}}{{.Parameters | publicrefswithprefix "request."}})
+		}){{else}}
+		{{.Results | publicrefswithprefix "_response."}}{{if .Results}}, {{end}}err = s.{{if .HasConversions}}_{{else}}impl.{{end}}{{.Name}}({{if .HasHandles}}_conn{{if .Parameters}}, {{end}}{{end}}{{.Parameters | publicrefswithprefix "request."}}){{end}}{{if .Dedup}}
+		return _response, err
+		}
+		var _recorded interface{}
+		if _recorded, err = s.options.dedupe("{{.Name}}", request.IdempotencyKey, _call); _recorded != nil {
+			_response = _recorded.({{$type}}{{.Name}}Response)
+		}{{end}}
+		return func() { *response = _response }, err
+	}){{else}}{{if .HasChecks}}
+	if err = s._check{{.Name}}(request); err != nil {
+		return err
+	}{{end}}{{if $.PprofLabels}}
+	pprof.Do(context.Background(), pprof.Labels("rpc.service", "{{$.Service}}", "rpc.method", "{{.Name}}"), func(context.Context) {
+		{{.Results | publicrefswithprefix "response."}}{{if .Results}}, {{end}}err = s.{{if .HasConversions}}_{{else}}impl.{{end}}{{.Name}}({{if .HasHandles}}_conn{{if .Parameters}}, {{end}}{{end}}{{.Parameters | publicrefswithprefix "request."}})
+	}){{else}}
+	{{.Results | publicrefswithprefix "response."}}{{if .Results}}, {{end}}err = s.{{if .HasConversions}}_{{else}}impl.{{end}}{{.Name}}({{if .HasHandles}}_conn{{if .Parameters}}, {{end}}{{end}}{{.Parameters | publicrefswithprefix "request."}}){{end}}
+	return{{end}}
+}
+{{if .HasChecks}}
+// _check{{.Name}} sets the defaults of the {{.Name}} request and checks the
+// values of its parameters.
+func (s *{{$type}}Service) _check{{.Name}}(request *{{$type}}{{.Name}}Request) error {{"{"}}{{if .Defaults}}
+	{{defaultfills .}}{{end}}{{if .HasEnums}}
+	{{enumchecks $.Type $.Service .}}{{end}}{{if .Limits}}
+	{{limitchecks $.Service .}}{{end}}
+	return nil
+}
+{{end}}{{if .HasConversions}}
+// _{{.Name}} calls {{.Name}} with its parameters converted from how they are
+// sent, and returns its results converted to how they are sent.
+func (s *{{$type}}Service) _{{.Name}}({{if .HasHandles}}_conn interface{}{{if .Parameters}}, {{end}}{{end}}{{.Parameters | wireparams}}) ({{.Results | wireresults}}{{if .Results}}, {{end}}err error) {
+	{{wirecall $.Service .}}
+}
+{{end}}{{end}}{{end}}
+
+{{define "service-handles"}}{{$type := .Type}}
+// _{{$type}}HandleTable holds the {{$type}} objects served through handles
+// on a connection, by random handle, so that clients can't guess those of
+// others.
+type _{{$type}}HandleTable struct {
+	mu      sync.Mutex
+	objects map[uint64]{{.Interface}}
+}
+
+// _{{$type}}HandleTables are the tables of the {{$type}} objects methods of
+// other services returned, by connection, as recorded by handle codecs.
+var _{{$type}}HandleTables = struct {
+	sync.Mutex
+	tables map[interface{}]*_{{$type}}HandleTable
+}{tables: map[interface{}]*_{{$type}}HandleTable{}}
+
+// _{{$type}}Handles returns the table of the {{$type}} objects served on
+// conn, creating it if needed.
+func _{{$type}}Handles(conn interface{}) *_{{$type}}HandleTable {
+	_{{$type}}HandleTables.Lock()
+	defer _{{$type}}HandleTables.Unlock()
+	t, ok := _{{$type}}HandleTables.tables[conn]
+	if !ok {
+		t = &_{{$type}}HandleTable{objects: map[uint64]{{.Interface}}{}}
+		_{{$type}}HandleTables.tables[conn] = t
+	}
+	return t
+}
+
+// _{{$type}}DropHandles forgets the {{$type}} objects served on conn, and
+// those served through their handles in turn, once it is closed.
+func _{{$type}}DropHandles(conn interface{}) {
+	_{{$type}}HandleTables.Lock()
+	_, ok := _{{$type}}HandleTables.tables[conn]
+	delete(_{{$type}}HandleTables.tables, conn)
+	_{{$type}}HandleTables.Unlock()
+	if !ok {
+		return
+	}{{range .HandleTypes}}
+	_{{.}}DropHandles(conn){{end}}
+}
+
+// add adds impl to the table and returns its handle, or 0 if impl is nil.
+func (t *_{{$type}}HandleTable) add(impl {{.Interface}}) uint64 {
+	if impl == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for {
+		var b [8]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(err)
+		}
+		handle := binary.LittleEndian.Uint64(b[:])
+		if _, ok := t.objects[handle]; handle != 0 && !ok {
+			t.objects[handle] = impl
+			return handle
+		}
+	}
+}
+
+// get returns the object of handle.
+func (t *_{{$type}}HandleTable) get(handle uint64) ({{.Interface}}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	impl, ok := t.objects[handle]
+	if !ok {
+		return nil, fmt.Errorf("{{.Service}}: unknown handle %d", handle)
+	}
+	return impl, nil
+}
+
+// remove forgets the object of handle.
+func (t *_{{$type}}HandleTable) remove(handle uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.objects, handle)
+}
+
+// {{$type}}HandleService serves the methods of the {{$type}} objects methods
+// of other services return, called through their handles.
+type {{$type}}HandleService struct {{"{"}}{{if .ServerOptions}}
+	options _{{$type}}ServiceOptions
+{{end}}}
+
+// Register{{$type}}HandleService registers in server, under
+// {{$type}}HandleServiceName, the service calling the {{$type}} objects methods
+// of other services registered in server return. Register{{$type}}Service and
+// the Register functions of those services already do.
+func Register{{$type}}HandleService(server *rpc.Server{{if .ServerOptions}}, opts ...{{$type}}ServiceOption{{end}}) error {
+	h := &{{$type}}HandleService{}{{if .ServerOptions}}
+	for _, opt := range opts {
+		opt(&h.options)
+	}{{end}}
+	return server.RegisterName({{$type}}HandleServiceName, h)
+}
+
+// _{{$type}}HandleConn returns the connection request came on, or an error if
+// no handle codec read it.
+func _{{$type}}HandleConn(request interface{}) (interface{}, error) {
+	conn := _{{$type}}Conn(request)
+	if conn == nil {
+		return nil, errors.New("{{.Service}}Handle: handles are only served on connections served with a handle codec")
+	}
+	return conn, nil
+}
+{{range .Methods}}
+// {{.Name}} calls {{.Name}} on the object of the handle of the request.
+func (h *{{$type}}HandleService) {{.Name}}(request *{{$type}}{{.Name}}Request, response *{{$type}}{{.Name}}Response) error {
+	conn, err := _{{$type}}HandleConn(request)
+	if err != nil {
+		return err
+	}
+	impl, err := _{{$type}}Handles(conn).get(request.Handle)
+	if err != nil {
+		return err
+	}
+	return (&{{$type}}Service{impl: impl{{if $.ServerOptions}}, options: h.options{{end}}}).{{.Name}}(request, response)
+}
+{{end}}{{if .Handshake}}
+// Handshake fails unless fingerprint, sent by the client, is the one of the
+// service, which it returns in response.
+func (h *{{$type}}HandleService) Handshake(fingerprint string, response *string) error {
+	return (&{{$type}}Service{}).Handshake(fingerprint, response)
+}
+{{end}}
+// ReleaseHandle forgets the object of handle, which the client no longer
+// uses.
+func (h *{{$type}}HandleService) ReleaseHandle(request *{{$type}}ReleaseHandleRequest, _ *struct{}) error {
+	conn, err := _{{$type}}HandleConn(request)
+	if err != nil {
+		return err
+	}
+	_{{$type}}Handles(conn).remove(request.Handle)
+	return nil
+}
+{{end}}
+
+{{define "service-options"}}
+// {{.Type}}ServiceOption configures a {{.Type}}Service.
+type {{.Type}}ServiceOption func(*_{{.Type}}ServiceOptions)
+
+// {{.Type}}Interceptor wraps the calls of {{.Type}}Service methods. It is
+// given the name of the method, without the service name, and its request
+// and response, and calls handler to go on with the call.
+type {{.Type}}Interceptor func(method string, request, response interface{}, handler func() error) error
+
+// With{{.Type}}Interceptor makes the service call its methods through
+// interceptor. Interceptors are called in the order they are given.
+func With{{.Type}}Interceptor(interceptor {{.Type}}Interceptor) {{.Type}}ServiceOption {
+	return func(o *_{{.Type}}ServiceOptions) { o.interceptors = append(o.interceptors, interceptor) }
+}
+
+// With{{.Type}}Logger makes the service log the calls that fail to logger.
+func With{{.Type}}Logger(logger *log.Logger) {{.Type}}ServiceOption {
+	return func(o *_{{.Type}}ServiceOptions) { o.logger = logger }
+}
+
+// With{{.Type}}MaxConcurrency limits the number of calls the service runs at
+// once to n, if positive. Further calls wait for one to finish, or fail if
+// they time out first.{{if .HasPriorities}}
+// Waiting calls of high-priority methods go first, and calls of low-priority
+// methods fail right away while others wait.{{end}}
+func With{{.Type}}MaxConcurrency(n int) {{.Type}}ServiceOption {
+	return func(o *_{{.Type}}ServiceOptions) {
+{{if .HasPriorities}}		o.scheduler = nil
+		if n > 0 {
+			o.scheduler = &_{{.Type}}Scheduler{limit: n}
+		}
+{{else}}		o.slots = nil
+		if n > 0 {
+			o.slots = make(chan struct{}, n)
+		}
+{{end}}	}
+}
+{{if .HasPriorities}}
+// _{{.Type}}Scheduler runs at most limit calls at once. When one finishes,
+// the first waiting call of the highest priority takes its slot. Calls of
+// low-priority methods are shed rather than wait while others already wait,
+// and waiting calls leave the queue once they time out.
+type _{{.Type}}Scheduler struct {
+	mu      sync.Mutex
+	limit   int
+	running int
+	// waiting are the calls waiting for a slot, by priority from high to
+	// low.
+	waiting [3][]chan struct{}
+}
+
+// acquire waits for a slot for a call of method until expired, if not nil,
+// fires. It reports whether it got one, and if not, whether the call was shed
+// rather than timed out.
+func (s *_{{.Type}}Scheduler) acquire(method string, expired <-chan time.Time) (ok, shed bool) {
+	level := 1
+	switch {{.Type}}MethodPriorities[method] {
+	case "high":
+		level = 0
+	case "low":
+		level = 2
+	}
+	s.mu.Lock()
+	if s.running < s.limit {
+		s.running++
+		s.mu.Unlock()
+		return true, false
+	}
+	if level == 2 && len(s.waiting[0])+len(s.waiting[1])+len(s.waiting[2]) > 0 {
+		s.mu.Unlock()
+		return false, true
+	}
+	ready := make(chan struct{})
+	s.waiting[level] = append(s.waiting[level], ready)
+	s.mu.Unlock()
+	select {
+	case <-ready:
+		return true, false
+	case <-expired:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.waiting[level]
+	for i, r := range queue {
+		if r == ready {
+			s.waiting[level] = append(queue[:i], queue[i+1:]...)
+			return false, false
+		}
+	}
+	// The slot was handed over as the call timed out: pass it on.
+	s.handOver()
+	return false, false
+}
+
+// release hands the slot of a finished call over to the waiting call going
+// first, if any.
+func (s *_{{.Type}}Scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handOver()
+}
+
+// handOver is release with s.mu held.
+func (s *_{{.Type}}Scheduler) handOver() {
+	for i, queue := range s.waiting {
+		if len(queue) > 0 {
+			close(queue[0])
+			s.waiting[i] = queue[1:]
+			return
+		}
+	}
+	s.running--
+}
+{{end}}
+// With{{.Type}}Timeout makes calls fail once d has passed since they got past
+// the interceptors, waiting for a slot included. Calls still waiting are
+// dropped; as methods take no context, those running keep running, and their
+// results are dropped.{{if .HasTimeouts}} Methods with a default deadline time out after it
+// instead.{{end}}
+func With{{.Type}}Timeout(d time.Duration) {{.Type}}ServiceOption {
+	return func(o *_{{.Type}}ServiceOptions) { o.timeout = d }
+}
+
+// {{.Type}}Validator validates requests, as the Validate type of
+// github.com/go-playground/validator does with their validate tags.
+type {{.Type}}Validator interface {
+	Struct(s interface{}) error
+}
+
+// With{{.Type}}Validator makes the service validate each request with
+// validator before calling the interceptors and the method, and fail with a
+// *{{.Type}}ValidationError if it is invalid.
+func With{{.Type}}Validator(validator {{.Type}}Validator) {{.Type}}ServiceOption {
+	return func(o *_{{.Type}}ServiceOptions) { o.validator = validator }
+}
+
+// {{.Type}}ValidationError is the error of a call whose request the
+// validator rejected.
+type {{.Type}}ValidationError struct {
+	// Method is the name of the method, without the service name.
+	Method string
+	// Err is the error of the validator.
+	Err error
+}
+
+func (e *{{.Type}}ValidationError) Error() string {
+	return fmt.Sprintf("invalid request for {{.Service}}.%s: %v", e.Method, e.Err)
+}
+
+func (e *{{.Type}}ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// {{.Type}}Authorizer decides whether a call may go on. It is given the name
+// of the method, without the service name, the scopes the method requires,
+// if any, and its request. net/rpc carries no metadata along with calls, so
+// anything identifying the caller has to be part of the request.
+type {{.Type}}Authorizer func(method string, scopes []string, request interface{}) error
+
+// With{{.Type}}Authorizer makes the service call authorizer for each valid
+// request before the interceptors and the method, and fail with its error,
+// if any.
+func With{{.Type}}Authorizer(authorizer {{.Type}}Authorizer) {{.Type}}ServiceOption {
+	return func(o *_{{.Type}}ServiceOptions) { o.authorizer = authorizer }
+}
+{{if .HasDedup}}
+// {{.Type}}DedupStore records the outcomes of the calls of the methods with
+// the //rpcgen:dedup directive by idempotency key, so that the service
+// answers the retries of a call without running it again.
+type {{.Type}}DedupStore interface {
+	// Do returns the response and error of the call of method with key
+	// recorded earlier, waiting for it if it is still running, or else
+	// calls call and records what it returns. Calls that fail may be
+	// forgotten, so that retries run them again.
+	Do(method, key string, call func() (response interface{}, err error)) (interface{}, error)
+}
+
+// New{{.Type}}MemoryDedupStore returns a {{.Type}}DedupStore keeping the
+// responses of the calls that succeeded in memory for ttl, and forgetting the
+// calls that failed. Services of several processes need a shared store
+// instead.
+func New{{.Type}}MemoryDedupStore(ttl time.Duration) {{.Type}}DedupStore {
+	return &_{{.Type}}MemoryDedupStore{ttl: ttl, calls: map[string]*_{{.Type}}DedupCall{}}
+}
+
+// _{{.Type}}MemoryDedupStore is a {{.Type}}DedupStore dropping expired
+// responses once a minute.
+type _{{.Type}}MemoryDedupStore struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	calls map[string]*_{{.Type}}DedupCall
+	sweep time.Time
+}
+
+// _{{.Type}}DedupCall is a call recorded by a _{{.Type}}MemoryDedupStore. Its
+// response and error are set once done is closed, and it expires when it has
+// finished ttl ago.
+type _{{.Type}}DedupCall struct {
+	done     chan struct{}
+	response interface{}
+	err      error
+	expires  time.Time
+}
+
+func (s *_{{.Type}}MemoryDedupStore) Do(method, key string, call func() (interface{}, error)) (interface{}, error) {
+	id := method + " " + key
+	s.mu.Lock()
+	now := time.Now()
+	if now.After(s.sweep) {
+		for id, c := range s.calls {
+			if !c.expires.IsZero() && now.After(c.expires) {
+				delete(s.calls, id)
+			}
+		}
+		s.sweep = now.Add(time.Minute)
+	}
+	if c, ok := s.calls[id]; ok && (c.expires.IsZero() || !now.After(c.expires)) {
+		s.mu.Unlock()
+		<-c.done
+		return c.response, c.err
+	}
+	c := &_{{.Type}}DedupCall{done: make(chan struct{})}
+	s.calls[id] = c
+	s.mu.Unlock()
+	c.response, c.err = call()
+	s.mu.Lock()
+	if c.err != nil {
+		delete(s.calls, id)
+	} else {
+		c.expires = time.Now().Add(s.ttl)
+	}
+	s.mu.Unlock()
+	close(c.done)
+	return c.response, c.err
+}
+
+// With{{.Type}}DedupStore makes the service run the calls of the methods with
+// the //rpcgen:dedup directive once per idempotency key with store, and
+// answer the others with the outcome store recorded.
+func With{{.Type}}DedupStore(store {{.Type}}DedupStore) {{.Type}}ServiceOption {
+	return func(o *_{{.Type}}ServiceOptions) { o.dedup = store }
+}
+{{end}}
+// _{{.Type}}ServiceOptions are the options of a {{.Type}}Service.
+type _{{.Type}}ServiceOptions struct {
+	interceptors []{{.Type}}Interceptor
+	logger       *log.Logger{{if .HasPriorities}}
+	scheduler    *_{{.Type}}Scheduler{{else}}
+	slots        chan struct{}{{end}}
+	timeout      time.Duration
+	validator    {{.Type}}Validator
+	authorizer   {{.Type}}Authorizer{{if .HasDedup}}
+	dedup        {{.Type}}DedupStore{{end}}{{if .Runner}}
+	onConnect    func({{.Type}}ConnInfo)
+	onDisconnect func({{.Type}}ConnInfo)
+	maxConns     int
+	idleTimeout  time.Duration{{end}}
+}
+
+// call validates and authorizes the request, then calls method through the
+// interceptors, within the concurrency limit and the timeout. invoke checks
+// the request, calls the implementation and returns a function storing its
+// results in the response, if it got that far, which is only called if the
+// call didn't time out.
+func (o *_{{.Type}}ServiceOptions) call(method string, request, response interface{}, invoke func() (store func(), err error)) error {
+	timeout := o.timeout{{if .HasTimeouts}}
+	if d, ok := {{.Type}}MethodTimeouts[method]; ok {
+		timeout = d
+	}{{end}}
+	handler := func() error {
+		// The deadline starts before the call waits for a slot, so that
+		// the wait counts against it.
+		var expired <-chan time.Time
+		if timeout > 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		timedOut := func() error {
+			return fmt.Errorf("{{.Service}}.%s timed out after %s", method, timeout)
+		}
+{{if .HasPriorities}}		if o.scheduler != nil {
+			if ok, shed := o.scheduler.acquire(method, expired); shed {
+				return fmt.Errorf("{{.Service}}.%s shed: the service is overloaded", method)
+			} else if !ok {
+				return timedOut()
+			}
+		}
+{{else}}		if o.slots != nil {
+			select {
+			case o.slots <- struct{}{}:
+			case <-expired:
+				return timedOut()
+			}
+		}
+{{end}}		type outcome struct {
+			store func()
+			err   error
+		}
+		run := func() outcome {
+{{if .HasPriorities}}			if o.scheduler != nil {
+				defer o.scheduler.release()
+			}
+{{else}}			if o.slots != nil {
+				defer func() { <-o.slots }()
+			}
+{{end}}
+			store, err := invoke()
+			return outcome{store, err}
+		}
+		if timeout <= 0 {
+			out := run()
+			if out.store != nil {
+				out.store()
+			}
+			return out.err
+		}
+		done := make(chan outcome, 1)
+		go func() { done <- run() }()
+		select {
+		case out := <-done:
+			if out.store != nil {
+				out.store()
+			}
+			return out.err
+		case <-expired:
+			return timedOut()
+		}
+	}
+	for i := len(o.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := o.interceptors[i], handler
+		handler = func() error { return interceptor(method, request, response, next) }
+	}
+	var err error
+	if o.validator != nil {
+		if verr := o.validator.Struct(request); verr != nil {
+			err = &{{.Type}}ValidationError{method, verr}
+		}
+	}
+	if err == nil && o.authorizer != nil {
+		err = o.authorizer(method, {{if .HasScopes}}{{.Type}}MethodScopes[method]{{else}}nil{{end}}, request)
+	}
+	if err == nil {
+		err = handler()
+	}
+	if err != nil && o.logger != nil {
+		o.logger.Printf("rpc: {{.Service}}.%s failed: %v", method, err)
+	}
+	return err
+}{{if .HasDedup}}
+
+// dedupe calls call through the dedup store, if any, for calls of method
+// with an idempotency key.
+func (o *_{{.Type}}ServiceOptions) dedupe(method, key string, call func() (interface{}, error)) (interface{}, error) {
+	if o.dedup == nil || key == "" {
+		return call()
+	}
+	return o.dedup.Do(method, key, call)
+}{{end}}
+{{end}}
+
+{{define "service-stats"}}{{$type := .Type}}
+// _{{$type}}Stats are the statistics of the calls served by {{$type}}Service,
+// published with expvar as "{{.Service}}". Services of the same name in other
+// packages of the program share the variable; for methods they have in
+// common, it holds the statistics of the last one initialized.
+var _{{$type}}Stats = _new{{$type}}Stats({{range $i, $m := .Methods}}{{if $i}}, {{end}}"{{$m.Name}}"{{end}})
+
+// _{{$type}}MethodStats are the statistics of the calls of a method.
+type _{{$type}}MethodStats struct {
+	calls, errors expvar.Int
+	mu            sync.Mutex
+	latency       time.Duration // moving average
+}
+
+func _new{{$type}}Stats(methods ...string) map[string]*_{{$type}}MethodStats {
+	stats := map[string]*_{{$type}}MethodStats{}
+	// expvar.Publish panics when the name is taken.
+	vars, ok := expvar.Get("{{.Service}}").(*expvar.Map)
+	if !ok {
+		vars = new(expvar.Map)
+		if expvar.Get("{{.Service}}") == nil {
+			expvar.Publish("{{.Service}}", vars)
+		}
+	}
+	for _, method := range methods {
+		s := &_{{$type}}MethodStats{}
+		stats[method] = s
+		methodVars := new(expvar.Map)
+		methodVars.Set("calls", &s.calls)
+		methodVars.Set("errors", &s.errors)
+		methodVars.Set("latency_ns", expvar.Func(func() interface{} {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return int64(s.latency)
+		}))
+		vars.Set(method, methodVars)
+	}
+	return stats
+}
+
+// observe records a call that started at start and returned err.
+func (s *_{{$type}}MethodStats) observe(start time.Time, err error) {
+	latency := time.Since(start)
+	s.calls.Add(1)
+	if err != nil {
+		s.errors.Add(1)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.latency == 0 {
+		s.latency = latency
+	} else {
+		// Exponentially weighted, so that the last calls matter most.
+		s.latency += (latency - s.latency) / 8
+	}
+}
+{{end}}
+
+{{define "service-handshake"}}
+// Handshake fails unless fingerprint, sent by the client, is the one of the
+// service, which it returns in response.
+func (s *{{.Type}}Service) Handshake(fingerprint string, response *string) error {
+	*response = {{.Type}}Fingerprint
+	if fingerprint != {{.Type}}Fingerprint {
+		return fmt.Errorf("client generated from interface %s, but service from %s; regenerate both from the same version of {{.Type}}", fingerprint, {{.Type}}Fingerprint)
+	}
+	return nil
+}
+{{end}}
+
+{{define "service-jobs"}}{{$type := .Type}}
+// _{{$type}}JobTTL is how long uncollected results of finished jobs are kept.
+const _{{$type}}JobTTL = {{.JobTTL | goduration}}
+
+// _{{$type}}MaxJobs is how many jobs, running or not yet collected, are kept
+// at once.
+const _{{$type}}MaxJobs = {{.MaxJobs}}
+
+// _{{$type}}Jobs are the jobs run by a {{$type}}Service, by random ID, so that
+// clients can't guess those of others.
+type _{{$type}}Jobs struct {
+	mu   sync.Mutex
+	jobs map[uint64]*_{{$type}}Job
+}
+
+// _{{$type}}Job is a call of method run in the background.
+type _{{$type}}Job struct {
+	method   string
+	done     chan struct{}
+	response interface{}
+	err      error
+}
+
+// start runs call in the background and returns the ID of its job. It fails
+// if _{{$type}}MaxJobs jobs are already kept.
+func (j *_{{$type}}Jobs) start(method string, call func() (interface{}, error)) (uint64, error) {
+	job := &_{{$type}}Job{method: method, done: make(chan struct{})}
+	j.mu.Lock()
+	if len(j.jobs) >= _{{$type}}MaxJobs {
+		j.mu.Unlock()
+		return 0, fmt.Errorf("can't start %s: %d jobs are running or waiting to be collected", method, len(j.jobs))
+	}
+	var id uint64
+	for id == 0 || j.jobs[id] != nil {
+		var b [8]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(err)
+		}
+		id = binary.LittleEndian.Uint64(b[:])
+	}
+	j.jobs[id] = job
+	j.mu.Unlock()
+	go func() {
+		job.response, job.err = call()
+		close(job.done)
+		time.AfterFunc(_{{$type}}JobTTL, func() { j.remove(id) })
+	}()
+	return id, nil
+}
+
+// get returns the job of method with the given ID.
+func (j *_{{$type}}Jobs) get(method string, id uint64) (*_{{$type}}Job, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job := j.jobs[id]
+	if job == nil || job.method != method {
+		return nil, fmt.Errorf("no job %d of %s", id, method)
+	}
+	return job, nil
+}
+
+func (j *_{{$type}}Jobs) remove(id uint64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.jobs, id)
+}
+{{range .Methods}}{{if .Job}}
+// Start{{.Name}} starts {{.Name}} as a job and returns its ID at once.
+func (s *{{$type}}Service) Start{{.Name}}(request *{{$type}}{{.Name}}Request, response *{{$type}}Job) error {
+	id, err := s.jobs.start("{{.Name}}", func() (interface{}, error) {
+		response := &{{$type}}{{.Name}}Response{}
+		err := s.{{.Name}}(request, response)
+		return response, err
+	})
+	response.ID = id
+	return err
+}
+
+// {{.Name}}Status returns the state of a job started by Start{{.Name}}.
+func (s *{{$type}}Service) {{.Name}}Status(request *{{$type}}Job, response *{{$type}}JobStatus) error {
+	job, err := s.jobs.get("{{.Name}}", request.ID)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-job.done:
+		response.Done = true
+	default:
+	}
+	return nil
+}
+
+// {{.Name}}Result returns the outcome of a finished job started by
+// Start{{.Name}}, which is then forgotten.
+func (s *{{$type}}Service) {{.Name}}Result(request *{{$type}}Job, response *{{$type}}{{.Name}}Response) error {
+	job, err := s.jobs.get("{{.Name}}", request.ID)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-job.done:
+	default:
+		return fmt.Errorf("job %d of {{.Name}} is still running", request.ID)
+	}
+	s.jobs.remove(request.ID)
+	if job.err != nil {
+		return job.err
+	}
+	*response = *job.response.(*{{$type}}{{.Name}}Response)
+	return nil
+}
+
+// Cancel{{.Name}} forgets a job started by Start{{.Name}}, returning its
+// state. A running call of {{.Name}} can't be interrupted, and its outcome is
+// dropped.
+func (s *{{$type}}Service) Cancel{{.Name}}(request *{{$type}}Job, response *{{$type}}JobStatus) error {
+	if err := s.{{.Name}}Status(request, response); err != nil {
+		return err
+	}
+	s.jobs.remove(request.ID)
+	return nil
+}
+{{end}}{{end}}{{end}}
+
+{{define "service-hmac"}}
+// {{.Type}}HMACWindow is how far the time a request was signed at may be from
+// the time Serve{{.Type}}ConnHMAC receives it.
+const {{.Type}}HMACWindow = 5 * time.Minute
+
+// {{.Type}}NonceStore remembers the nonces of the signed requests a service
+// received, so that it can reject replayed ones.
+type {{.Type}}NonceStore interface {
+	// Add remembers nonce until expires, and reports whether it is new.
+	Add(nonce []byte, expires time.Time) bool
+}
+
+// New{{.Type}}MemoryNonceStore returns a {{.Type}}NonceStore keeping nonces in
+// memory. Services of several processes sharing a key need a shared store
+// instead.
+func New{{.Type}}MemoryNonceStore() {{.Type}}NonceStore {
+	return &_{{.Type}}MemoryNonceStore{nonces: map[string]time.Time{}}
+}
+
+// _{{.Type}}MemoryNonceStore is a {{.Type}}NonceStore dropping expired nonces
+// once a minute.
+type _{{.Type}}MemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	sweep  time.Time
+}
+
+func (s *_{{.Type}}MemoryNonceStore) Add(nonce []byte, expires time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.After(s.sweep) {
+		for n, e := range s.nonces {
+			if now.After(e) {
+				delete(s.nonces, n)
+			}
+		}
+		s.sweep = now.Add(time.Minute)
+	}
+	if e, ok := s.nonces[string(nonce)]; ok && !now.After(e) {
+		return false
+	}
+	s.nonces[string(nonce)] = expires
+	return true
+}
+
+// _{{.Type}}Nonces are the nonces of the requests served by
+// Serve{{.Type}}ConnHMAC, shared by all connections.
+var _{{.Type}}Nonces = New{{.Type}}MemoryNonceStore()
+
+// Serve{{.Type}}ConnHMAC serves impl on conn like Serve{{.Type}}Conn, but only
+// to clients signing their requests with key, as those from
+// Dial{{.Type}}ClientHMAC and New{{.Type}}ClientConnHMAC do. Calls with an invalid
+// signature, signed out of {{.Type}}HMACWindow, or replaying a request already
+// received on any connection, fail without calling impl.
+func Serve{{.Type}}ConnHMAC(conn io.ReadWriteCloser, key []byte, impl {{.Interface}}{{if .ServerOptions}}, opts ...{{.Type}}ServiceOption{{end}}) error {
+	server := rpc.NewServer()
+	if err := Register{{.Type}}Service(server, impl{{if .ServerOptions}}, opts...{{end}}); err != nil {
+		return err
+	}
+	server.ServeCodec({{if .HandleTypes}}New{{.Type}}HandleCodec({{end}}New{{.Type}}ServerCodecHMAC(conn, key, _{{.Type}}Nonces){{if .HandleTypes}}){{end}})
+	return nil
+}
+
+// New{{.Type}}ServerCodecHMAC returns the gob codec of net/rpc on conn,
+// rejecting requests not signed with key, signed out of {{.Type}}HMACWindow,
+// or whose nonce is already in nonces, and signing responses with key, for
+// serving with rpc.Server.ServeCodec.
+func New{{.Type}}ServerCodecHMAC(conn io.ReadWriteCloser, key []byte, nonces {{.Type}}NonceStore) rpc.ServerCodec {
+	buf := bufio.NewWriter(conn)
+	return &_{{.Type}}HMACServerCodec{conn: conn, buf: buf, dec: gob.NewDecoder(conn), enc: gob.NewEncoder(buf), key: key, nonces: nonces, requests: map[uint64][]byte{}}
+}
+
+// _{{.Type}}HMACServerCodec is the gob codec of net/rpc, verifying the
+// signature of requests and signing responses.
+type _{{.Type}}HMACServerCodec struct {
+	conn   io.ReadWriteCloser
+	buf    *bufio.Writer
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	key    []byte
+	nonces {{.Type}}NonceStore
+	method string
+	seq    uint64
+	mu     sync.Mutex
+	// requests are the nonces of the requests not answered yet, by
+	// sequence number.
+	requests map[uint64][]byte
+}
+
+func (c *_{{.Type}}HMACServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	err := c.dec.Decode(r)
+	c.method, c.seq = r.ServiceMethod, r.Seq
+	return err
+}
+
+func (c *_{{.Type}}HMACServerCodec) ReadRequestBody(body interface{}) error {
+	var signed {{.Type}}SignedRequest
+	err := c.dec.Decode(&signed)
+	c.mu.Lock()
+	c.requests[c.seq] = signed.Nonce
+	c.mu.Unlock()
+	if err != nil || body == nil {
+		return err
+	}
+	if !hmac.Equal(signed.MAC, {{.Type}}RequestMAC(c.key, c.method, signed.Body, signed.Time, signed.Nonce)) {
+		return errors.New("rpc: invalid request signature")
+	}
+	signedAt := time.Unix(0, signed.Time)
+	if d := time.Since(signedAt); d > {{.Type}}HMACWindow || d < -{{.Type}}HMACWindow {
+		return fmt.Errorf("rpc: request signed %s away from the time of the service", d)
+	}
+	if !c.nonces.Add(signed.Nonce, signedAt.Add({{.Type}}HMACWindow)) {
+		return errors.New("rpc: replayed request")
+	}
+	return gob.NewDecoder(bytes.NewReader(signed.Body)).Decode(body)
+}
+
+func (c *_{{.Type}}HMACServerCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.mu.Lock()
+	nonce := c.requests[r.Seq]
+	delete(c.requests, r.Seq)
+	c.mu.Unlock()
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(body); err != nil {
+		c.conn.Close()
+		return err
+	}
+	if err := c.enc.Encode(r); err != nil {
+		c.conn.Close()
+		return err
+	}
+	if err := c.enc.Encode(&{{.Type}}SignedResponse{b.Bytes(), {{.Type}}ResponseMAC(c.key, r.ServiceMethod, r.Seq, r.Error, b.Bytes(), nonce)}); err != nil {
+		c.conn.Close()
+		return err
+	}
+	return c.buf.Flush()
+}
+
+func (c *_{{.Type}}HMACServerCodec) Close() error {
+	return c.conn.Close()
+}
+{{end}}
+
+{{define "service-nacl"}}
+// Serve{{.Type}}ConnNaCl serves impl on conn like Serve{{.Type}}Conn, but
+// encrypts the traffic, for clients from Dial{{.Type}}ClientNaCl and
+// New{{.Type}}ClientConnNaCl using the same key. It fails if the key exchange
+// does.
+func Serve{{.Type}}ConnNaCl(conn io.ReadWriteCloser, key []byte, impl {{.Interface}}{{if .ServerOptions}}, opts ...{{.Type}}ServiceOption{{end}}) error {
+	encrypted, err := _new{{.Type}}NaClConn(conn, key, false)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	return Serve{{.Type}}Conn(encrypted, impl{{if .ServerOptions}}, opts...{{end}})
+}
+{{end}}
+
+{{define "service-transport"}}
+// Serve{{.Type}}Transport serves impl on each connection accepted on
+// transport, until Accept fails, whose error it returns.{{if .HandleTypes}} Each
+// connection has its own handle tables, which are forgotten once it is
+// closed.{{end}}
+func Serve{{.Type}}Transport(transport {{.Type}}Transport, impl {{.Interface}}{{if .ServerOptions}}, opts ...{{.Type}}ServiceOption{{end}}) error {
+	server := rpc.NewServer()
+	if err := Register{{.Type}}Service(server, impl{{if .ServerOptions}}, opts...{{end}}); err != nil {
+		return err
+	}
+	for {
+		conn, err := transport.Accept()
+		if err != nil {
+			return err
+		}
+		go server.{{if .HandleTypes}}ServeCodec(New{{.Type}}HandleCodec(_new{{.Type}}GobCodec(&_{{.Type}}FrameConn{conn: conn}))){{else}}ServeConn(&_{{.Type}}FrameConn{conn: conn}){{end}}
+	}
+}
+{{end}}
+
+{{define "service-runner"}}
+// {{.Type}}ConnInfo describes a connection served by Run{{.Type}}Server or
+// Run{{.Type}}Sessions.
+type {{.Type}}ConnInfo struct {
+	// ID tells the connection apart from the others served by the same
+	// call, starting from 1.
+	ID         uint64
+	RemoteAddr net.Addr
+	LocalAddr  net.Addr
+}
+{{if .ServerOptions}}
+// With{{.Type}}OnConnect makes Run{{.Type}}Server and Run{{.Type}}Sessions
+// call hook with each connection they accept, before serving it.
+func With{{.Type}}OnConnect(hook func({{.Type}}ConnInfo)) {{.Type}}ServiceOption {
+	return func(o *_{{.Type}}ServiceOptions) { o.onConnect = hook }
+}
+
+// With{{.Type}}OnDisconnect makes Run{{.Type}}Server and Run{{.Type}}Sessions
+// call hook with each connection they served, once it is closed.
+func With{{.Type}}OnDisconnect(hook func({{.Type}}ConnInfo)) {{.Type}}ServiceOption {
+	return func(o *_{{.Type}}ServiceOptions) { o.onDisconnect = hook }
+}
+
+// With{{.Type}}MaxConnections limits the number of connections
+// Run{{.Type}}Server and Run{{.Type}}Sessions serve at once to n, if
+// positive. They close the connections they accept beyond it right away.
+func With{{.Type}}MaxConnections(n int) {{.Type}}ServiceOption {
+	return func(o *_{{.Type}}ServiceOptions) { o.maxConns = n }
+}
+
+// With{{.Type}}IdleTimeout makes Run{{.Type}}Server and Run{{.Type}}Sessions
+// close the connections that send no request for d, once the calls in
+// progress on them have replied.
+func With{{.Type}}IdleTimeout(d time.Duration) {{.Type}}ServiceOption {
+	return func(o *_{{.Type}}ServiceOptions) { o.idleTimeout = d }
+}
+
+// _{{.Type}}IdleConn is a connection calling extend before each read, to push
+// its read deadline back, and idle once a read failed as it passed.
+type _{{.Type}}IdleConn struct {
+	net.Conn
+	extend func()
+	idle   func()
+}
+
+func (c *_{{.Type}}IdleConn) Read(p []byte) (int, error) {
+	c.extend()
+	n, err := c.Conn.Read(p)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		c.idle()
+	}
+	return n, err
+}
+{{end}}
+// Run{{.Type}}Server serves impl on listener until ctx is done or the
+// process receives SIGINT or SIGTERM. It then stops accepting connections,
+// lets the calls in progress reply, and returns once all connections are
+// closed.{{if .HandleTypes}} Each connection has its own handle tables, which
+// are forgotten once it is closed.{{end}}
+func Run{{.Type}}Server(ctx context.Context, listener net.Listener, impl {{.Interface}}{{if .ServerOptions}}, opts ...{{.Type}}ServiceOption{{end}}) error {
+{{if .HandleTypes}}	return Run{{.Type}}Sessions(ctx, listener, func({{.Type}}ConnInfo) {{.Interface}} { return impl }{{if .ServerOptions}}, opts...{{end}})
+{{else}}	server := rpc.NewServer()
+	if err := Register{{.Type}}Service(server, impl{{if .ServerOptions}}, opts...{{end}}); err != nil {
+		return err
+	}
+	return _run{{.Type}}Listener(ctx, listener, {{if .ServerOptions}}opts, {{end}}func(conn net.Conn, _ {{.Type}}ConnInfo) {
+		server.ServeConn(conn)
+	})
+{{end}}}
+
+// Run{{.Type}}Sessions is like Run{{.Type}}Server, but serves each connection
+// with its own implementation, returned by factory when the connection is
+// accepted, for protocols keeping state per connection.
+func Run{{.Type}}Sessions(ctx context.Context, listener net.Listener, factory func({{.Type}}ConnInfo) {{.Interface}}{{if .ServerOptions}}, opts ...{{.Type}}ServiceOption{{end}}) error {
+	return _run{{.Type}}Listener(ctx, listener, {{if .ServerOptions}}opts, {{end}}func(conn net.Conn, info {{.Type}}ConnInfo) {
+		if err := Serve{{.Type}}Conn(conn, factory(info){{if .ServerOptions}}, opts...{{end}}); err != nil {
+			log.Printf("rpc: serving %s: %v", info.RemoteAddr, err)
+			conn.Close()
+		}
+	})
+}
+
+// _run{{.Type}}Listener calls serve for each connection accepted on listener,
+// until ctx is done or the process receives SIGINT or SIGTERM, then drains
+// the connections.{{if .ServerOptions}} Of opts, it applies those about
+// connections.{{end}}
+func _run{{.Type}}Listener(ctx context.Context, listener net.Listener, {{if .ServerOptions}}opts []{{.Type}}ServiceOption, {{end}}serve func(net.Conn, {{.Type}}ConnInfo)) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop(){{if .ServerOptions}}
+	var o _{{.Type}}ServiceOptions
+	for _, opt := range opts {
+		opt(&o)
+	}{{end}}
+	var (
+		mu       sync.Mutex
+		draining bool
+		conns    = map[net.Conn]bool{}
+		wg       sync.WaitGroup
+		id       uint64
+	)
+	// Failing the reads of a connection makes net/rpc wait for its calls in
+	// progress, send their responses and close it.
+	drain := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		draining = true
+		for conn := range conns {
+			conn.SetReadDeadline(time.Now())
+		}
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	var (
+		err   error
+		delay time.Duration
+	)
+	for {
+		var conn net.Conn
+		if conn, err = listener.Accept(); err != nil {
+			// Like net/http, retry temporary errors, such as running out of
+			// file descriptors, backing off up to a second.
+			if temp, ok := err.(interface{ Temporary() bool }); !ok || !temp.Temporary() || ctx.Err() != nil {
+				break
+			}
+			if delay *= 2; delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay > time.Second {
+				delay = time.Second
+			}{{if .ServerOptions}}
+			if o.logger != nil {
+				o.logger.Printf("rpc: accept failed: %v; retrying in %s", err, delay)
+			}{{end}}
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		delay = 0
+		mu.Lock(){{if .ServerOptions}}
+		if o.maxConns > 0 && len(conns) >= o.maxConns {
+			mu.Unlock()
+			if o.logger != nil {
+				o.logger.Printf("rpc: rejected %s: %d connections open", conn.RemoteAddr(), o.maxConns)
+			}
+			conn.Close()
+			continue
+		}
+		if o.idleTimeout > 0 {
+			raw := conn
+			// Draining sets the deadline for good.
+			conn = &_{{.Type}}IdleConn{raw, func() {
+				mu.Lock()
+				defer mu.Unlock()
+				if !draining {
+					raw.SetReadDeadline(time.Now().Add(o.idleTimeout))
+				}
+			}, func() {
+				mu.Lock()
+				defer mu.Unlock()
+				if !draining && o.logger != nil {
+					o.logger.Printf("rpc: connection lost: %s sent no request for %s", raw.RemoteAddr(), o.idleTimeout)
+				}
+			}}
+		}{{end}}
+		conns[conn] = true
+		if draining {
+			conn.SetReadDeadline(time.Now())
+		}
+		mu.Unlock()
+		id++
+		info := {{.Type}}ConnInfo{ID: id, RemoteAddr: conn.RemoteAddr(), LocalAddr: conn.LocalAddr()}
+		wg.Add(1)
+		go func() {
+			defer wg.Done(){{if .ServerOptions}}
+			if o.onConnect != nil {
+				o.onConnect(info)
+			}{{end}}
+			serve(conn, info)
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock(){{if .ServerOptions}}
+			if o.onDisconnect != nil {
+				o.onDisconnect(info)
+			}{{end}}
+		}()
+	}
+	drain()
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+{{end}}
+
+{{define "service-health"}}
+// HealthMux returns an HTTP handler for the probes of deployments: /healthz
+// always succeeds, and /readyz succeeds unless the implementation has a
+// Ready() error method returning an error.{{if .Expvar}} The call statistics
+// are served at /debug/vars.{{end}}
+func (s *{{.Type}}Service) HealthMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if impl, ok := s.impl.(interface{ Ready() error }); ok {
+			if err := impl.Ready(); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		fmt.Fprintln(w, "ok")
+	}){{if .Expvar}}
+	mux.Handle("/debug/vars", expvar.Handler()){{end}}
+	return mux
+}
+{{end}}
+
+{{define "service-faults"}}{{$type := .Type}}
+// {{.Type}}Fault is the fault {{.Type}}WithFaults injects into a call.
+type {{.Type}}Fault struct {
+	// Delay is how long the call waits before going on.
+	Delay time.Duration
+	// Err, if set, fails the call without calling the implementation.
+	Err error
+	// Drop makes the call fail with an error wrapping
+	// os.ErrDeadlineExceeded once the implementation returns, as if its
+	// response were lost.
+	Drop bool
+}
+
+// {{.Type}}FaultPolicy returns the fault to inject into the call number call,
+// starting at 1, of method, without the service name. Calls are numbered for
+// each method, so that policies can be deterministic.
+type {{.Type}}FaultPolicy func(method string, call int) {{.Type}}Fault
+
+// {{.Type}}WithFaults returns impl injecting the faults policy returns into
+// its calls, to test retries, timeouts and deduplication. As a
+// *{{.Type}}Client implements the interface too, it can decorate a client as
+// well as the implementation a service calls.
+func {{.Type}}WithFaults(impl {{.Interface}}, policy {{.Type}}FaultPolicy) {{.Interface}} {
+	return &_{{.Type}}Faults{impl: impl, policy: policy, calls: map[string]int{}}
+}
+
+// _{{.Type}}Faults is the decorator returned by {{.Type}}WithFaults.
+type _{{.Type}}Faults struct {
+	impl   {{.Interface}}
+	policy {{.Type}}FaultPolicy
+	mu     sync.Mutex
+	calls  map[string]int
+}
+
+// inject returns the fault of the next call of method, once its delay has
+// passed.
+func (f *_{{.Type}}Faults) inject(method string) {{.Type}}Fault {
+	f.mu.Lock()
+	f.calls[method]++
+	call := f.calls[method]
+	f.mu.Unlock()
+	fault := f.policy(method, call)
+	if fault.Delay > 0 {
+		time.Sleep(fault.Delay)
+	}
+	return fault
+}
+{{range .Methods}}
+func (_f *_{{$type}}Faults) {{.Name}}({{.Parameters | functionargs}}) ({{.Results | functionargs}}{{if .Results}}, {{end}}err error) {
+	_fault := _f.inject("{{.Name}}")
+	if _fault.Err != nil {
+		err = _fault.Err
+		return
+	}
+	if _fault.Drop {
+		_f.impl.{{.Name}}({{.Parameters | refswithprefix ""}})
+		err = fmt.Errorf("{{$.Service}}.{{.Name}} response dropped: %w", os.ErrDeadlineExceeded)
+		return
+	}
+	return _f.impl.{{.Name}}({{.Parameters | refswithprefix ""}})
+}
+{{end}}{{end}}
+
+{{define "service-dispatch"}}{{$type := .Type}}
+// Dispatch calls the method named method, or "{{.Service}}.<method>", with
+// request and response, without the reflection of net/rpc. They must be the
+// structures returned by NewMessages for the method.
+func (s *{{$type}}Service) Dispatch(method string, request, response interface{}) error {
+	switch method {
+	{{range .Methods}}case "{{.Name}}", "{{$.Service}}.{{.Name}}":
+		if request, ok := request.(*{{$type}}{{.Name}}Request); ok {
+			if response, ok := response.(*{{$type}}{{.Name}}Response); ok {
+				return s.{{.Name}}(request, response)
+			}
+		}
+		return fmt.Errorf("rpc: wrong request or response type for method %s: %T, %T", method, request, response)
+	{{end}}}
+	return fmt.Errorf("rpc: can't find method %s", method)
+}
+
+// NewMessages returns a new request and response for the method named
+// method, or "{{.Service}}.<method>", to decode into and pass to Dispatch.
+func (s *{{$type}}Service) NewMessages(method string) (request, response interface{}, ok bool) {
+	switch method {
+	{{range .Methods}}case "{{.Name}}", "{{$.Service}}.{{.Name}}":
+		return &{{$type}}{{.Name}}Request{}, &{{$type}}{{.Name}}Response{}, true
+	{{end}}}
+	return nil, nil, false
+}
+{{end}}
+
+{{define "client"}}
+// {{.Type}}Client is generated client for {{.Type}} interface.
+type {{.Type}}Client struct {
+	client {{.RPCType}}{{if .WireDump}}
+	dump   *_{{.Type}}WireDump{{end}}{{if .ClientOptions}}
+	options _{{.Type}}ClientOptions{{end}}{{if .Handle}}
+	// handle is the handle of the object the client calls.
+	handle uint64{{end}}
+}
+{{end}}
+
+{{define "client-constructors"}}
+// Dial{{.Type}}Client connects to addr and creates a new {{.Type}}Client instance.
+func Dial{{.Type}}Client(addr string{{if .ClientOptions}}, opts ...{{.Type}}ClientOption{{end}}) (*{{.Type}}Client, error) {
+{{if .WireDump}}	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+{{if .Handshake}}	c := New{{.Type}}ClientConn(conn{{if .ClientOptions}}, opts...{{end}})
+{{else}}	return New{{.Type}}ClientConn(conn{{if .ClientOptions}}, opts...{{end}}), nil
+{{end}}{{else}}	client, err := rpc.Dial("tcp", addr)
+{{if .Handshake}}	if err != nil {
+		return nil, err
+	}
+	c := {{if .ClientOptions}}_{{.Type}}Keepalive({{end}}&{{.Type}}Client{client{{if .ClientOptions}}, _new{{.Type}}ClientOptions(opts){{end}}{{if .Handle}}, 0{{end}}}{{if .ClientOptions}}){{end}}
+{{else}}	return {{if .ClientOptions}}_{{.Type}}Keepalive({{end}}&{{.Type}}Client{client{{if .ClientOptions}}, _new{{.Type}}ClientOptions(opts){{end}}{{if .Handle}}, 0{{end}}}{{if .ClientOptions}}){{end}}, err
+{{end}}{{end}}{{if .Handshake}}	if err := c.Handshake(); err != nil {
+		c.client.Close()
+		return nil, err
+	}
+	return c, nil
+{{end}}}
+
+// New{{.Type}}Client creates a new {{.Type}}Client instance.
+func New{{.Type}}Client(client {{.RPCType}}{{if .ClientOptions}}, opts ...{{.Type}}ClientOption{{end}}) *{{.Type}}Client {
+	return {{if .ClientOptions}}_{{.Type}}Keepalive({{end}}&{{.Type}}Client{client{{if .WireDump}}, &_{{.Type}}WireDump{}{{end}}{{if .ClientOptions}}, _new{{.Type}}ClientOptions(opts){{end}}{{if .Handle}}, 0{{end}}}{{if .ClientOptions}}){{end}}
+}
+
+// New{{.Type}}ClientConn creates a new {{.Type}}Client instance using conn,
+// which can be any byte stream{{if .WireDump}}, and whose traffic SetWireDump can dump{{end}}.
+func New{{.Type}}ClientConn(conn io.ReadWriteCloser{{if .ClientOptions}}, opts ...{{.Type}}ClientOption{{end}}) *{{.Type}}Client {
+{{if .WireDump}}	dump := &_{{.Type}}WireDump{}
+	return {{if .ClientOptions}}_{{.Type}}Keepalive({{end}}&{{.Type}}Client{rpc.NewClient(&_{{.Type}}WireDumpConn{conn, dump}), dump{{if .ClientOptions}}, _new{{.Type}}ClientOptions(opts){{end}}{{if .Handle}}, 0{{end}}}{{if .ClientOptions}}){{end}}
+{{else}}	return {{if .ClientOptions}}_{{.Type}}Keepalive({{end}}&{{.Type}}Client{rpc.NewClient(conn){{if .ClientOptions}}, _new{{.Type}}ClientOptions(opts){{end}}{{if .Handle}}, 0{{end}}}{{if .ClientOptions}}){{end}}
+{{end}}}
+{{end}}
+
+{{define "client-ssh"}}
+// Dial{{.Type}}ClientSSH connects to addr through the SSH connection client
+// and creates a new {{.Type}}Client instance. The address is resolved by the
+// remote host, so that "localhost:1234" reaches a service only listening
+// there.
+func Dial{{.Type}}ClientSSH(client *ssh.Client, addr string{{if .ClientOptions}}, opts ...{{.Type}}ClientOption{{end}}) (*{{.Type}}Client, error) {
+	conn, err := client.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := New{{.Type}}ClientConn(conn{{if .ClientOptions}}, opts...{{end}})
+{{if .Handshake}}	if err := c.Handshake(); err != nil {
+		c.client.Close()
+		return nil, err
+	}
+{{end}}	return c, nil
+}
+{{end}}
+
+{{define "client-hmac"}}
+// Dial{{.Type}}ClientHMAC connects to addr and creates a new {{.Type}}Client
+// instance signing its requests with key, for a service served by
+// Serve{{.Type}}ConnHMAC with the same key.
+func Dial{{.Type}}ClientHMAC(addr string, key []byte{{if .ClientOptions}}, opts ...{{.Type}}ClientOption{{end}}) (*{{.Type}}Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := New{{.Type}}ClientConnHMAC(conn, key{{if .ClientOptions}}, opts...{{end}})
+{{if .Handshake}}	if err := c.Handshake(); err != nil {
+		c.client.Close()
+		return nil, err
+	}
+{{end}}	return c, nil
+}
+
+// New{{.Type}}ClientConnHMAC creates a new {{.Type}}Client instance using
+// conn, which can be any byte stream, and signing its requests with key.
+func New{{.Type}}ClientConnHMAC(conn io.ReadWriteCloser, key []byte{{if .ClientOptions}}, opts ...{{.Type}}ClientOption{{end}}) *{{.Type}}Client {
+{{if .WireDump}}	dump := &_{{.Type}}WireDump{}
+	conn = &_{{.Type}}WireDumpConn{conn, dump}
+{{end}}	buf := bufio.NewWriter(conn)
+	codec := &_{{.Type}}HMACClientCodec{conn: conn, buf: buf, dec: gob.NewDecoder(conn), enc: gob.NewEncoder(buf), key: key, requests: map[uint64][]byte{}}
+	return {{if .ClientOptions}}_{{.Type}}Keepalive({{end}}&{{.Type}}Client{rpc.NewClientWithCodec(codec){{if .WireDump}}, dump{{end}}{{if .ClientOptions}}, _new{{.Type}}ClientOptions(opts){{end}}{{if .Handle}}, 0{{end}}}{{if .ClientOptions}}){{end}}
+}
+
+// _{{.Type}}HMACClientCodec is the gob codec of net/rpc, signing requests and
+// verifying the signature of responses.
+type _{{.Type}}HMACClientCodec struct {
+	conn io.ReadWriteCloser
+	buf  *bufio.Writer
+	dec  *gob.Decoder
+	enc  *gob.Encoder
+	key  []byte
+	body []byte
+	mu   sync.Mutex
+	// requests are the nonces of the requests sent and not answered yet, by
+	// sequence number.
+	requests map[uint64][]byte
+}
+
+func (c *_{{.Type}}HMACClientCodec) WriteRequest(r *rpc.Request, body interface{}) error {
+	// The body is encoded on its own, so that the service can check the
+	// signature of its bytes before decoding it.
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(body); err != nil {
+		return err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	t := time.Now().UnixNano()
+	c.mu.Lock()
+	c.requests[r.Seq] = nonce
+	c.mu.Unlock()
+	if err := c.enc.Encode(r); err != nil {
+		return err
+	}
+	if err := c.enc.Encode(&{{.Type}}SignedRequest{b.Bytes(), t, nonce, {{.Type}}RequestMAC(c.key, r.ServiceMethod, b.Bytes(), t, nonce)}); err != nil {
+		return err
+	}
+	return c.buf.Flush()
+}
+
+// ReadResponseHeader reads the header of a response along with its body, so
+// that a response whose signature is invalid fails the connection before
+// anything of it, not even its error, is trusted.
+func (c *_{{.Type}}HMACClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	if err := c.dec.Decode(r); err != nil {
+		return err
+	}
+	var signed {{.Type}}SignedResponse
+	if err := c.dec.Decode(&signed); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	nonce, ok := c.requests[r.Seq]
+	delete(c.requests, r.Seq)
+	c.mu.Unlock()
+	if !ok || !hmac.Equal(signed.MAC, {{.Type}}ResponseMAC(c.key, r.ServiceMethod, r.Seq, r.Error, signed.Body, nonce)) {
+		return errors.New("rpc: invalid response signature")
+	}
+	c.body = signed.Body
+	return nil
+}
+
+func (c *_{{.Type}}HMACClientCodec) ReadResponseBody(body interface{}) error {
+	if body == nil {
+		return nil
+	}
+	return gob.NewDecoder(bytes.NewReader(c.body)).Decode(body)
+}
+
+func (c *_{{.Type}}HMACClientCodec) Close() error {
+	return c.conn.Close()
+}
+{{end}}
+
+{{define "client-nacl"}}
+// Dial{{.Type}}ClientNaCl connects to addr and creates a new {{.Type}}Client
+// instance encrypting its traffic, for a service served by
+// Serve{{.Type}}ConnNaCl with the same key.
+func Dial{{.Type}}ClientNaCl(addr string, key []byte{{if .ClientOptions}}, opts ...{{.Type}}ClientOption{{end}}) (*{{.Type}}Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, err := New{{.Type}}ClientConnNaCl(conn, key{{if .ClientOptions}}, opts...{{end}})
+	if err != nil {
+		return nil, err
+	}
+{{if .Handshake}}	if err := c.Handshake(); err != nil {
+		c.client.Close()
+		return nil, err
+	}
+{{end}}	return c, nil
+}
+
+// New{{.Type}}ClientConnNaCl creates a new {{.Type}}Client instance using
+// conn, which can be any byte stream, encrypting its traffic. It fails if the
+// key exchange does.
+func New{{.Type}}ClientConnNaCl(conn io.ReadWriteCloser, key []byte{{if .ClientOptions}}, opts ...{{.Type}}ClientOption{{end}}) (*{{.Type}}Client, error) {
+	encrypted, err := _new{{.Type}}NaClConn(conn, key, true)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return New{{.Type}}ClientConn(encrypted{{if .ClientOptions}}, opts...{{end}}), nil
+}
+{{end}}
+
+{{define "client-transport"}}
+// Dial{{.Type}}ClientTransport opens a connection on transport and creates a
+// new {{.Type}}Client instance using it.
+func Dial{{.Type}}ClientTransport(transport {{.Type}}Transport{{if .ClientOptions}}, opts ...{{.Type}}ClientOption{{end}}) (*{{.Type}}Client, error) {
+	conn, err := transport.Dial()
+	if err != nil {
+		return nil, err
+	}
+{{if .Handshake}}	c := New{{.Type}}ClientConn(&_{{.Type}}FrameConn{conn: conn}{{if .ClientOptions}}, opts...{{end}})
+	if err := c.Handshake(); err != nil {
+		c.client.Close()
+		return nil, err
+	}
+	return c, nil
+{{else}}	return New{{.Type}}ClientConn(&_{{.Type}}FrameConn{conn: conn}{{if .ClientOptions}}, opts...{{end}}), nil
+{{end}}}
+{{end}}
+
+{{define "client-wire-dump"}}
+// SetWireDump makes the client write the duration and outcome of each call
+// to w, along with a hex dump of the bytes sent and received if it was
+// created by Dial{{.Type}}Client or New{{.Type}}ClientConn.{{if .HasSecrets}} While calls of
+// methods with secrets are in progress, only the number of bytes is dumped.{{end}}
+// A nil w stops it.
+func (_c *{{.Type}}Client) SetWireDump(w io.Writer) {
+	_c.dump.mu.Lock()
+	defer _c.dump.mu.Unlock()
+	_c.dump.w = w
+}
+
+// _{{.Type}}WireDump is where a {{.Type}}Client dumps its traffic, if anywhere.
+type _{{.Type}}WireDump struct {
+	mu sync.Mutex
+	w  io.Writer{{if .HasSecrets}}
+	// secrets is the number of calls of methods with secrets in progress.
+	secrets int{{end}}
+}
+
+func (d *_{{.Type}}WireDump) printf(format string, args ...interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.w != nil {
+		fmt.Fprintf(d.w, format, args...)
+	}
+}
+
+// call dumps a call of method that started at start and returned err.
+func (d *_{{.Type}}WireDump) call(method string, start time.Time, err error) {
+	d.printf("%s %s took %s: %v\n", start.Format(time.RFC3339Nano), method, time.Since(start), err)
+}
+
+// bytes dumps b, which was sent or received as verb tells{{if .HasSecrets}}, or only its
+// length while calls of methods with secrets are in progress{{end}}.
+func (d *_{{.Type}}WireDump) bytes(verb string, b []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.w == nil {
+		return
+	}{{if .HasSecrets}}
+	if d.secrets > 0 {
+		fmt.Fprintf(d.w, "%s %s %d bytes, hidden as they may carry secrets\n", time.Now().Format(time.RFC3339Nano), verb, len(b))
+		return
+	}{{end}}
+	fmt.Fprintf(d.w, "%s %s %d bytes\n%s", time.Now().Format(time.RFC3339Nano), verb, len(b), hex.Dump(b))
+}{{if .HasSecrets}}
+
+// secret hides the bytes sent and received until the call of a method with
+// secrets it is called for returns, and the function it returns is called.
+func (d *_{{.Type}}WireDump) secret() func() {
+	d.mu.Lock()
+	d.secrets++
+	d.mu.Unlock()
+	return func() {
+		d.mu.Lock()
+		d.secrets--
+		d.mu.Unlock()
+	}
+}{{end}}
+
+// _{{.Type}}WireDumpConn dumps the bytes read and written on a connection.
+type _{{.Type}}WireDumpConn struct {
+	io.ReadWriteCloser
+	dump *_{{.Type}}WireDump
+}
+
+func (c *_{{.Type}}WireDumpConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	if n > 0 {
+		c.dump.bytes("received", p[:n])
+	}
+	return n, err
+}
+
+func (c *_{{.Type}}WireDumpConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	if n > 0 {
+		c.dump.bytes("sent", p[:n])
+	}
+	return n, err
+}
+{{end}}
+
+{{define "client-methods"}}{{$type := .Type}}{{if not (.HasMethod .ClientClose)}}
+// {{.ClientClose}} terminates the connection.
+func (_c *{{$type}}Client) {{.ClientClose}}() error {
+{{if .ClientOptions}}	atomic.StoreInt32(_c.options.state, _{{$type}}ConnClosed)
+{{end}}	return _c.client.Close()
+}
+{{end}}{{if .HasDedup}}
+// _{{$type}}IdempotencyKey returns a random idempotency key for a call of a
+// method with the //rpcgen:dedup directive, which its retries share.
+func _{{$type}}IdempotencyKey() string {
+	var key [16]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(key[:])
+}
+{{end}}{{range .Methods}}{{if and $.Pool (not .Notify)}}
+var (
+	_{{$type}}{{.Name}}RequestPool  = sync.Pool{New: func() interface{} { return new({{$type}}{{.Name}}Request) }}
+	_{{$type}}{{.Name}}ResponsePool = sync.Pool{New: func() interface{} { return new({{$type}}{{.Name}}Response) }}
+)
+{{end}}
+// {{.Name}} is part of implementation of {{$type}} calling corresponding method on RPC server.{{if eq .Name $.ClientClose}}
+// It then terminates the connection.{{end}}{{if .Notify}}
+// It doesn't wait for the server to handle the notification, and only
+// returns errors known when sending it.{{end}}{{if .Deprecated}}
+//
+// Deprecated: {{.Deprecated}}{{end}}
+func (_c *{{$type}}Client) {{.Name}}({{.Parameters | functionargs}}) ({{.Results | functionargs}}{{if .Results}}, {{end}}err error) {
+{{if $.WireDump}}	defer func(start time.Time) { _c.dump.call("{{$.Service}}.{{.Name}}", start, err) }(time.Now())
+{{if .Secret}}	defer _c.dump.secret()()
+{{end}}{{end}}{{if and $.Pool (not .Notify)}}	_request := _{{$type}}{{.Name}}RequestPool.Get().(*{{$type}}{{.Name}}Request)
+	*_request = {{$type}}{{.Name}}Request{{"{"}}{{.Parameters | wirerefs}}{{if $.Handle}}{{if .Parameters}}, {{end}}_c.handle{{end}}{{if .Dedup}}{{if or .Parameters $.Handle}}, {{end}}_{{$type}}IdempotencyKey(){{end}}{{"}"}}
+	_response := _{{$type}}{{.Name}}ResponsePool.Get().(*{{$type}}{{.Name}}Response)
+	defer func() {
+		*_request, *_response = {{$type}}{{.Name}}Request{}, {{$type}}{{.Name}}Response{}
+		_{{$type}}{{.Name}}RequestPool.Put(_request)
+		_{{$type}}{{.Name}}ResponsePool.Put(_response)
+	}()
+{{else}}	_request := &{{$type}}{{.Name}}Request{{"{"}}{{.Parameters | wirerefs}}{{if $.Handle}}{{if .Parameters}}, {{end}}_c.handle{{end}}{{if .Dedup}}{{if or .Parameters $.Handle}}, {{end}}_{{$type}}IdempotencyKey(){{end}}{{"}"}}
+	_response := &{{$type}}{{.Name}}Response{}
+{{end}}{{if .Notify}}	_call := _c.client.Go({{if $.Handle}}_c._method("{{.Name}}"){{else}}"{{$.Service}}.{{.Name}}"{{end}}, _request, _response, nil)
+	select {
+	case <-_call.Done:
+		err = _call.Error
+	default:
+	}{{else if $.ClientOptions}}	err = _c.options.call("{{.Name}}", _request, func() (store func(), err error) {
+		_attempt := &{{$type}}{{.Name}}Response{}
+		err = _c.client.Call({{if $.Handle}}_c._method("{{.Name}}"){{else}}"{{$.Service}}.{{.Name}}"{{end}}, _request, _attempt)
+		return func() { *_response = *_attempt }, err
+	}){{else}}	err = _c.client.Call({{if $.Handle}}_c._method("{{.Name}}"){{else}}"{{$.Service}}.{{.Name}}"{{end}}, _request, _response){{end}}{{if eq .Name $.ClientClose}}{{if $.ClientOptions}}
+	atomic.StoreInt32(_c.options.state, _{{$type}}ConnClosed){{end}}
+	if closeErr := _c.client.Close(); err == nil {
+		err = closeErr
+	}{{end}}
+{{if .HasConversions}}	{{wirereturn $.Service .}}{{else}}	return {{.Results | publicrefswithprefix "_response."}}{{if .Results}}, {{end}}err{{end}}
+}
+{{end}}{{end}}
+
+{{define "client-handles"}}
+// _new{{.Type}}ClientHandle creates a new {{.Type}}Client instance calling
+// the object of handle through client.
+func _new{{.Type}}ClientHandle(client {{.RPCType}}, handle uint64) *{{.Type}}Client {
+	c := New{{.Type}}Client(client)
+	c.handle = handle
+	return c
+}
+
+// _method returns the name to call method with, through the handle service
+// if the client calls the object of a handle.
+func (_c *{{.Type}}Client) _method(method string) string {
+	if _c.handle != 0 {
+		return {{.Type}}HandleServiceName + "." + method
+	}
+	return {{.Type}}ServiceName + "." + method
+}
+
+// Release makes the server forget the object the client calls, which can't
+// be called afterwards. Unlike {{.ClientClose}}, it leaves the connection open.
+func (_c *{{.Type}}Client) Release() error {
+	return _c.client.Call({{.Type}}HandleServiceName+".ReleaseHandle", &{{.Type}}ReleaseHandleRequest{Handle: _c.handle}, &struct{}{})
+}
+{{end}}
+
+{{define "client-options"}}
+// {{.Type}}ClientOption configures a {{.Type}}Client.
+type {{.Type}}ClientOption func(*_{{.Type}}ClientOptions)
+
+// {{.Type}}ClientInterceptor wraps the calls of {{.Type}}Client methods other
+// than notifications. It is given the name of the method, without the service
+// name, and its request, and calls handler to go on with the call, retries
+// included.
+type {{.Type}}ClientInterceptor func(method string, request interface{}, handler func() error) error
+
+// {{.Type}}RetryPolicy tells whether to retry a call of method whose attempt
+// number attempt, starting at 1, failed with err, and how long to wait first.
+// Errors returned by the service are rpc.ServerError values, and attempts
+// that timed out fail with an error wrapping os.ErrDeadlineExceeded.
+type {{.Type}}RetryPolicy func(method string, attempt int, err error) (delay time.Duration, retry bool)
+
+// With{{.Type}}ClientInterceptor makes the client make its calls through
+// interceptor. Interceptors are called in the order they are given.
+func With{{.Type}}ClientInterceptor(interceptor {{.Type}}ClientInterceptor) {{.Type}}ClientOption {
+	return func(o *_{{.Type}}ClientOptions) { o.interceptors = append(o.interceptors, interceptor) }
+}
+
+// With{{.Type}}ClientTimeout makes each attempt of a call fail once it has
+// waited for d. The late response is dropped when it arrives.{{if .HasTimeouts}}
+// Methods with a default deadline time out after it instead.{{end}}
+func With{{.Type}}ClientTimeout(d time.Duration) {{.Type}}ClientOption {
+	return func(o *_{{.Type}}ClientOptions) { o.timeout = d }
+}
+
+// With{{.Type}}RetryPolicy makes the client retry the calls that fail as
+// policy tells.
+func With{{.Type}}RetryPolicy(policy {{.Type}}RetryPolicy) {{.Type}}ClientOption {
+	return func(o *_{{.Type}}ClientOptions) { o.retry = policy }
+}
+
+// Err{{.Type}}TooManyCalls is the error of the attempts failing fast as the
+// client has as many calls in flight as With{{.Type}}MaxInFlight allows.
+var Err{{.Type}}TooManyCalls = errors.New("{{.Service}}: too many calls in flight")
+
+// With{{.Type}}MaxInFlight limits the number of calls, other than
+// notifications, the client has in flight at once to n, if positive. Beyond
+// it, attempts wait for a call to finish if wait is true, and otherwise fail
+// with Err{{.Type}}TooManyCalls. Attempts that timed out count until the
+// response arrives.
+func With{{.Type}}MaxInFlight(n int, wait bool) {{.Type}}ClientOption {
+	return func(o *_{{.Type}}ClientOptions) {
+		o.slots, o.wait = nil, wait
+		if n > 0 {
+			o.slots = make(chan struct{}, n)
+		}
+	}
+}
+
+// Err{{.Type}}ConnectionLost is the error of the calls failing as the
+// connection failed, or was closed as a keepalive ping got no response, rather
+// than closed with {{.ClientClose}}. It wraps the error of net/rpc.
+var Err{{.Type}}ConnectionLost = errors.New("{{.Service}}: connection lost")
+
+// With{{.Type}}Keepalive makes the client ping the service every interval
+// and close the connection once a ping gets no response within timeout, or
+// interval if timeout is 0, so that connections dropped on the way, as by
+// NAT, fail with Err{{.Type}}ConnectionLost rather than hang. Pings call a
+// method no service has, which net/rpc answers with an error without calling
+// the implementation, and keep the connection from being idle.
+func With{{.Type}}Keepalive(interval, timeout time.Duration) {{.Type}}ClientOption {
+	return func(o *_{{.Type}}ClientOptions) { o.keepalive, o.keepaliveTimeout = interval, timeout }
+}
+
+// _{{.Type}}ClientOptions are the options of a {{.Type}}Client.
+type _{{.Type}}ClientOptions struct {
+	interceptors []{{.Type}}ClientInterceptor
+	timeout      time.Duration
+	retry        {{.Type}}RetryPolicy
+	slots        chan struct{}
+	wait         bool
+	keepalive    time.Duration
+	// keepaliveTimeout is the time pings wait for their response.
+	keepaliveTimeout time.Duration
+	// state tells the calls failing as the connection was closed with
+	// {{.ClientClose}} apart from those failing as it was lost.
+	state *int32{{if .HasTimeouts}}
+	// fixed makes timeout apply to all methods, as set by WithTimeout.
+	fixed bool{{end}}
+}
+
+func _new{{.Type}}ClientOptions(opts []{{.Type}}ClientOption) _{{.Type}}ClientOptions {
+	o := _{{.Type}}ClientOptions{state: new(int32)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// call calls method through the interceptors, making attempts until one
+// succeeds or the retry policy gives up. attempt calls the service with a
+// response of its own and returns a function storing it as the response of
+// the call, which is only called if the attempt didn't time out.
+func (o *_{{.Type}}ClientOptions) call(method string, request interface{}, attempt func() (store func(), err error)) error {
+	handler := func() error {
+		for n := 1; ; n++ {
+			err := o.connErr(o.attempt(method, attempt))
+			if err == nil || o.retry == nil {
+				return err
+			}
+			delay, retry := o.retry(method, n, err)
+			if !retry {
+				return err
+			}
+			time.Sleep(delay)
+		}
+	}
+	for i := len(o.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := o.interceptors[i], handler
+		handler = func() error { return interceptor(method, request, next) }
+	}
+	return handler()
+}
+
+// The states of the connection of a client.
+const (
+	_{{.Type}}ConnOpen int32 = iota
+	_{{.Type}}ConnClosed
+	_{{.Type}}ConnLost
+)
+
+// connErr returns err, wrapped in Err{{.Type}}ConnectionLost if the
+// connection was lost, or failed other than by {{.ClientClose}}.
+func (o *_{{.Type}}ClientOptions) connErr(err error) error {
+	if _, ok := err.(rpc.ServerError); ok || err == nil {
+		return err
+	}
+	switch atomic.LoadInt32(o.state) {
+	case _{{.Type}}ConnLost:
+	case _{{.Type}}ConnOpen:
+		if err != rpc.ErrShutdown && err != io.EOF && err != io.ErrUnexpectedEOF && !errors.As(err, new(*net.OpError)) {
+			return err
+		}
+	default:
+		return err
+	}
+	return fmt.Errorf("%w: %v", Err{{.Type}}ConnectionLost, err)
+}
+
+// attempt makes an attempt of a call of method within the in-flight limit
+// and the timeout.
+func (o *_{{.Type}}ClientOptions) attempt(method string, attempt func() (store func(), err error)) error {
+	if o.slots != nil {
+		if o.wait {
+			o.slots <- struct{}{}
+		} else {
+			select {
+			case o.slots <- struct{}{}:
+			default:
+				return Err{{.Type}}TooManyCalls
+			}
+		}
+		call := attempt
+		attempt = func() (func(), error) {
+			defer func() { <-o.slots }()
+			return call()
+		}
+	}
+	timeout := o.timeout{{if .HasTimeouts}}
+	if d, ok := {{.Type}}MethodTimeouts[method]; ok && !o.fixed {
+		timeout = d
+	}{{end}}
+	if timeout <= 0 {
+		store, err := attempt()
+		store()
+		return err
+	}
+	type outcome struct {
+		store func()
+		err   error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		store, err := attempt()
+		done <- outcome{store, err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case out := <-done:
+		out.store()
+		return out.err
+	case <-timer.C:
+		return fmt.Errorf("{{.Service}}.%s timed out after %s: %w", method, timeout, os.ErrDeadlineExceeded)
+	}
+}{{if and .HasTimeouts (not (.HasMethod "WithTimeout"))}}
+
+// WithTimeout returns a client making calls on the same connection, whose
+// attempts all time out after d, or never if d is 0, regardless of the
+// default deadlines of the methods. It overrides them for some calls, as in
+// client.WithTimeout(time.Minute).Method(...).
+func (_c *{{.Type}}Client) WithTimeout(d time.Duration) *{{.Type}}Client {
+	c := *_c
+	c.options.timeout, c.options.fixed = d, true
+	return &c
+}{{end}}
+
+// _{{.Type}}Keepalive starts pinging the service on behalf of c, if it has a
+// keepalive interval and a connection, and returns c.
+func _{{.Type}}Keepalive(c *{{.Type}}Client) *{{.Type}}Client {
+	if c.options.keepalive > 0 && c.client != nil {
+		go c._keepalive()
+	}
+	return c
+}
+
+// _keepalive pings the service every keepalive interval until the client is
+// closed, and closes the connection, as lost, once a ping fails or gets no
+// response in time. Any response from the service, even an error, will do.
+func (_c *{{.Type}}Client) _keepalive() {
+	o := &_c.options
+	timeout := o.keepaliveTimeout
+	if timeout <= 0 {
+		timeout = o.keepalive
+	}
+	ticker := time.NewTicker(o.keepalive)
+	defer ticker.Stop()
+	for range ticker.C {
+		call := _c.client.Go("{{.Service}}._ping", true, new(bool), make(chan *rpc.Call, 1))
+		timer := time.NewTimer(timeout)
+		var err error
+		select {
+		case <-call.Done:
+			err = call.Error
+		case <-timer.C:
+			err = os.ErrDeadlineExceeded
+		}
+		timer.Stop()
+		if _, ok := err.(rpc.ServerError); ok || err == nil {
+			continue
+		}
+		if atomic.CompareAndSwapInt32(o.state, _{{.Type}}ConnOpen, _{{.Type}}ConnLost) {
+			_c.client.Close()
+		}
+		return
+	}
+}
+{{end}}
+
+{{define "client-handshake"}}
+// Handshake checks that the service was generated from the same interface
+// as the client, which makes calls fail clearly instead of with decoding
+// errors.
+func (_c *{{.Type}}Client) Handshake() error {
+	var fingerprint string
+	if err := _c.client.Call("{{.Service}}.Handshake", {{.Type}}Fingerprint, &fingerprint); err != nil {
+		return fmt.Errorf("{{.Service}} handshake failed: %v", err)
+	}
+	return nil
+}
+{{end}}
+
+{{define "client-jobs"}}{{$type := .Type}}{{range .Methods}}{{if .Job}}
+// Start{{.Name}} starts {{.Name}} as a job on the RPC server and returns it at once.
+func (_c *{{$type}}Client) Start{{.Name}}({{.Parameters | functionargs}}) (_job {{$type}}Job, err error) {
+	err = _c.client.Call("{{$.Service}}.Start{{.Name}}", &{{$type}}{{.Name}}Request{{"{"}}{{.Parameters | wirerefs}}{{"}"}}, &_job)
+	return _job, err
+}
+
+// {{.Name}}Status returns the state of a job started by Start{{.Name}}.
+func (_c *{{$type}}Client) {{.Name}}Status(_job {{$type}}Job) (status {{$type}}JobStatus, err error) {
+	err = _c.client.Call("{{$.Service}}.{{.Name}}Status", &_job, &status)
+	return status, err
+}
+
+// {{.Name}}Result returns the outcome of a finished job started by
+// Start{{.Name}}, which the server then forgets.
+func (_c *{{$type}}Client) {{.Name}}Result(_job {{$type}}Job) ({{.Results | functionargs}}{{if .Results}}, {{end}}err error) {
+	_response := &{{$type}}{{.Name}}Response{}
+	err = _c.client.Call("{{$.Service}}.{{.Name}}Result", &_job, _response)
+	{{if .HasConversions}}{{wirereturn $.Service .}}{{else}}return {{.Results | publicrefswithprefix "_response."}}{{if .Results}}, {{end}}err{{end}}
+}
+
+// Cancel{{.Name}} makes the server forget a job started by Start{{.Name}},
+// and returns its state.
+func (_c *{{$type}}Client) Cancel{{.Name}}(_job {{$type}}Job) (status {{$type}}JobStatus, err error) {
+	err = _c.client.Call("{{$.Service}}.Cancel{{.Name}}", &_job, &status)
+	return status, err
+}
+{{end}}{{end}}{{end}}
+`
+
+// templateFuncs are the functions available to templates: the repeatable
+// functions of the sprig library (https://masterminds.github.io/sprig/) and
+// go-rpcgen's own helpers, which take precedence. Sprig functions depending on
+// the time, randomness or the environment are left out so that the same input
+// always generates the same output.
+var templateFuncs = map[string]interface{}{}
+
+func init() {
+	for name, fn := range sprig.HermeticTxtFuncMap() {
+		templateFuncs[name] = fn
+	}
+	for name, fn := range map[string]interface{}{
+		"publicfields":         func(fields []*Type) string { return FieldList(fields, "", "\n\t", true, true) },
+		"refswithprefix":       func(prefix string, fields []*Type) string { return FieldList(fields, prefix, ", ", false, false) },
+		"publicrefswithprefix": func(prefix string, fields []*Type) string { return FieldList(fields, prefix, ", ", false, true) },
+		"functionargs":         func(fields []*Type) string { return FieldList(fields, "", ", ", true, false) },
+		"binarycodec":          binaryCodec,
+		"marshalbinary":        marshalBinary,
+		"unmarshalbinary":      unmarshalBinary,
+		"stringer":             stringer,
+		"structfields":         structFields,
+		"wireparams":           wireParams,
+		"wireresults":          wireResults,
+		"wirerefs":             wireRefs,
+		"wirecall":             wireCall,
+		"wirereturn":           wireReturn,
+		"limitchecks":          limitChecks,
+		"defaultfills":         defaultFills,
+		"enumchecks":           enumChecks,
+		"camel":                camel,
+		"pascal":               pascal,
+		"snake":                snake,
+		"pluralize":            pluralize,
+		"goduration":           goDuration,
+		"isPointer":            func(t *Type) bool { _, ok := t.expr.(*ast.StarExpr); return ok },
+		"isSlice":              func(t *Type) bool { a, ok := t.expr.(*ast.ArrayType); return ok && a.Len == nil },
+		"isArray":              func(t *Type) bool { a, ok := t.expr.(*ast.ArrayType); return ok && a.Len != nil },
+		"isMap":                func(t *Type) bool { _, ok := t.expr.(*ast.MapType); return ok },
+		"isQualified":          func(t *Type) bool { _, ok := t.expr.(*ast.SelectorExpr); return ok },
+		"isBuiltin":            func(t *Type) bool { id, ok := t.expr.(*ast.Ident); return ok && predeclared[id.Name] },
+	} {
+		templateFuncs[name] = fn
+	}
+}
+
+// stringer returns the statement returning the fields of the request or
+// response structure name, with receiver r, as in A{X: 1, S: "s"}. Strings
+// are quoted, and the fields m redacts print as [REDACTED].
+func stringer(name string, m *Method, fields []*Type) string {
+	var format, args []string
+	for _, t := range fields {
+		for _, field := range t.Names {
+			switch {
+			case m.Redacts(field):
+				format = append(format, field+": [REDACTED]")
+			case t.Type == "string":
+				format = append(format, field+": %q")
+				args = append(args, "r."+field)
+			default:
+				format = append(format, field+": %v")
+				args = append(args, "r."+field)
+			}
+		}
+	}
+	s := strconv.Quote(name + "{" + strings.Join(format, ", ") + "}")
+	if len(args) == 0 {
+		return "return " + s
+	}
+	return fmt.Sprintf("return fmt.Sprintf(%s, %s)", s, strings.Join(args, ", "))
+}
+
+// jsonName returns the name the json tag of the field name gives it with the
+// naming strategy naming.
+func jsonName(naming, name string) string {
+	switch naming {
+	case JSONNamingSnake:
+		return snake(name)
+	case JSONNamingCamel:
+		return camel(name)
+	}
+	return name
+}
+
+// wireParams formats parameters as those of the service method calling the
+// implementation of a method with conversions, named by position and typed
+// as sent.
+func wireParams(params []*Type) string {
+	var out []string
+	for _, t := range params {
+		for range t.Names {
+			out = append(out, fmt.Sprintf("_p%d %s", len(out), t.WireType()))
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+// wireResults formats results as those of the service method calling the
+// implementation of a method with conversions, named by position and typed
+// as sent.
+func wireResults(results []*Type) string {
+	var out []string
+	for _, t := range results {
+		for range t.Names {
+			out = append(out, fmt.Sprintf("_%d %s", len(out), t.WireType()))
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+// wireRefs returns the parameters of a client method as the values of the
+// request fields.
+func wireRefs(params []*Type) string {
+	var out []string
+	for _, t := range params {
+		for _, name := range t.LowerNames {
+			out = append(out, toWire(t, name))
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+// wireCall returns the body of the service method calling the implementation
+// of method m of service, whose parameters and results are sent as other
+// types, and converting the results if it succeeds. Objects served through
+// handles are added to their handle tables, and the call fails for values
+// of mapped types that don't decode.
+func wireCall(service string, m *Method) string {
+	var args, decls, targets, converts []string
+	for _, t := range m.Parameters {
+		for _, name := range t.LowerNames {
+			p := fmt.Sprintf("_p%d", len(args))
+			if t.Mapping == nil {
+				args = append(args, fromWire(t, p))
+				continue
+			}
+			a := fmt.Sprintf("_a%d", len(args))
+			decls = append(decls, fmt.Sprintf("%s, err := %s(%s)\n\tif err != nil {\n\t\terr = fmt.Errorf(%q, err)\n\t\treturn\n\t}\n\t",
+				a, t.Mapping.Decode, p, fmt.Sprintf("%s.%s: invalid %s: %%w", service, m.Name, name)))
+			args = append(args, a)
+		}
+	}
+	for _, t := range m.Results {
+		for range t.Names {
+			name := fmt.Sprintf("_%d", len(targets))
+			switch {
+			case t.Handle != "":
+				decls = append(decls, fmt.Sprintf("var _h%s %s\n\t", name, t.Type))
+				targets = append(targets, "_h"+name)
+				converts = append(converts, fmt.Sprintf("\t%s = _%sHandles(_conn).add(_h%s)\n\t", name, t.Handle, name))
+			case t.Unix != "" || t.Mapping != nil:
+				decls = append(decls, fmt.Sprintf("var _t%s %s\n\t", name, t.Type))
+				targets = append(targets, "_t"+name)
+				converts = append(converts, fmt.Sprintf("\t%s = %s\n\t", name, toWire(t, "_t"+name)))
+			default:
+				targets = append(targets, name)
+			}
+		}
+	}
+	call := fmt.Sprintf("%s%s = s.impl.%s(%s)\n\t", strings.Join(decls, ""), strings.Join(append(targets, "err"), ", "), m.Name, strings.Join(args, ", "))
+	if len(converts) == 0 {
+		return call + "return"
+	}
+	return fmt.Sprintf("%sif err == nil {\n\t%s}\n\treturn", call, strings.Join(converts, ""))
+}
+
+// wireReturn returns the statements returning the results of a client method
+// of method m of service, whose results are sent as other types, converted:
+// objects served through handles as clients of the objects, or nil for
+// handles of nil objects, Unix times as time.Time values, and values of
+// mapped types decoded, failing if they don't.
+func wireReturn(service string, m *Method) string {
+	var out, values []string
+	for _, t := range m.Results {
+		for i, name := range t.Names {
+			switch {
+			case t.Handle != "":
+				out = append(out, fmt.Sprintf("if _response.%s != 0 {\n\t\t%s = _new%sClientHandle(_c.client, _response.%s)\n\t}\n\t", name, t.LowerNames[i], t.Handle, name))
+			case t.Mapping != nil:
+				out = append(out, fmt.Sprintf("if err == nil {\n\t\tif %s, err = %s(_response.%s); err != nil {\n\t\t\terr = fmt.Errorf(%q, err)\n\t\t}\n\t}\n\t",
+					t.LowerNames[i], t.Mapping.Decode, name, fmt.Sprintf("%s.%s: invalid %s: %%w", service, m.Name, t.LowerNames[i])))
+			default:
+				values = append(values, fromWire(t, "_response."+name))
+				continue
+			}
+			values = append(values, t.LowerNames[i])
+		}
+	}
+	return strings.Join(out, "") + "return " + strings.Join(append(values, "err"), ", ")
+}
+
+// structFields formats fields as struct fields, with json tags naming them
+// with the naming strategy naming, with the omitempty option for those listed
+// in omitEmpty, and validate tags with their rules in validations. Without
+// tags, it is the same as publicfields.
+func structFields(naming string, validations map[string]string, omitEmpty []string, fields []*Type) string {
+	if (naming == "" || naming == JSONNamingAsIs) && len(validations) == 0 && len(omitEmpty) == 0 {
+		return FieldList(fields, "", "\n\t", true, true)
+	}
+	var out []string
+	for _, t := range fields {
+		for _, name := range t.Names {
+			var tags []string
+			omit := false
+			for _, field := range omitEmpty {
+				omit = omit || field == name
+			}
+			switch {
+			case omit:
+				tags = append(tags, fmt.Sprintf("json:%q", jsonName(naming, name)+",omitempty"))
+			case naming != "" && naming != JSONNamingAsIs:
+				tags = append(tags, fmt.Sprintf("json:%q", jsonName(naming, name)))
+			}
+			if rules, ok := validations[name]; ok {
+				tags = append(tags, fmt.Sprintf("validate:%q", rules))
+			}
+			field := name + " " + t.WireType()
+			if len(tags) > 0 {
+				field += " `" + strings.Join(tags, " ") + "`"
+			}
+			out = append(out, field)
+		}
+	}
+	return strings.Join(out, "\n\t")
+}
+
+// words splits an identifier into words at underscores, dashes, spaces and
+// case changes, keeping acronyms together: "HTTPServer_id" becomes "HTTP",
+// "Server" and "id".
+func words(s string) []string {
+	var out []string
+	runes := []rune(s)
+	start := 0
+	for i, r := range runes {
+		if r == '_' || r == '-' || unicode.IsSpace(r) {
+			if start < i {
+				out = append(out, string(runes[start:i]))
+			}
+			start = i + 1
+			continue
+		}
+		if i > start && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				out = append(out, string(runes[start:i]))
+				start = i
+			}
+		}
+	}
+	if start < len(runes) {
+		out = append(out, string(runes[start:]))
+	}
+	return out
+}
+
+// pascal converts s to PascalCase.
+func pascal(s string) string {
+	var out []string
+	for _, w := range words(s) {
+		runes := []rune(strings.ToLower(w))
+		runes[0] = unicode.ToUpper(runes[0])
+		out = append(out, string(runes))
+	}
+	return strings.Join(out, "")
+}
+
+// camel converts s to camelCase.
+func camel(s string) string {
+	p := []rune(pascal(s))
+	if len(p) > 0 {
+		p[0] = unicode.ToLower(p[0])
+	}
+	return string(p)
+}
+
+// snake converts s to snake_case.
+func snake(s string) string {
+	return strings.ToLower(strings.Join(words(s), "_"))
+}
+
+// pluralize returns the English plural of the noun s.
+func pluralize(s string) string {
+	lower := strings.ToLower(s)
+	switch {
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return s + "es"
+	case len(lower) > 1 && strings.HasSuffix(lower, "y") && !strings.ContainsAny(lower[len(lower)-2:len(lower)-1], "aeiou"):
+		return s[:len(s)-1] + "ies"
+	}
+	return s + "s"
+}
+
+// loadTemplate returns the template to render stubs with: the built-in one
+// or the one named by the options, with any sections found in the template
+// directory replacing the sections of the same name.
+func loadTemplate(opts *Options) (*template.Template, error) {
+	text := rpcTemplate
+	if opts.Template != "" {
+		data, err := ioutil.ReadFile(opts.Template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template: %s", err)
+		}
+		text = string(data)
+	}
+	base, err := template.New("rpc").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, templateError(opts, err)
+	}
+	if opts.TemplateDir == "" {
+		return base, nil
+	}
+	overrides, err := templateOverrides(opts.TemplateDir)
+	if err != nil {
+		return nil, err
+	}
+	// Templates can't be redefined once parsed, so assemble a new set from
+	// the overrides and the remaining sections of the base template.
+	t := template.New("rpc").Funcs(templateFuncs)
+	for _, section := range base.Templates() {
+		name := section.Name()
+		if override, ok := overrides[name]; ok {
+			if _, err := t.New(name).Parse(override); err != nil {
+				return nil, templateError(opts, err)
+			}
+			delete(overrides, name)
+		} else if _, err := t.AddParseTree(name, section.Tree); err != nil {
+			return nil, err
+		}
+	}
+	if len(overrides) > 0 {
+		var unknown []string
+		for name := range overrides {
+			unknown = append(unknown, name)
+		}
+		sort.Strings(unknown)
+		var known []string
+		for _, section := range base.Templates() {
+			if section.Name() != "rpc" {
+				known = append(known, section.Name())
+			}
+		}
+		sort.Strings(known)
+		return nil, fileError(opts.TemplateDir, CodeTemplate, "unknown template sections %s, expected one of %s", strings.Join(unknown, ", "), strings.Join(known, ", "))
+	}
+	return t.Lookup("rpc"), nil
+}
+
+// templateErrorPattern matches the errors text/template returns, located as
+// "template: <name>:<line>:<column>: " with an optional column.
+var templateErrorPattern = regexp.MustCompile(`^template: ([^:]+):(\d+):(?:(\d+):)? (.*)$`)
+
+// templateError returns an error parsing or executing the template selected
+// by opts as a diagnostic located in the file defining the failing section.
+func templateError(opts *Options, err error) error {
+	m := templateErrorPattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return fileError(templateFile(opts, "rpc"), CodeTemplate, "%s", err)
+	}
+	file := templateFile(opts, m[1])
+	if file == "" {
+		// The built-in template has no file to point to.
+		return fileError("", CodeTemplate, "%s", err)
+	}
+	line, _ := strconv.Atoi(m[2])
+	column, _ := strconv.Atoi(m[3])
+	return posError(token.Position{Filename: file, Line: line, Column: column}, CodeTemplate, "%s", m[4])
+}
+
+// templateFile returns the file the template section name is read from, or
+// "" for the built-in template.
+func templateFile(opts *Options, name string) string {
+	if opts.TemplateDir != "" {
+		path := filepath.Join(opts.TemplateDir, name+".tmpl")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return opts.Template
+}
+
+// loadHeader reads the banner at path, if any, commenting lines that aren't
+// comments already.
+func loadHeader(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read header: %s", err)
+	}
+	text := strings.TrimRight(string(data), "\n")
+	if strings.HasPrefix(text, "//") || strings.HasPrefix(text, "/*") {
+		return text, nil
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("// "+line, " ")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// templateOverrides reads the <section>.tmpl files in dir.
+func templateOverrides(dir string) (map[string]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	overrides := map[string]string{}
+	for _, m := range matches {
+		data, err := ioutil.ReadFile(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template section: %s", err)
+		}
+		overrides[strings.TrimSuffix(filepath.Base(m), ".tmpl")] = string(data)
+	}
+	return overrides, nil
+}
+
+// goDuration returns a Go expression of the duration d, such as
+// "10 * time.Minute".
+func goDuration(d time.Duration) string {
+	for _, unit := range []struct {
+		d    time.Duration
+		name string
+	}{{time.Hour, "Hour"}, {time.Minute, "Minute"}, {time.Second, "Second"}, {time.Millisecond, "Millisecond"}, {time.Microsecond, "Microsecond"}} {
+		if d%unit.d == 0 {
+			return fmt.Sprintf("%d * time.%s", d/unit.d, unit.name)
+		}
+	}
+	return fmt.Sprintf("%d * time.Nanosecond", d)
+}
@@ -0,0 +1,23 @@
+package search
+
+// Order is the order of search results.
+//
+//rpcgen:enum
+type Order string
+
+// Orders results can be sorted in.
+const (
+	Relevance Order = "relevance"
+	Newest    Order = "newest"
+)
+
+// Search finds documents.
+type Search interface {
+	// Find returns the IDs of the documents matching query, at most limit of
+	// them, in order.
+	//rpcgen:maxlen query 256
+	//rpcgen:default limit 20
+	Find(query string, order Order, limit *int) (ids []string, err error)
+	// Count counts the documents matching query.
+	Count(query string) (n int, err error)
+}
@@ -0,0 +1,9 @@
+package counter
+
+// Counter counts things by name.
+type Counter interface {
+	// Add adds delta to the count of name and returns the new count.
+	Add(name string, delta int) (count int, err error)
+	// Get returns the count of name.
+	Get(name string) (count int, err error)
+}
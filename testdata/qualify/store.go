@@ -0,0 +1,27 @@
+package store
+
+import "time"
+
+// Page is a page of items, with the cursor of the next one.
+type Page[T any] struct {
+	Items []T
+	Next  string
+}
+
+// Pair is a key and its value.
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// Item is an item of the store.
+type Item struct {
+	Name string
+}
+
+// Store lists and looks up items.
+type Store interface {
+	List(cursor string) (page Page[Pair[string, Item]], err error)
+	Lookup(keys []Item, byName map[string]*Item) (found [4]Pair[Item, []byte], err error)
+	Touch(at time.Time, items []Page[*Item]) (err error)
+}
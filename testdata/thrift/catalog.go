@@ -0,0 +1,19 @@
+package catalog
+
+// Item is an item of the catalog.
+type Item struct {
+	Name  string
+	Price float64
+	//rpcgen:field 7
+	Tags  []string
+	Owner *string
+	note  string
+}
+
+// Catalog lists items.
+type Catalog interface {
+	// Find finds the items matching a query.
+	//rpcgen:field limit 2
+	Find(query string, limit int) (items []Item, next string, err error)
+	Get(name string) (item *Item, err error)
+}
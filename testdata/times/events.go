@@ -0,0 +1,16 @@
+package events
+
+import "time"
+
+// Events records events.
+type Events interface {
+	// Record records an event at a time, for a while.
+	Record(name string, at time.Time, lasts time.Duration) (id int64, err error)
+	// Window returns the bounds of the events.
+	//rpcgen:unix from
+	//rpcgen:unixmilli until
+	Window() (from, until time.Time, err error)
+	// Since counts the events since a time.
+	//rpcgen:unix since
+	Since(since time.Time, kind string) (n int, err error)
+}
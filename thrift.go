@@ -0,0 +1,409 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// thriftTypes are the Thrift types of the predeclared Go types that have one,
+// the smallest holding all their values. Unsigned integers that don't fit in
+// an i64 have none.
+var thriftTypes = map[string]string{
+	"bool":    "bool",
+	"string":  "string",
+	"int8":    "byte",
+	"int16":   "i16",
+	"uint8":   "i16",
+	"byte":    "i16",
+	"int32":   "i32",
+	"rune":    "i32",
+	"uint16":  "i32",
+	"int":     "i64",
+	"int64":   "i64",
+	"uint32":  "i64",
+	"float32": "double",
+	"float64": "double",
+}
+
+// maxThriftID is the largest ID of a Thrift field, which is an i16.
+const maxThriftID = math.MaxInt16
+
+// thriftIDL builds the Thrift definition of an interface declared in f.
+type thriftIDL struct {
+	fileset *token.FileSet
+	f       *ast.File
+	decls   map[string]*ast.TypeSpec
+	// structs are the definitions of the structs and enums used by the
+	// interface, each after those of the structs it uses.
+	structs []string
+	// defined are the names of the structs already defined.
+	defined map[string]bool
+	// resolving are the names of the other declared types being resolved,
+	// to detect recursive ones.
+	resolving map[string]bool
+	// enums are the enum types declared in f, by name.
+	enums map[string]*Enum
+	// mappings are the types sent as others, by package path and name.
+	mappings map[string]*TypeMapping
+}
+
+// thrift returns the Thrift definition of the interface: a service named
+// like it, whose methods take the parameters of the interface methods and
+// return their result, or a <Type><Method>Response struct when there are
+// several, and throw a <Type>Error exception for the error. Struct types
+// declared in the source file become structs, integer enums whose values fit
+// in an i32 become enums, and other types declared there are replaced with
+// their underlying type.
+func (r *RPCGen) thrift(f *ast.File) ([]byte, error) {
+	t := &thriftIDL{fileset: r.fileset, f: f, decls: typeDecls(f), defined: map[string]bool{}, resolving: map[string]bool{}, enums: r.enums, mappings: r.mappings}
+	var methods []string
+	for _, m := range r.Methods {
+		var params []string
+		ids := map[int]string{}
+		for _, p := range m.Parameters {
+			typ, err := t.typ(p.expr)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range p.LowerNames {
+				id, err := t.number(ids, p.expr, "parameters of "+m.Name, name, thriftID(name, m.FieldIDs))
+				if err != nil {
+					return nil, err
+				}
+				params = append(params, fmt.Sprintf("%d: %s %s", id, typ, name))
+			}
+		}
+		result := "void"
+		switch results := wireFields(m.Results); {
+		case len(results) == 1:
+			var err error
+			if result, err = t.typ(m.Results[0].expr); err != nil {
+				return nil, err
+			}
+		case len(results) > 1:
+			result = r.Type + m.Name + "Response"
+			fields, err := t.fields(m.Results, m.FieldIDs, "results of "+m.Name)
+			if err != nil {
+				return nil, err
+			}
+			t.define(result, fields)
+		}
+		methods = append(methods, fmt.Sprintf("  %s %s(%s) throws (1: %sError err)", result, m.Name, strings.Join(params, ", "), r.Type))
+	}
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// %s. DO NOT EDIT.\n\nnamespace go %s\n", generatedMarker, f.Name.Name)
+	for _, s := range t.structs {
+		fmt.Fprintf(&out, "\n%s", s)
+	}
+	fmt.Fprintf(&out, "\nexception %sError {\n  1: string message\n}\n", r.Type)
+	fmt.Fprintf(&out, "\nservice %s {\n", r.Type)
+	for _, m := range methods {
+		fmt.Fprintf(&out, "%s\n", m)
+	}
+	fmt.Fprintf(&out, "}\n")
+	return out.Bytes(), nil
+}
+
+// fields returns the numbered fields of a struct made of types, described
+// as owner in errors, with the IDs given by ids. Fields of pointer types are
+// optional.
+func (t *thriftIDL) fields(types []*Type, ids map[string]int, owner string) ([]string, error) {
+	var fields []string
+	numbers := map[int]string{}
+	for _, field := range types {
+		typ, err := t.typ(field.expr)
+		if err != nil {
+			return nil, err
+		}
+		for i, name := range field.Names {
+			id, err := t.number(numbers, field.expr, owner, name, thriftID(field.LowerNames[i], ids))
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, t.field(id, field.expr, typ, name))
+		}
+	}
+	return fields, nil
+}
+
+// number records id as the ID of the field name of owner in ids, failing if
+// another field has it already.
+func (t *thriftIDL) number(ids map[int]string, node ast.Node, owner, name string, id int) (int, error) {
+	if other, ok := ids[id]; ok {
+		return 0, nodeError(t.fileset, node, CodeThrift, "%s and %s of %s both have Thrift field ID %d", other, name, owner, id)
+	}
+	ids[id] = name
+	return id, nil
+}
+
+// thriftID returns the ID of the Thrift field of the parameter, result or
+// struct field name: the one ids gives it, from the //rpcgen:field
+// directive, or else one derived from the name alone, so that adding,
+// removing or reordering fields never renumbers the others.
+func thriftID(name string, ids map[string]int) int {
+	if id, ok := ids[name]; ok {
+		return id
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32()%maxThriftID) + 1
+}
+
+// structFieldIDs returns the IDs of the Thrift fields of st given by the
+// //rpcgen:field directive in the comments of its fields, as in
+// "//rpcgen:field 3", by field name.
+func structFieldIDs(fileset *token.FileSet, st *ast.StructType) (map[string]int, error) {
+	ids := map[string]int{}
+	for _, field := range st.Fields.List {
+		for _, group := range []*ast.CommentGroup{field.Doc, field.Comment} {
+			if group == nil {
+				continue
+			}
+			for _, c := range group.List {
+				arg, ok := fieldDirective(c.Text)
+				if !ok {
+					continue
+				}
+				id, err := strconv.Atoi(arg)
+				if err != nil || id < 1 || id > maxThriftID || len(field.Names) != 1 {
+					return nil, directiveError(fileset, c, DirectiveField, "invalid Thrift field ID %q, expected a single field and an ID from 1 to %d", arg, maxThriftID)
+				}
+				ids[field.Names[0].Name] = id
+			}
+		}
+	}
+	return ids, nil
+}
+
+// fieldDirective returns the argument of the comment text if it is an
+// //rpcgen:field directive.
+func fieldDirective(text string) (string, bool) {
+	if !strings.HasPrefix(text, directivePrefix) {
+		return "", false
+	}
+	name, arg := strings.TrimSpace(strings.TrimPrefix(text, directivePrefix)), ""
+	if i := strings.IndexAny(name, " ="); i >= 0 {
+		name, arg = name[:i], strings.TrimSpace(name[i+1:])
+	}
+	return arg, name == DirectiveField
+}
+
+func (t *thriftIDL) field(id int, expr ast.Expr, typ, name string) string {
+	if _, ok := expr.(*ast.StarExpr); ok {
+		return fmt.Sprintf("%d: optional %s %s", id, typ, name)
+	}
+	return fmt.Sprintf("%d: %s %s", id, typ, name)
+}
+
+// define adds the definition of a struct.
+func (t *thriftIDL) define(name string, fields []string) {
+	var def bytes.Buffer
+	fmt.Fprintf(&def, "struct %s {\n", name)
+	for _, field := range fields {
+		fmt.Fprintf(&def, "  %s\n", field)
+	}
+	fmt.Fprintf(&def, "}\n")
+	t.structs = append(t.structs, def.String())
+}
+
+// typ returns the Thrift type of the Go type expr. Pointers are replaced
+// with the type they point to.
+func (t *thriftIDL) typ(expr ast.Expr) (string, error) {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return t.typ(e.X)
+	case *ast.Ident:
+		if spec := t.decls[e.Name]; spec != nil && spec.TypeParams == nil {
+			return t.named(spec)
+		}
+		if typ, ok := thriftTypes[e.Name]; ok {
+			return typ, nil
+		}
+	case *ast.StarExpr:
+		return t.typ(e.X)
+	case *ast.ArrayType:
+		if elem, ok := e.Elt.(*ast.Ident); ok && (elem.Name == "byte" || elem.Name == "uint8") {
+			return "binary", nil
+		}
+		elem, err := t.typ(e.Elt)
+		if err != nil {
+			return "", err
+		}
+		return "list<" + elem + ">", nil
+	case *ast.MapType:
+		key, err := t.typ(e.Key)
+		if err != nil {
+			return "", err
+		}
+		value, err := t.typ(e.Value)
+		if err != nil {
+			return "", err
+		}
+		return "map<" + key + ", " + value + ">", nil
+	case *ast.SelectorExpr:
+		if m := typeMapping(t.mappings, t.f.Imports, e); m != nil {
+			return t.mapped(expr, m)
+		}
+		if x, ok := e.X.(*ast.Ident); ok && isTimePackage(t.f.Imports, x.Name) && (e.Sel.Name == "Duration" || e.Sel.Name == "Time") {
+			// Times are timestamps, in microseconds as in Avro, or in the
+			// unit of Unix times.
+			return "i64", nil
+		}
+	}
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, t.fileset, expr)
+	return "", nodeError(t.fileset, expr, CodeThrift, "type %s has no Thrift equivalent", buf.String())
+}
+
+// mapped returns the Thrift type of the type expr mapped to another by m: the
+// type m sets, or else that of the type it is sent as.
+func (t *thriftIDL) mapped(expr ast.Expr, m *TypeMapping) (string, error) {
+	if m.Thrift != "" {
+		return m.Thrift, nil
+	}
+	wire, err := parser.ParseExpr(m.Type)
+	if err == nil {
+		var typ string
+		if typ, err = t.typ(wire); err == nil {
+			return typ, nil
+		}
+	}
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, t.fileset, expr)
+	return "", nodeError(t.fileset, expr, CodeThrift, "type %s, sent as %s, has no Thrift equivalent", buf.String(), m.Type)
+}
+
+// named returns the Thrift type of a type declared in the source file: a
+// struct for a struct type and an enum for an integer enum, defined on first
+// use, and otherwise the type of the underlying type.
+func (t *thriftIDL) named(spec *ast.TypeSpec) (string, error) {
+	name := spec.Name.Name
+	if values := t.enumValues(name); values != nil {
+		if !t.defined[name] {
+			t.defined[name] = true
+			var def bytes.Buffer
+			fmt.Fprintf(&def, "enum %s {\n", name)
+			for _, value := range values {
+				fmt.Fprintf(&def, "  %s\n", value)
+			}
+			fmt.Fprintf(&def, "}\n")
+			t.structs = append(t.structs, def.String())
+		}
+		return name, nil
+	}
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		if t.resolving[name] {
+			return "", nodeError(t.fileset, spec, CodeThrift, "recursive type %s has no Thrift equivalent", name)
+		}
+		t.resolving[name] = true
+		defer delete(t.resolving, name)
+		return t.typ(spec.Type)
+	}
+	if t.defined[name] {
+		return name, nil
+	}
+	t.defined[name] = true
+	ids, err := structFieldIDs(t.fileset, st)
+	if err != nil {
+		return "", err
+	}
+	numbers := map[int]string{}
+	var fields []string
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			return "", nodeError(t.fileset, field, CodeThrift, "embedded field of %s has no Thrift equivalent", name)
+		}
+		// Like gob, only exported fields are encoded.
+		var names []string
+		for _, n := range field.Names {
+			if n.IsExported() {
+				names = append(names, n.Name)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		typ, err := t.typ(field.Type)
+		if err != nil {
+			return "", err
+		}
+		for _, n := range names {
+			id, err := t.number(numbers, field, name, n, thriftID(n, ids))
+			if err != nil {
+				return "", err
+			}
+			fields = append(fields, t.field(id, field.Type, typ, n))
+		}
+	}
+	t.define(name, fields)
+	return name, nil
+}
+
+// enumValues returns the values of the Thrift enum of the type name, such as
+// "Red = 1", or nil if it isn't an integer enum or has values that don't fit
+// in an i32.
+func (t *thriftIDL) enumValues(name string) []string {
+	enum := t.enums[name]
+	if enum == nil || enum.String {
+		return nil
+	}
+	var values []string
+	for _, c := range enum.Constants {
+		v, exact := constant.Int64Val(c.value)
+		if !exact || v < math.MinInt32 || v > math.MaxInt32 {
+			return nil
+		}
+		values = append(values, fmt.Sprintf("%s = %d", c.Name, v))
+	}
+	return values
+}
+
+// fieldID sets the ID of the Thrift field of the parameter or result d names,
+// as in "//rpcgen:field cursor 3".
+func (r *InterfaceGen) fieldID(m *Method, d directive) {
+	args := strings.Fields(d.arg)
+	if len(args) != 2 {
+		r.fail(directiveError(r.fileset, d.comment, d.name, "invalid field directive %q of method %s, expected a parameter or result name and a Thrift field ID", d.arg, m.Name))
+		return
+	}
+	name := args[0]
+	id, err := strconv.Atoi(args[1])
+	if err != nil || id < 1 || id > maxThriftID {
+		r.fail(directiveError(r.fileset, d.comment, d.name, "invalid Thrift field ID %q of %s of method %s, expected 1 to %d", args[1], name, m.Name, maxThriftID))
+		return
+	}
+	if i, _ := groupOf(m.Parameters, name); i < 0 {
+		if i, _ := groupOf(m.Results, name); i < 0 {
+			r.fail(directiveError(r.fileset, d.comment, d.name, "method %s has no parameter or result %s to give a Thrift field ID", m.Name, name))
+			return
+		}
+	}
+	if m.FieldIDs == nil {
+		m.FieldIDs = map[string]int{}
+	}
+	m.FieldIDs[name] = id
+}
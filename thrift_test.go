@@ -0,0 +1,161 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// thriftOf returns the Thrift definition of the interface I declared in src,
+// after the package clause.
+func thriftOf(t *testing.T, src string) (string, error) {
+	t.Helper()
+	opts := &Options{Source: filepath.Join(t.TempDir(), "source.go"), Type: "I"}
+	if err := ioutil.WriteFile(opts.Source, []byte("package p\n\n"+src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts.setDefaults()
+	gen, f, err := parse(opts)
+	if err != nil {
+		return "", err
+	}
+	idl, err := gen.thrift(f)
+	return string(idl), err
+}
+
+// thriftFieldRE matches a Thrift field with its ID.
+var thriftFieldRE = regexp.MustCompile(`(\d+): (?:optional )?\S+ (\w+)`)
+
+// fieldIDs returns the IDs of the fields in idl, by name.
+func fieldIDs(idl string) map[string]string {
+	ids := map[string]string{}
+	for _, m := range thriftFieldRE.FindAllStringSubmatch(idl, -1) {
+		ids[m[2]] = m[1]
+	}
+	return ids
+}
+
+// TestThriftIDsStable checks that adding, removing and reordering
+// parameters, results and struct fields never renumbers the others.
+func TestThriftIDsStable(t *testing.T) {
+	versions := []string{
+		"type S struct{ A, B int }\ntype I interface{ M(x, y int, s S) (p, q int, err error) }",
+		"type S struct{ B int; C string; A int }\ntype I interface{ M(y int, s S, z string, x int) (q, r, p int, err error) }",
+		"type S struct{ A int; B int }\ntype I interface{ M(s S, x, y int) (p, q int, err error) }",
+	}
+	want := map[string]string{}
+	for i, src := range versions {
+		idl, err := thriftOf(t, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, id := range fieldIDs(idl) {
+			if name == "message" {
+				continue
+			}
+			if w, ok := want[name]; ok && w != id {
+				t.Errorf("version %d: %s is field %s, was %s", i, name, id, w)
+			}
+			want[name] = id
+		}
+	}
+	if len(want) < 8 {
+		t.Errorf("only found %v", want)
+	}
+}
+
+func TestThriftFieldDirective(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		ids  map[string]string
+		err  string
+	}{
+		{
+			name: "parameter",
+			src:  "type I interface {\n\t//rpcgen:field x 3\n\tM(x, y int) (err error)\n}",
+			ids:  map[string]string{"x": "3"},
+		},
+		{
+			name: "result",
+			src:  "type I interface {\n\t//rpcgen:field q 12\n\tM() (p, q int, err error)\n}",
+			ids:  map[string]string{"Q": "12"},
+		},
+		{
+			name: "struct field",
+			src:  "type S struct {\n\t//rpcgen:field 5\n\tA int\n\tB int //rpcgen:field 6\n}\ntype I interface{ M(s S) (err error) }",
+			ids:  map[string]string{"A": "5", "B": "6"},
+		},
+		{
+			name: "unknown name",
+			src:  "type I interface {\n\t//rpcgen:field z 3\n\tM(x int) (err error)\n}",
+			err:  "no parameter or result z",
+		},
+		{
+			name: "out of range",
+			src:  "type I interface {\n\t//rpcgen:field x 40000\n\tM(x int) (err error)\n}",
+			err:  "invalid Thrift field ID",
+		},
+		{
+			name: "missing ID",
+			src:  "type I interface {\n\t//rpcgen:field x\n\tM(x int) (err error)\n}",
+			err:  "invalid field directive",
+		},
+		{
+			name: "struct field group",
+			src:  "type S struct {\n\t//rpcgen:field 5\n\tA, B int\n}\ntype I interface{ M(s S) (err error) }",
+			err:  "expected a single field",
+		},
+		{
+			name: "duplicate",
+			src:  "type I interface {\n\t//rpcgen:field x 3\n\t//rpcgen:field y 3\n\tM(x, y int) (err error)\n}",
+			err:  "x and y of parameters of M both have Thrift field ID 3",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idl, err := thriftOf(t, test.src)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := fieldIDs(idl)
+			for name, id := range test.ids {
+				if ids[name] != id {
+					t.Errorf("%s is field %s, want %s\n%s", name, ids[name], id, idl)
+				}
+			}
+		})
+	}
+}
+
+// TestThriftGolden generates the Thrift definition of an interface with
+// structs and field directives along with its stubs.
+func TestThriftGolden(t *testing.T) {
+	renderGolden(t, "thrift", Options{
+		Source: "testdata/thrift/catalog.go",
+		Type:   "Catalog",
+		Thrift: true,
+	})
+}
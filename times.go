@@ -0,0 +1,133 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// Encodings of time.Time parameters and results sent as Unix times, as set
+// by the //rpcgen:unix and //rpcgen:unixmilli directives.
+const (
+	UnixSeconds      = "seconds"
+	UnixMilliseconds = "milliseconds"
+)
+
+// unixTime makes the time.Time parameters and results d names, separated by
+// spaces or commas, sent as Unix times in seconds, or in milliseconds for
+// //rpcgen:unixmilli. Named fields sharing their type with others get a
+// group of their own.
+func (r *InterfaceGen) unixTime(m *Method, d directive) {
+	unit := UnixSeconds
+	if d.name == DirectiveUnixMilli {
+		unit = UnixMilliseconds
+	}
+	names := strings.FieldsFunc(d.arg, func(c rune) bool { return c == ',' || c == ' ' || c == '\t' })
+	for _, name := range names {
+		found := false
+		for _, list := range []*[]*Type{&m.Parameters, &m.Results} {
+			i, j := groupOf(*list, name)
+			if i < 0 {
+				continue
+			}
+			found = true
+			if t := (*list)[i]; !r.isTime(t.expr) {
+				r.fail(directiveError(r.fileset, d.comment, d.name, "%s of type %s can't be sent as a Unix time, only time.Time can", name, t.Type))
+				continue
+			}
+			*list = splitGroup(*list, i, j)
+			i, _ = groupOf(*list, name)
+			(*list)[i].Unix = unit
+		}
+		if !found {
+			r.fail(directiveError(r.fileset, d.comment, d.name, "method %s has no parameter or result %s to send as a Unix time", m.Name, name))
+		}
+	}
+}
+
+// groupOf returns the index in list of the group of the field name, as
+// declared, and its index in the group, or -1 if there is none.
+func groupOf(list []*Type, name string) (int, int) {
+	for i, t := range list {
+		for j, lowerName := range t.LowerNames {
+			if lowerName == name {
+				return i, j
+			}
+		}
+	}
+	return -1, -1
+}
+
+// isTime reports whether expr is time.Time.
+func (r *InterfaceGen) isTime(expr ast.Expr) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Time" {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	return ok && isTimePackage(r.checkImports, x.Name)
+}
+
+// splitGroup returns list with the name at index j of its group at index i
+// moved to a group of its own, between groups of the names before and after
+// it.
+func splitGroup(list []*Type, i, j int) []*Type {
+	t := list[i]
+	if len(t.Names) == 1 {
+		return list
+	}
+	var groups []*Type
+	for _, names := range [][2]int{{0, j}, {j, j + 1}, {j + 1, len(t.Names)}} {
+		if names[0] == names[1] {
+			continue
+		}
+		group := *t
+		group.Names = t.Names[names[0]:names[1]:names[1]]
+		group.LowerNames = t.LowerNames[names[0]:names[1]:names[1]]
+		groups = append(groups, &group)
+	}
+	out := append([]*Type{}, list[:i]...)
+	out = append(out, groups...)
+	return append(out, list[i+1:]...)
+}
+
+// toWire returns the expression of the value of v, of the type of t, as
+// sent.
+func toWire(t *Type, v string) string {
+	switch {
+	case t.Unix == UnixSeconds:
+		return v + ".Unix()"
+	case t.Unix == UnixMilliseconds:
+		return v + ".UnixMilli()"
+	case t.Mapping != nil:
+		return fmt.Sprintf("%s(%s)", t.Mapping.Encode, v)
+	}
+	return v
+}
+
+// fromWire returns the expression of the value of the type of t of v, as
+// sent. Unix times are in UTC. Values of mapped types are decoded apart, as
+// that can fail.
+func fromWire(t *Type, v string) string {
+	switch t.Unix {
+	case UnixSeconds:
+		return fmt.Sprintf("time.Unix(%s, 0).UTC()", v)
+	case UnixMilliseconds:
+		return fmt.Sprintf("time.UnixMilli(%s).UTC()", v)
+	}
+	return v
+}
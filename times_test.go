@@ -0,0 +1,148 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnixDirectives(t *testing.T) {
+	tests := []struct {
+		name       string
+		directives string
+		method     string
+		// units are the names of the parameters, then of the results,
+		// with the unit they are sent in, if any.
+		units []string
+		codes []string
+	}{
+		{
+			name:   "none",
+			method: "M(at time.Time) (err error)",
+			units:  []string{"at"},
+		},
+		{
+			name:       "seconds",
+			directives: "//rpcgen:unix at",
+			method:     "M(at time.Time) (err error)",
+			units:      []string{"at:seconds"},
+		},
+		{
+			name:       "milliseconds result",
+			directives: "//rpcgen:unixmilli until",
+			method:     "M() (from, until time.Time, err error)",
+			units:      []string{"from", "until:milliseconds"},
+		},
+		{
+			name:       "split group",
+			directives: "//rpcgen:unix b",
+			method:     "M(a, b, c time.Time) (err error)",
+			units:      []string{"a", "b:seconds", "c"},
+		},
+		{
+			name:       "both units",
+			directives: "//rpcgen:unix a, c\n\t//rpcgen:unixmilli b",
+			method:     "M(a, b, c time.Time) (err error)",
+			units:      []string{"a:seconds", "b:milliseconds", "c:seconds"},
+		},
+		{
+			name:       "not a time",
+			directives: "//rpcgen:unix n",
+			method:     "M(n int64) (err error)",
+			codes:      []string{CodeDirective},
+		},
+		{
+			name:       "unknown name",
+			directives: "//rpcgen:unixmilli at",
+			method:     "M(when time.Time) (err error)",
+			codes:      []string{CodeDirective},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := "package p\n\nimport \"time\"\n\ntype I interface {\n\t" + test.directives + "\n\t" + test.method + "\n}\n"
+			gen, err := parseInterface(t, src, "I", Options{})
+			if codes := diagnosticCodes(err); !reflect.DeepEqual(codes, test.codes) {
+				t.Fatalf("got %v (%v), want %v", codes, err, test.codes)
+			}
+			if err != nil {
+				return
+			}
+			var units []string
+			m := gen.Methods[0]
+			for _, group := range append(append([]*Type{}, m.Parameters...), m.Results...) {
+				for _, name := range group.LowerNames {
+					if group.Unix != "" {
+						name += ":" + group.Unix
+					}
+					units = append(units, name)
+				}
+			}
+			if !reflect.DeepEqual(units, test.units) {
+				t.Errorf("got %v, want %v", units, test.units)
+			}
+		})
+	}
+}
+
+func TestWireConversions(t *testing.T) {
+	tests := []struct {
+		typ          Type
+		toWire, from string
+	}{
+		{Type{Type: "time.Time"}, "v", "v"},
+		{Type{Type: "time.Time", Unix: UnixSeconds}, "v.Unix()", "time.Unix(v, 0).UTC()"},
+		{Type{Type: "time.Time", Unix: UnixMilliseconds}, "v.UnixMilli()", "time.UnixMilli(v).UTC()"},
+	}
+	for _, test := range tests {
+		if got := toWire(&test.typ, "v"); got != test.toWire {
+			t.Errorf("toWire(%s) = %s, want %s", test.typ.Unix, got, test.toWire)
+		}
+		if got := fromWire(&test.typ, "v"); got != test.from {
+			t.Errorf("fromWire(%s) = %s, want %s", test.typ.Unix, got, test.from)
+		}
+	}
+}
+
+// TestTimesGolden generates the stubs of an interface sending times as is and
+// as Unix times, with the binary codec encoding them.
+func TestTimesGolden(t *testing.T) {
+	renderGolden(t, "times", Options{
+		Source:      "testdata/times/events.go",
+		Type:        "Events",
+		BinaryCodec: true,
+	})
+}
+
+// TestTimesThrift checks that Thrift declares times as timestamps.
+func TestTimesThrift(t *testing.T) {
+	opts := Options{Source: "testdata/times/events.go", Type: "Events", Thrift: true}
+	opts.setDefaults()
+	_, files, err := render(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if strings.HasSuffix(f.Path, ".thrift") {
+			if !strings.Contains(string(f.Content), "i64 at") {
+				t.Errorf("%s declares at other than as an i64:\n%s", f.Path, f.Content)
+			}
+			return
+		}
+	}
+	t.Error("no Thrift definition was generated")
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2018 Samsung Electronics Co., Ltd All Rights Reserved
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/ast"
+	"path/filepath"
+)
+
+// TypeMapping is how values of a Go type declared in another package, such
+// as a decimal or a UUID, are sent, as configured by the wire_types option:
+//
+//	wire_types:
+//	  github.com/google/uuid.UUID:
+//	    type: string
+//	    encode: uuid.UUID.String
+//	    decode: uuid.Parse
+//
+// It is part of the data model passed to templates.
+type TypeMapping struct {
+	// Type is the Go type of the request and response fields values are
+	// sent as, which the codecs and schemas are those of.
+	Type string `yaml:"type" json:"type"`
+	// Encode is the function or method expression converting values to
+	// Type, such as uuid.UUID.String.
+	Encode string `yaml:"encode" json:"encode"`
+	// Decode is the function converting values of Type back, returning an
+	// error for invalid ones, such as uuid.Parse.
+	Decode string `yaml:"decode" json:"decode"`
+	// Avro is the JSON of the Avro schema of the type, if not that of Type,
+	// such as {"type": "string", "logicalType": "uuid"}.
+	Avro string `yaml:"avro" json:"avro,omitempty"`
+	// Thrift is the Thrift type of the type, if not that of Type.
+	Thrift string `yaml:"thrift" json:"thrift,omitempty"`
+}
+
+// typeMapping returns the mapping in mappings of the type expr, named by the
+// path of its package and its name, in a file with imports, or nil if it is
+// sent as is.
+func typeMapping(mappings map[string]*TypeMapping, imports []*ast.ImportSpec, expr ast.Expr) *TypeMapping {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || len(mappings) == 0 {
+		return nil
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	for _, imp := range imports {
+		importPath := imp.Path.Value[1 : len(imp.Path.Value)-1]
+		if (imp.Name != nil && imp.Name.Name == x.Name) || (imp.Name == nil && (filepath.Base(importPath) == x.Name || guessPackageName(importPath) == x.Name)) {
+			return mappings[importPath+"."+sel.Sel.Name]
+		}
+	}
+	return nil
+}